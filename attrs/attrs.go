@@ -0,0 +1,326 @@
+// Package attrs implements the attribute credentials the KDC signs and the
+// claims users prove about them in zero knowledge.
+//
+// A credential assigns a value to each attribute in Names. The KDC signs
+// MiMC(Principal(name), Encode(v_1), ..., Encode(v_N)) with EdDSA over
+// the twisted Edwards curve of the deployment's curve (see
+// curves.TwistedEdwards), so a circuit can check the signature while
+// keeping the values hidden. Missing attributes are empty strings.
+package attrs
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	eddsa_bls12377 "github.com/consensys/gnark-crypto/ecc/bls12-377/twistededwards/eddsa"
+	eddsa_bls12381 "github.com/consensys/gnark-crypto/ecc/bls12-381/twistededwards/eddsa"
+	eddsa_bn254 "github.com/consensys/gnark-crypto/ecc/bn254/twistededwards/eddsa"
+	"github.com/consensys/gnark-crypto/signature"
+	"github.com/consensys/gnark-crypto/signature/eddsa"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// N is the number of attributes in a credential.
+const N = 4
+
+// Names are the attributes of a credential, in the order they are signed.
+var Names = [N]string{"role", "department", "clearance", "project"}
+
+// ErrSignature is returned for a credential the key did not sign.
+var ErrSignature = errors.New("attrs: bad credential signature")
+
+// Index returns the position of attribute name in Names, or -1.
+func Index(name string) int {
+	for i, n := range Names {
+		if n == name {
+			return i
+		}
+	}
+	return -1
+}
+
+// Encode maps an attribute value into curve's scalar field. Decimal
+// numbers below 2^64 map to themselves so they can be compared; anything
+// else is hashed, and lands far above them.
+func Encode(curve ecc.ID, value string) *big.Int {
+	if n, err := strconv.ParseUint(value, 10, 64); err == nil {
+		return new(big.Int).SetUint64(n)
+	}
+	return hashToField(curve, "zk-kerb attribute\x00"+value)
+}
+
+// Principal maps a principal name into curve's scalar field, so
+// credentials can be bound to their holder.
+func Principal(curve ecc.ID, name string) *big.Int {
+	return hashToField(curve, "zk-kerb principal\x00"+name)
+}
+
+func hashToField(curve ecc.ID, s string) *big.Int {
+	h := sha256.Sum256([]byte(s))
+	return new(big.Int).Mod(new(big.Int).SetBytes(h[:]), curve.ScalarField())
+}
+
+// Message returns the value the KDC signs for principal's values.
+func Message(curve ecc.ID, principal string, values [N]string) ([]byte, error) {
+	h := curves.MiMC(curve)
+	xs := []*big.Int{Principal(curve, principal)}
+	for _, v := range values {
+		xs = append(xs, Encode(curve, v))
+	}
+	for _, x := range xs {
+		if _, err := h.Write(x.FillBytes(make([]byte, curves.ElementSize))); err != nil {
+			return nil, err
+		}
+	}
+	return h.Sum(nil), nil
+}
+
+// Key is a credential signing key and the curve it is for.
+type Key struct {
+	Curve  ecc.ID
+	Signer signature.Signer
+}
+
+// Issuer returns the public half of k, tagged with its curve.
+func (k *Key) Issuer() []byte {
+	return curves.Tag(k.Curve, k.Signer.Public().Bytes())
+}
+
+// Credential is a KDC-signed set of attributes for one principal. Issuer
+// is the compressed public key it was signed with, tagged with its curve.
+type Credential struct {
+	Principal  string            `json:"principal"`
+	Attributes map[string]string `json:"attributes"`
+	Issuer     []byte            `json:"issuer"`
+	Signature  []byte            `json:"signature"`
+}
+
+// Values returns the credential's attributes in the order of Names.
+func (c *Credential) Values() ([N]string, error) {
+	var values [N]string
+	for name, v := range c.Attributes {
+		i := Index(name)
+		if i < 0 {
+			return values, fmt.Errorf("attrs: unknown attribute %q", name)
+		}
+		values[i] = v
+	}
+	return values, nil
+}
+
+// Issue signs attributes for principal with key.
+func Issue(key *Key, principal string, attributes map[string]string) (*Credential, error) {
+	c := &Credential{Principal: principal, Attributes: attributes, Issuer: key.Issuer()}
+	values, err := c.Values()
+	if err != nil {
+		return nil, err
+	}
+	msg, err := Message(key.Curve, principal, values)
+	if err != nil {
+		return nil, err
+	}
+	if c.Signature, err = key.Signer.Sign(msg, curves.MiMC(key.Curve)); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// IssuerKey decodes the credential's Issuer into its curve and key.
+func (c *Credential) IssuerKey() (ecc.ID, signature.PublicKey, error) {
+	curve, raw, err := curves.Untag(c.Issuer)
+	if err != nil {
+		return ecc.UNKNOWN, nil, fmt.Errorf("attrs: bad issuer key: %w", err)
+	}
+	pub := newPublicKey(curve)
+	if _, err := pub.SetBytes(raw); err != nil {
+		return ecc.UNKNOWN, nil, fmt.Errorf("attrs: bad issuer key: %w", err)
+	}
+	return curve, pub, nil
+}
+
+// Verify checks the credential's signature against pub, a key on curve.
+func (c *Credential) Verify(curve ecc.ID, pub signature.PublicKey) error {
+	values, err := c.Values()
+	if err != nil {
+		return err
+	}
+	msg, err := Message(curve, c.Principal, values)
+	if err != nil {
+		return err
+	}
+	ok, err := pub.Verify(c.Signature, msg, curves.MiMC(curve))
+	if err != nil || !ok {
+		return ErrSignature
+	}
+	return nil
+}
+
+func newPublicKey(curve ecc.ID) signature.PublicKey {
+	switch curve {
+	case ecc.BLS12_381:
+		return new(eddsa_bls12381.PublicKey)
+	case ecc.BLS12_377:
+		return new(eddsa_bls12377.PublicKey)
+	}
+	return new(eddsa_bn254.PublicKey)
+}
+
+func newSigner(curve ecc.ID) signature.Signer {
+	switch curve {
+	case ecc.BLS12_381:
+		return new(eddsa_bls12381.PrivateKey)
+	case ecc.BLS12_377:
+		return new(eddsa_bls12377.PrivateKey)
+	}
+	return new(eddsa_bn254.PrivateKey)
+}
+
+// LoadOrCreateKey reads a hex-encoded signing key for curve from path,
+// generating and saving a new one if the file does not exist. Keys are
+// tagged with their curve; an untagged one is from before there was a
+// choice, and is for BN254.
+func LoadOrCreateKey(path string, curve ecc.ID) (*Key, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		signer, err := eddsa.New(curves.TwistedEdwards(curve), rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		key := &Key{Curve: curve, Signer: signer}
+		if err := os.WriteFile(path, []byte(hex.EncodeToString(curves.Tag(curve, signer.Bytes()))+"\n"), 0o600); err != nil {
+			return nil, err
+		}
+		return key, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	raw, err := hex.DecodeString(strings.TrimSpace(string(b)))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	have, body, err := curves.Untag(raw)
+	switch {
+	case errors.Is(err, curves.ErrUntagged):
+		have, body = ecc.BN254, raw
+	case err != nil:
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if have != curve {
+		return nil, fmt.Errorf("%s: key is for %s, not %s", path, have, curve)
+	}
+	signer := newSigner(curve)
+	if _, err := signer.SetBytes(body); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &Key{Curve: curve, Signer: signer}, nil
+}
+
+// ParseClaims parses a comma-separated list of claims such as
+// "role=admin,clearance>=3".
+func ParseClaims(s string) ([]krb.Claim, error) {
+	var claims []krb.Claim
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		var c krb.Claim
+		for _, op := range []struct {
+			sep string
+			op  int
+		}{{">=", krb.ClaimGE}, {"<=", krb.ClaimLE}, {"=", krb.ClaimEq}} {
+			if name, value, ok := strings.Cut(part, op.sep); ok {
+				c = krb.Claim{Attribute: strings.TrimSpace(name), Op: op.op, Value: strings.TrimSpace(value)}
+				break
+			}
+		}
+		if c.Op == 0 {
+			return nil, fmt.Errorf("attrs: claim %q has no =, >= or <=", part)
+		}
+		claims = append(claims, c)
+	}
+	return claims, CheckClaims(claims)
+}
+
+// CheckClaims checks that claims name known attributes, at most once
+// each, and that range claims compare against numbers.
+func CheckClaims(claims []krb.Claim) error {
+	seen := map[string]bool{}
+	for _, c := range claims {
+		if Index(c.Attribute) < 0 {
+			return fmt.Errorf("attrs: unknown attribute %q", c.Attribute)
+		}
+		if seen[c.Attribute] {
+			return fmt.Errorf("attrs: more than one claim about %s", c.Attribute)
+		}
+		seen[c.Attribute] = true
+		switch c.Op {
+		case krb.ClaimEq:
+		case krb.ClaimGE, krb.ClaimLE:
+			if _, err := strconv.ParseUint(c.Value, 10, 64); err != nil {
+				return fmt.Errorf("attrs: %s compares against a non-number", c)
+			}
+		default:
+			return fmt.Errorf("attrs: claim about %s has unknown operator %d", c.Attribute, c.Op)
+		}
+	}
+	return nil
+}
+
+// Holds reports whether value satisfies claim.
+func Holds(claim krb.Claim, value string) bool {
+	if claim.Op == krb.ClaimEq {
+		// Encode is injective on numbers and hashes everything else, so
+		// this matches equality of encodings on any curve.
+		v, verr := strconv.ParseUint(value, 10, 64)
+		w, werr := strconv.ParseUint(claim.Value, 10, 64)
+		if verr == nil && werr == nil {
+			return v == w
+		}
+		return verr != nil && werr != nil && value == claim.Value
+	}
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return false
+	}
+	w, err := strconv.ParseUint(claim.Value, 10, 64)
+	if err != nil {
+		return false
+	}
+	switch claim.Op {
+	case krb.ClaimGE:
+		return v >= w
+	case krb.ClaimLE:
+		return v <= w
+	}
+	return false
+}
+
+// Satisfies reports whether the proven claims have imply want: an
+// equality implies itself and any range that holds for its value, and a
+// range implies any looser range in the same direction.
+func Satisfies(have []krb.Claim, want krb.Claim) bool {
+	for _, h := range have {
+		if h.Attribute != want.Attribute {
+			continue
+		}
+		if h.Op == krb.ClaimEq && Holds(want, h.Value) {
+			return true
+		}
+		if h.Op == want.Op && want.Op != krb.ClaimEq && Holds(want, h.Value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,139 @@
+// Package batchverify checks many Groth16 proofs against one BN254
+// verifying key at once. Each proof i passes when
+//
+//	e(Ar_i, Bs_i) · e(L_i, -γ) · e(Krs_i, -δ) · e(α, -β) = 1
+//
+// where L_i folds its public inputs into the key. Raising each equation to
+// a random r_i and multiplying them gives
+//
+//	Π e(r_i·Ar_i, Bs_i) · e(Σ r_i·L_i, -γ) · e(Σ r_i·Krs_i, -δ) · e(Σ r_i·α, -β) = 1
+//
+// a single multi-pairing of n+3 Miller loops and one final exponentiation
+// where verifying one by one costs 3n loops and n exponentiations. A batch
+// with any bad proof passes with probability about 2^-128.
+package batchverify
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	curve "github.com/consensys/gnark-crypto/ecc/bn254"
+	"github.com/consensys/gnark-crypto/ecc/bn254/fr"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+)
+
+var (
+	// ErrUnsupported means the key or a proof can't be batched: it is not
+	// over BN254, or uses Pedersen commitments. Verify those one by one.
+	ErrUnsupported = errors.New("batchverify: key or proof cannot be batched")
+	// ErrBatch means some proof in the batch does not verify.
+	ErrBatch = errors.New("batchverify: batch does not verify")
+)
+
+// Verify checks that every proof verifies against vk with the public
+// witness at the same index. It does not say which proof failed.
+func Verify(vk groth16.VerifyingKey, proofs []groth16.Proof, publics []witness.Witness) error {
+	if len(proofs) != len(publics) {
+		return fmt.Errorf("batchverify: %d proofs but %d public witnesses", len(proofs), len(publics))
+	}
+	if len(proofs) == 0 {
+		return nil
+	}
+	bvk, ok := vk.(*groth16_bn254.VerifyingKey)
+	if !ok || len(bvk.PublicAndCommitmentCommitted) > 0 {
+		return ErrUnsupported
+	}
+
+	n := len(proofs)
+	ps := make([]curve.G1Affine, 0, n+3)
+	qs := make([]curve.G2Affine, 0, n+3)
+	// coeffs[k] is Σ r_i·x_ik, the weight of K[k] in Σ r_i·L_i; x_i0 = 1
+	coeffs := make(fr.Vector, len(bvk.G1.K))
+	var krsSum curve.G1Jac
+	for i := range proofs {
+		p, ok := proofs[i].(*groth16_bn254.Proof)
+		if !ok || len(p.Commitments) > 0 {
+			return ErrUnsupported
+		}
+		if !p.Ar.IsInSubGroup() || !p.Krs.IsInSubGroup() || !p.Bs.IsInSubGroup() {
+			return ErrBatch
+		}
+		pub, ok := publics[i].Vector().(fr.Vector)
+		if !ok || len(pub) != len(bvk.G1.K)-1 {
+			return fmt.Errorf("batchverify: public witness %d does not fit the key", i)
+		}
+
+		r, err := randomScalar(i)
+		if err != nil {
+			return err
+		}
+		var rb big.Int
+		r.BigInt(&rb)
+
+		var ar curve.G1Affine
+		ar.ScalarMultiplication(&p.Ar, &rb)
+		ps = append(ps, ar)
+		qs = append(qs, p.Bs)
+
+		var krs curve.G1Jac
+		krs.FromAffine(&p.Krs)
+		krs.ScalarMultiplication(&krs, &rb)
+		krsSum.AddAssign(&krs)
+
+		coeffs[0].Add(&coeffs[0], &r)
+		for k, x := range pub {
+			var t fr.Element
+			t.Mul(&r, &x)
+			coeffs[k+1].Add(&coeffs[k+1], &t)
+		}
+	}
+
+	var lSum curve.G1Jac
+	if _, err := lSum.MultiExp(bvk.G1.K, coeffs, ecc.MultiExpConfig{}); err != nil {
+		return err
+	}
+	var alpha curve.G1Affine
+	var rSum big.Int
+	coeffs[0].BigInt(&rSum)
+	alpha.ScalarMultiplication(&bvk.G1.Alpha, &rSum)
+
+	var l, krs curve.G1Affine
+	l.FromJacobian(&lSum)
+	krs.FromJacobian(&krsSum)
+	var gammaNeg, deltaNeg, betaNeg curve.G2Affine
+	gammaNeg.Neg(&bvk.G2.Gamma)
+	deltaNeg.Neg(&bvk.G2.Delta)
+	betaNeg.Neg(&bvk.G2.Beta)
+	ps = append(ps, l, krs, alpha)
+	qs = append(qs, gammaNeg, deltaNeg, betaNeg)
+
+	ok, err := curve.PairingCheck(ps, qs)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrBatch
+	}
+	return nil
+}
+
+// randomScalar returns the weight of proof i: 1 for the first, since only
+// the ratios matter, and 128 random bits for the rest.
+func randomScalar(i int) (fr.Element, error) {
+	var r fr.Element
+	if i == 0 {
+		r.SetOne()
+		return r, nil
+	}
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return r, err
+	}
+	r.SetBytes(b[:])
+	return r, nil
+}
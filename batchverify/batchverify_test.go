@@ -0,0 +1,118 @@
+package batchverify_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	groth16_bn254 "github.com/consensys/gnark/backend/groth16/bn254"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/logger"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/batchverify"
+)
+
+// square proves knowledge of X with X·X == Y, bound to a second public
+// input Z, so a batch folds more than one input per proof.
+type square struct {
+	X frontend.Variable `gnark:"x"`
+	Y frontend.Variable `gnark:",public"`
+	Z frontend.Variable `gnark:",public"`
+}
+
+func (c *square) Define(api frontend.API) error {
+	api.AssertIsEqual(api.Mul(c.X, c.X), c.Y)
+	api.Mul(c.Z, c.Z)
+	return nil
+}
+
+// prove sets up square and proves it for x = 1..n.
+func prove(t *testing.T, n int) (groth16.VerifyingKey, []groth16.Proof, []witness.Witness) {
+	t.Helper()
+	logger.Disable()
+	cs, err := frontend.Compile(ecc.BN254.ScalarField(), r1cs.NewBuilder, &square{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(cs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proofs := make([]groth16.Proof, n)
+	pubs := make([]witness.Witness, n)
+	for i := range n {
+		x := i + 1
+		full, err := frontend.NewWitness(&square{X: x, Y: x * x, Z: 100 + i}, ecc.BN254.ScalarField())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if proofs[i], err = groth16.Prove(cs, pk, full); err != nil {
+			t.Fatal(err)
+		}
+		if pubs[i], err = full.Public(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return vk, proofs, pubs
+}
+
+func TestVerify(t *testing.T) {
+	vk, proofs, pubs := prove(t, 4)
+	for n := range len(proofs) + 1 {
+		if err := batchverify.Verify(vk, proofs[:n], pubs[:n]); err != nil {
+			t.Errorf("batch of %d good proofs: %v", n, err)
+		}
+	}
+}
+
+func TestVerifyTamperedProof(t *testing.T) {
+	vk, proofs, pubs := prove(t, 4)
+
+	// a proof with another proof's Krs
+	p := *proofs[2].(*groth16_bn254.Proof)
+	p.Krs = proofs[1].(*groth16_bn254.Proof).Krs
+	bad := append([]groth16.Proof{}, proofs...)
+	bad[2] = &p
+
+	if err := batchverify.Verify(vk, bad, pubs); !errors.Is(err, batchverify.ErrBatch) {
+		t.Errorf("batch with a tampered proof: got %v, want %v", err, batchverify.ErrBatch)
+	}
+	if err := batchverify.Verify(vk, bad[2:3], pubs[2:3]); !errors.Is(err, batchverify.ErrBatch) {
+		t.Errorf("tampered proof alone: got %v, want %v", err, batchverify.ErrBatch)
+	}
+}
+
+func TestVerifyTamperedWitness(t *testing.T) {
+	vk, proofs, pubs := prove(t, 4)
+
+	// two proofs answering each other's public inputs
+	bad := append([]witness.Witness{}, pubs...)
+	bad[0], bad[3] = pubs[3], pubs[0]
+	if err := batchverify.Verify(vk, proofs, bad); !errors.Is(err, batchverify.ErrBatch) {
+		t.Errorf("batch with swapped witnesses: got %v, want %v", err, batchverify.ErrBatch)
+	}
+
+	// one proof's second input changed
+	full, err := frontend.NewWitness(&square{X: 2, Y: 4, Z: 999}, ecc.BN254.ScalarField())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bad[1], err = full.Public(); err != nil {
+		t.Fatal(err)
+	}
+	bad[0], bad[3] = pubs[0], pubs[3]
+	if err := batchverify.Verify(vk, proofs, bad); !errors.Is(err, batchverify.ErrBatch) {
+		t.Errorf("batch with a changed public input: got %v, want %v", err, batchverify.ErrBatch)
+	}
+}
+
+func TestVerifyMismatch(t *testing.T) {
+	vk, proofs, pubs := prove(t, 2)
+	err := batchverify.Verify(vk, proofs, pubs[:1])
+	if err == nil || errors.Is(err, batchverify.ErrBatch) {
+		t.Errorf("2 proofs, 1 witness: got %v, want a length error", err)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/native/twistededwards"
+	"github.com/consensys/gnark/std/hash/mimc"
+	stdeddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/attrs"
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// attrCircuitID names the attribute claim circuit (must match KDC)
+const attrCircuitID = "eddsa-attr-v1"
+
+// AttrCircuit must match the server’s
+type AttrCircuit struct {
+	Attr      [attrs.N]frontend.Variable `gnark:"attr"`
+	Signature stdeddsa.Signature         `gnark:"signature"`
+
+	PublicKey stdeddsa.PublicKey         `gnark:",public"`
+	Principal frontend.Variable          `gnark:",public"`
+	Op        [attrs.N]frontend.Variable `gnark:",public"`
+	Value     [attrs.N]frontend.Variable `gnark:",public"`
+	Challenge frontend.Variable          `gnark:",public"`
+}
+
+func (c *AttrCircuit) Define(api frontend.API) error {
+	// the KDC signed MiMC(Principal, Attr...)
+	id, err := curves.FromField(api.Compiler().Field())
+	if err != nil {
+		return err
+	}
+	curve, err := twistededwards.NewEdCurve(api, curves.TwistedEdwards(id))
+	if err != nil {
+		return err
+	}
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.Principal)
+	h.Write(c.Attr[:]...)
+	msg := h.Sum()
+	h.Reset()
+	if err := stdeddsa.Verify(curve, c.Signature, msg, c.PublicKey, &h); err != nil {
+		return err
+	}
+
+	// each claimed attribute satisfies its claim
+	for i := range attrs.N {
+		op := api.ToBinary(c.Op[i], 2)
+		eq := api.IsZero(api.Sub(c.Attr[i], c.Value[i]))
+		cmp := api.Cmp(c.Attr[i], c.Value[i])
+		ge := api.Sub(1, api.IsZero(api.Add(cmp, 1)))
+		le := api.Sub(1, api.IsZero(api.Sub(cmp, 1)))
+		api.AssertIsEqual(api.Lookup2(op[0], op[1], 1, eq, ge, le), 1)
+		api.ToBinary(api.Mul(c.Attr[i], op[1]), 64)
+	}
+
+	api.Mul(c.Challenge, c.Challenge)
+	return nil
+}
+
+// ClaimAuth loads user's credential from path and the attribute circuit,
+// and returns a prover of claims about the credential. Attributes not
+// claimed stay hidden from the KDC.
+func ClaimAuth(user, path string, claims []krb.Claim) krb.ClaimProver {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		log.Fatalf("credential: %v", err)
+	}
+	var cred attrs.Credential
+	if err := json.Unmarshal(b, &cred); err != nil {
+		log.Fatalf("credential %s: %v", path, err)
+	}
+	if cred.Principal != user {
+		log.Fatalf("credential %s is for %s, not %s", path, cred.Principal, user)
+	}
+	curve, issuer, err := cred.IssuerKey()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := cred.Verify(curve, issuer); err != nil {
+		log.Fatalf("credential %s: %v", path, err)
+	}
+	values, err := cred.Values()
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, c := range claims {
+		if !attrs.Holds(c, values[attrs.Index(c.Attribute)]) {
+			log.Fatalf("credential %s does not support the claim %s", path, c)
+		}
+	}
+
+	cs, pk := loadProvingKey(attrCircuitID, &AttrCircuit{})
+	if pk.CurveID() != curve {
+		log.Fatalf("credential %s was signed for %s, but the KDC runs on %s", path, curve, pk.CurveID())
+	}
+
+	return func(ch *krb.PAZKChallenge, binding []byte) (krb.PAData, error) {
+		assignment := AttrCircuit{
+			Principal: attrs.Principal(curve, user),
+			Challenge: new(big.Int).Mod(new(big.Int).SetBytes(binding), curve.ScalarField()),
+		}
+		assignment.PublicKey.Assign(curves.TwistedEdwards(curve), issuer.Bytes())
+		assignment.Signature.Assign(curves.TwistedEdwards(curve), cred.Signature)
+		for i, v := range values {
+			assignment.Attr[i] = attrs.Encode(curve, v)
+			assignment.Op[i], assignment.Value[i] = 0, 0
+		}
+		for _, c := range claims {
+			i := attrs.Index(c.Attribute)
+			assignment.Op[i], assignment.Value[i] = c.Op, attrs.Encode(curve, c.Value)
+		}
+		fullWit, err := frontend.NewWitness(&assignment, curve.ScalarField())
+		if err != nil {
+			return krb.PAData{}, fmt.Errorf("new witness: %w", err)
+		}
+		proof, err := groth16.Prove(cs, pk, fullWit)
+		if err != nil {
+			return krb.PAData{}, fmt.Errorf("prove: %w", err)
+		}
+		buf := new(bytes.Buffer)
+		if _, err := proof.WriteTo(buf); err != nil {
+			return krb.PAData{}, fmt.Errorf("proof.WriteTo: %w", err)
+		}
+		log.Printf("✅ Proved %d claims for the KDC's challenge.", len(claims))
+		return krb.NewPAZKAttr(krb.PAZKAttrReq{CircuitID: attrCircuitID, Claims: claims, Proof: curves.Tag(curve, buf.Bytes())})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/manifest"
+)
+
+// defaultCacheDir is zk-kerb under the user's cache directory, or no
+// cache if there is none.
+func defaultCacheDir() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "zk-kerb")
+}
+
+// readCached returns the file cached under hash, if its contents still
+// hash to it.
+func readCached(hash, ext string) ([]byte, bool) {
+	if *cacheDir == "" {
+		return nil, false
+	}
+	b, err := os.ReadFile(filepath.Join(*cacheDir, hash+"."+ext))
+	if err != nil || manifest.Hash(b) != hash {
+		return nil, false
+	}
+	return b, true
+}
+
+// writeCached caches b under its hash. A cache we can't write to only
+// costs time, so failures are logged and otherwise ignored.
+func writeCached(ext string, b []byte) {
+	if *cacheDir == "" {
+		return
+	}
+	if err := os.MkdirAll(*cacheDir, 0o700); err != nil {
+		log.Printf("cache: %v", err)
+		return
+	}
+	tmp, err := os.CreateTemp(*cacheDir, ".tmp-*")
+	if err != nil {
+		log.Printf("cache: %v", err)
+		return
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), filepath.Join(*cacheDir, manifest.Hash(b)+"."+ext))
+	}
+	if err != nil {
+		log.Printf("cache: %v", err)
+	}
+}
+
+// loadConstraintSystem returns the compiled circuit m names: from the
+// cache, else downloaded from the KDC, else compiled here from circuit
+// over curve.
+func loadConstraintSystem(m *manifest.Manifest, curve ecc.ID, circuit frontend.Circuit) constraint.ConstraintSystem {
+	raw, ok := readCached(m.CircuitHash, "cs")
+	if !ok {
+		var err error
+		if raw, err = fetchConstraintSystem(m); err != nil {
+			log.Printf("fetching compiled circuit: %v; compiling it here", err)
+			if raw, err = compileCircuit(curve, circuit); err != nil {
+				log.Fatalf("compile circuit: %v", err)
+			}
+		}
+		// the KDC's manifest vouches for the circuit, whoever compiled it
+		if err := m.CheckCircuit(raw); err != nil {
+			log.Fatal(err)
+		}
+		writeCached("cs", raw)
+	}
+	body, err := curves.UntagFor(curve, raw)
+	if err != nil {
+		log.Fatalf("compiled circuit: %v", err)
+	}
+	cs := groth16.NewCS(curve)
+	if _, err := cs.ReadFrom(bytes.NewReader(body)); err != nil {
+		log.Fatalf("unmarshal circuit: %v", err)
+	}
+	return cs
+}
+
+func fetchConstraintSystem(m *manifest.Manifest) ([]byte, error) {
+	got, err := api.CircuitConstraintSystem(context.Background(), m.CircuitID)
+	if err != nil {
+		return nil, err
+	}
+	return got.Key, nil
+}
+
+// compileCircuit compiles circuit (same code as server) over curve and
+// serializes it, tagged with curve as the KDC serves it.
+func compileCircuit(curve ecc.ID, circuit frontend.Circuit) ([]byte, error) {
+	cs, err := frontend.Compile(curve.ScalarField(), r1cs.NewBuilder, circuit)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	if _, err := cs.WriteTo(&buf); err != nil {
+		return nil, fmt.Errorf("serialize circuit: %w", err)
+	}
+	return curves.Tag(curve, buf.Bytes()), nil
+}
+
+// loadPK returns the proving key m names, a key over curve, from the
+// cache or else from the KDC.
+func loadPK(m *manifest.Manifest, curve ecc.ID) groth16.ProvingKey {
+	raw, ok := readCached(m.PKHash, "pk")
+	if !ok {
+		got, err := api.CircuitProvingKey(context.Background(), m.CircuitID)
+		if err != nil {
+			log.Fatalf("fetch proving key: %v", err)
+		}
+		raw = got.Key
+		// only use the key the KDC signed for
+		if err := m.CheckPK(raw); err != nil {
+			log.Fatal(err)
+		}
+		writeCached("pk", raw)
+	}
+	body, err := curves.UntagFor(curve, raw)
+	if err != nil {
+		log.Fatalf("proving key: %v", err)
+	}
+	pk := groth16.NewProvingKey(curve)
+	if _, err := pk.ReadFrom(bytes.NewReader(body)); err != nil {
+		log.Fatalf("unmarshal PK: %v", err)
+	}
+	return pk
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"math/big"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash/mimc"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/commitment"
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/merkle"
+)
+
+// groupCircuitID names the group membership circuit (must match KDC)
+const groupCircuitID = "mimc-group-v2"
+
+// groupDepth is the depth of group Merkle trees (must match KDC)
+const groupDepth = 10
+
+// GroupCircuit must match the server’s
+type GroupCircuit struct {
+	PW    frontend.Variable             `gnark:"pw"`
+	Salt  frontend.Variable             `gnark:"salt"`
+	Path  [groupDepth]frontend.Variable `gnark:"path"`
+	Index frontend.Variable             `gnark:"index"`
+
+	Root      frontend.Variable `gnark:",public"`
+	Nullifier frontend.Variable `gnark:",public"`
+	Challenge frontend.Variable `gnark:",public"`
+}
+
+func (c *GroupCircuit) Define(api frontend.API) error {
+	// our leaf is MiMC(Salt, PW); hash it up to Root along Path
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.Salt, c.PW)
+	node := h.Sum()
+
+	bits := api.ToBinary(c.Index, groupDepth)
+	for i := range groupDepth {
+		left := api.Select(bits[i], c.Path[i], node)
+		right := api.Select(bits[i], node, c.Path[i])
+		h.Reset()
+		h.Write(left, right)
+		node = h.Sum()
+	}
+	api.AssertIsEqual(node, c.Root)
+
+	// Nullifier = MiMC(nk, Challenge), nk = MiMC(NullifierTag, PW, Salt)
+	h.Reset()
+	h.Write(commitment.NullifierTag, c.PW, c.Salt)
+	nk := h.Sum()
+	h.Reset()
+	h.Write(nk, c.Challenge)
+	api.AssertIsEqual(h.Sum(), c.Nullifier)
+	return nil
+}
+
+// GroupAuth loads the group circuit and proving key and returns a prover
+// that answers the KDC's challenges as some member of group, namely the
+// one whose commitment is over salt and password.
+func GroupAuth(group string, salt []byte, password string) krb.GroupProver {
+	cs, pk := loadProvingKey(groupCircuitID, &GroupCircuit{})
+	curve := pk.CurveID()
+	pw := commitment.Password(curve, salt, password)
+
+	return func(ch *krb.PAZKChallenge, binding []byte) ([]byte, []byte, error) {
+		if ch.CircuitID != groupCircuitID {
+			return nil, nil, fmt.Errorf("KDC wants circuit %q, we have %q", ch.CircuitID, groupCircuitID)
+		}
+
+		// find our leaf among the group's
+		g, err := api.Group(context.Background(), group)
+		if err != nil {
+			return nil, nil, err
+		}
+		if g.Depth != groupDepth {
+			return nil, nil, fmt.Errorf("group tree has depth %d, we have %d", g.Depth, groupDepth)
+		}
+		ours, err := commitment.CommitStretched(curve, salt, pw)
+		if err != nil {
+			return nil, nil, err
+		}
+		index := -1
+		leaves := make([][]byte, len(g.Members))
+		for i, m := range g.Members {
+			leaves[i] = m.Commitment
+			if index < 0 && bytes.Equal(m.Commitment, ours) {
+				index = i
+			}
+		}
+		if index < 0 {
+			return nil, nil, fmt.Errorf("not a member of %s (or wrong password)", group)
+		}
+		tree, err := merkle.New(curve, groupDepth, leaves)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !bytes.Equal(tree.Root(), g.Root) {
+			return nil, nil, fmt.Errorf("published root of %s does not match its members", group)
+		}
+		path, err := tree.Path(index)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		challenge := new(big.Int).Mod(new(big.Int).SetBytes(binding), curve.ScalarField())
+		nullifier, err := commitment.Nullifier(curve, salt, pw, challenge)
+		if err != nil {
+			return nil, nil, err
+		}
+		assignment := GroupCircuit{
+			PW:        pw,
+			Salt:      new(big.Int).SetBytes(salt),
+			Index:     index,
+			Root:      new(big.Int).SetBytes(g.Root),
+			Nullifier: new(big.Int).SetBytes(nullifier),
+			Challenge: challenge,
+		}
+		for i, sib := range path {
+			assignment.Path[i] = new(big.Int).SetBytes(sib)
+		}
+		fullWit, err := frontend.NewWitness(&assignment, curve.ScalarField())
+		if err != nil {
+			return nil, nil, fmt.Errorf("new witness: %w", err)
+		}
+		proof, err := groth16.Prove(cs, pk, fullWit)
+		if err != nil {
+			return nil, nil, fmt.Errorf("prove: %w", err)
+		}
+		buf := new(bytes.Buffer)
+		if _, err := proof.WriteTo(buf); err != nil {
+			return nil, nil, fmt.Errorf("proof.WriteTo: %w", err)
+		}
+		log.Printf("✅ Proved membership of %s for the KDC's challenge.", group)
+		return curves.Tag(curve, buf.Bytes()), nullifier, nil
+	}
+}
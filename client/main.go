@@ -3,15 +3,10 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"crypto/aes"
-	"crypto/cipher"
-	crypto_rand "crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/gob"
+	"context"
 	"encoding/json"
+	"flag"
 	"fmt"
-	"io"
 	"log"
 	"math/big"
 	"net"
@@ -22,69 +17,167 @@ import (
 
 	"github.com/consensys/gnark-crypto/ecc"
 	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/hash/mimc"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/attrs"
+	"github.com/evanhong7384/ZK-Kerb/kdc/commitment"
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/manifest"
+	"github.com/evanhong7384/ZK-Kerb/kdc/session"
+	"github.com/evanhong7384/ZK-Kerb/kdc/tlsutil"
 )
 
 // Circuit must match the server’s
 type Circuit struct {
-	X frontend.Variable `gnark:"x"`
-	Y frontend.Variable `gnark:",public"`
+	PW         frontend.Variable `gnark:"pw"`
+	Salt       frontend.Variable `gnark:",public"`
+	Commitment frontend.Variable `gnark:",public"`
+	Challenge  frontend.Variable `gnark:",public"` // binds the proof to a KDC challenge
 }
 
 func (c *Circuit) Define(api frontend.API) error {
-	// x^4 - 10246*x^3 + 36745188*x^2 - 53772937114*x + 26415943377211 == 0
-    x2 := api.Mul(c.X, c.X)      
-    x3 := api.Mul(x2, c.X)       
-    x4 := api.Mul(x3, c.X)       
-
-    neg10246, _    := new(big.Int).SetString("-10246", 10)
-    pos36745188, _ := new(big.Int).SetString("36745188", 10)
-    neg53772937114, _ := new(big.Int).SetString("-53772937114", 10)
-    pos26415943377211, _ := new(big.Int).SetString("26415943377211", 10)
-
-    t3 := api.Mul(x3, neg10246)           
-    t2 := api.Mul(x2, pos36745188)        
-    t1 := api.Mul(c.X, neg53772937114)    
-    c0 := pos26415943377211               
-
-    acc := api.Add(x4, t3)
-    acc = api.Add(acc, t2)
-    acc = api.Add(acc, t1)
-    acc = api.Add(acc, c0)
-
-    api.AssertIsEqual(acc, 0)
-    return nil
+	// MiMC(Salt, PW) == Commitment
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.Salt, c.PW)
+	api.AssertIsEqual(h.Sum(), c.Commitment)
+
+	// Groth16 only binds public inputs that appear in a constraint
+	api.Mul(c.Challenge, c.Challenge)
+	return nil
 }
 
-// Same p and g (must match KDC)
+// circuitID names the circuit we prove against (must match KDC)
+const circuitID = "mimc-pw-v1"
+
 var (
-	pHex = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
-		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
-		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
-		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
-		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
-		"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
-		"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
-		"670C354E4ABC9804F1746C08CA237327FFFFFFFFFFFFFFFF"
-	g = big.NewInt(2)
+	user      = flag.String("user", "user", "client principal name")
+	service   = flag.String("service", "serv", "service principal to get a ticket for")
+	kdcAddr   = flag.String("kdc", ":8080", "KDC address")
+	kdcUDP    = flag.Bool("udp", false, "reach the KDC over UDP, falling back to TCP for big replies")
+	kdcProxy  = flag.String("kdc-proxy", "", "URL of a KDC proxy to use instead of -kdc, e.g. https://localhost:8081/KdcProxy")
+	kdcHTTP   = flag.String("kdc-http", "https://localhost:8081", "base URL of the KDC's HTTPS endpoints")
+	kdcSigner = flag.String("manifest-key", "kdc-manifest.key.pub", "the KDC's pinned manifest signing key")
+	servAddr  = flag.String("serv", ":8090", "service address")
+	modeFlag  = flag.String("mode", "priv", "session protection: priv or safe")
+	group     = flag.String("group", "", "log in anonymously as some member of this group instead of as -user")
+	saltHex   = flag.String("salt", "", "hex salt of -user's commitment, for -group (default: the one kept in -cache)")
+	credPath  = flag.String("credential", "", "attribute credential from the KDC admin, for -claims")
+	claimList = flag.String("claims", "", "claims to prove about -credential, e.g. \"role=admin,clearance>=3\"")
+	precomp   = flag.Bool("precompute", false, "once logged in, prove for the next login in the background, so it needs no proving")
+	cacheDir  = flag.String("cache", defaultCacheDir(), "directory caching compiled circuits and proving keys (empty to disable)")
 )
 
-type Ticket struct {
-	SessionKey int
-	// username string
-	// address string
-	ServiceName string
-	// lifespan int
-	// timestamp int
-}
+// httpClient talks to the KDC's HTTPS endpoints, verifying the KDC
+// against -ca or -pin.
+var httpClient *http.Client
+
+// api is the client of the KDC's /v1 API.
+var api *kdcapi.Client
 
 func main() {
+	var tlsOpts tlsutil.ClientOptions
+	flag.StringVar(&tlsOpts.CAFile, "ca", "kdc.crt", "CA (or self-signed KDC certificate) to verify the KDC's HTTPS endpoints against")
+	flag.StringVar(&tlsOpts.Pin, "pin", "", "hex SHA-256 fingerprint of the KDC's certificate; overrides -ca")
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "", "client certificate for the KDC's HTTPS endpoints")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "", "client certificate key")
+	password := flag.String("password", "", "password (default: $ZK_KERB_PASSWORD, else prompt)")
+	commit := flag.Bool("commit", false, "print a principals.json holding -user with -password over -curve, then exit")
+	changePW := flag.Bool("change-password", false, "change -user's password from -password to -new-password, then exit")
+	newPassword := flag.String("new-password", "", "new password for -change-password (default: $ZK_KERB_NEW_PASSWORD, else prompt)")
+	revoke := flag.Bool("revoke-tickets", false, "with -change-password, also revoke TGTs issued so far")
+	enrollToken := flag.String("enroll", "", "enroll -user with this token from the KDC admin, setting -password, then exit")
+	curveName := flag.String("curve", "bn254", "curve of the KDC's circuits, for -commit (otherwise the KDC is asked)")
+
+	flag.Parse()
+
+	if *password == "" {
+		*password = readPassword()
+	}
+	if *commit {
+		curve, err := curves.Parse(*curveName)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printCommitment(curve, *user, *password)
+		return
+	}
+
+	if tlsOpts.Pin != "" {
+		tlsOpts.CAFile = ""
+	}
+	tlsConfig, err := tlsutil.ClientConfig(tlsOpts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	httpClient = &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	}
+	api = kdcapi.New(*kdcHTTP, httpClient)
+
+	if *enrollToken != "" {
+		enroll(*user, *enrollToken, *password)
+		return
+	}
+	if *changePW {
+		if *newPassword == "" {
+			*newPassword = readNewPassword()
+		}
+		cred := startClient(func(kdc *krb.KDCConn) (*krb.Credential, error) {
+			return kdc.ASZK(*user, krb.TGS, ZKAuth(*password))
+		})
+		changePassword(*user, *password, *newPassword, *revoke, cred)
+		return
+	}
+
 	// Request user input for message to send
 	// reader := bufio.NewReader(os.Stdin)
 
-	ZKAuth()
-
+	// AS exchange for a ticket to the service; the ZK proof answers the
+	// KDC's challenge (PA-ZK) and the reply key comes from the DH exchange.
+	// A login prepared by -precompute goes first.
+	login := func(kdc *krb.KDCConn) (*krb.Credential, error) {
+		if p, ok := takePrepared(*user); ok {
+			cred, err := kdc.ASZKPrepared(*user, *service, p)
+			if err == nil {
+				fmt.Println("✅ Logged in with a proof prepared ahead of time.")
+				return cred, nil
+			}
+			fmt.Printf("Prepared proof not accepted (%v); proving now\n", err)
+		}
+		return kdc.ASZK(*user, *service, ZKAuth(*password))
+	}
+	if *claimList != "" {
+		claims, err := attrs.ParseClaims(*claimList)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *credPath == "" {
+			log.Fatal("-claims needs -credential")
+		}
+		prove, proveClaims := ZKAuth(*password), ClaimAuth(*user, *credPath, claims)
+		login = func(kdc *krb.KDCConn) (*krb.Credential, error) {
+			return kdc.ASZKClaims(*user, *service, prove, proveClaims)
+		}
+	}
+	if *group != "" {
+		// our salt comes from this machine: asking the KDC for it as -user
+		// would give us away
+		salt, err := loadSalt(*user)
+		if err != nil {
+			log.Fatal(err)
+		}
+		login = func(kdc *krb.KDCConn) (*krb.Credential, error) {
+			return kdc.ASZKAnonymous(*group, *service, GroupAuth(*group, salt, *password))
+		}
+	}
 
 	// for {
 	// 	fmt.Printf("Send message to KDC: ")
@@ -98,65 +191,99 @@ func main() {
 	// 	msg = msg[:len(msg)-1]
 	// }
 
-	startClient()
+	if *precomp && (*claimList != "" || *group != "" || *cacheDir == "") {
+		log.Fatal("-precompute prepares password logins only, and needs -cache")
+	}
+
+	cred := startClient(login)
+	prepared := make(chan error, 1)
+	if *precomp {
+		go func() { prepared <- prepareLogin(*user, *password, cred) }()
+	}
+	connectService(cred)
+	if *precomp {
+		if err := <-prepared; err != nil {
+			log.Printf("preparing the next login: %v", err)
+		}
+	}
 }
 
-func startClient() {
+func startClient(login func(*krb.KDCConn) (*krb.Credential, error)) *krb.Credential {
 	// Client (connecting to the server)
-	conn, err := net.Dial("tcp", ":8080")
-	defer conn.Close()
+	var kdc *krb.KDCConn
+	var err error
+	switch {
+	case *kdcProxy != "":
+		kdc, err = krb.DialKDCProxy(*kdcProxy, httpClient)
+	case *kdcUDP:
+		kdc, err = krb.DialKDCUDP(*kdcAddr)
+	default:
+		kdc, err = krb.DialKDC(*kdcAddr)
+	}
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	defer kdc.Close()
 
-	// key exchange
-	p, _ := new(big.Int).SetString(pHex, 16)
-	userPriv, _ := crypto_rand.Int(crypto_rand.Reader, p)
-	userPub := new(big.Int).Exp(g, userPriv, p)
-
-	encoder := gob.NewEncoder(conn)
-	err = encoder.Encode(userPub)
+	cred, err := login(kdc)
 	if err != nil {
-		fmt.Println("Error sending user public key:", err)
+		fmt.Println("KDC refused ticket:", err)
 		os.Exit(1)
 	}
 
-	// Receive KDC public key
-	var kdcPub big.Int
-	decoder := gob.NewDecoder(conn)
-	err = decoder.Decode(&kdcPub)
+	fmt.Printf("Got ticket for %s, valid until %s\n", cred.Server, cred.EndTime.Format(time.RFC3339))
+	return cred
+}
+
+// apReq authenticates us to the KDC's API with cred, a ticket it issued.
+func apReq(cred *krb.Credential) ([]byte, error) {
+	req, _, err := krb.NewAPReq(cred, false)
 	if err != nil {
-		fmt.Println("Error receiving KDC public key:", err)
-		os.Exit(1)
+		return nil, err
 	}
+	return krb.Marshal(&krb.Message{APReq: req})
+}
 
-	sharedSecret := new(big.Int).Exp(&kdcPub, userPriv, p)
-	mock_password := sha256.Sum256(sharedSecret.Bytes())
-	fmt.Printf("Derived session key: %x\n", mock_password)
-
-	// Receive Ticket Granting Ticket (TGT)
-	var encryptedTGT []byte 
-	err = decoder.Decode(&encryptedTGT)
+// connectService authenticates to the service with cred and requires it to
+// prove its own identity in return.
+func connectService(cred *krb.Credential) {
+	conn, err := net.DialTimeout("tcp", *servAddr, 5*time.Second)
 	if err != nil {
-		fmt.Println("Error receiving Ticket Granting Ticket:", err)
+		fmt.Println("Error connecting to service:", err)
 		os.Exit(1)
 	}
+	defer conn.Close()
 
-	var tgt_aes_key = []byte("fe86ed5edd0cfbefc32f904747c30bb20de64010b6c62a97a70e2e021abdbee0")
-
-	// Decrypt ticket (for testing)
-	ticket, err := decryptTicket(encryptedTGT, tgt_aes_key)
-    if err != nil {
-        fmt.Println("Error decrypting ticket:", err)
-        os.Exit(1)
-    }
+	ctx, err := krb.ClientHandshake(conn, cred)
+	if err != nil {
+		fmt.Println("Service authentication failed:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("✅ Mutually authenticated with %s\n", cred.Server)
 
-	// Print the decrypted ticket
-	fmt.Printf("Decrypted Ticket: SessionKey=%d, ServiceName=%s\n", ticket.SessionKey, ticket.ServiceName)
+	mode, err := session.ParseMode(*modeFlag)
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	sc, err := session.Client(conn, ctx, mode)
+	if err != nil {
+		fmt.Println("Error starting session:", err)
+		os.Exit(1)
+	}
+	if _, err := fmt.Fprintf(sc, "hello from %s\n", cred.Client); err != nil {
+		fmt.Println("Error writing to session:", err)
+		os.Exit(1)
+	}
+	reply, err := bufio.NewReader(sc).ReadString('\n')
+	if err != nil {
+		fmt.Println("Error reading from session:", err)
+		os.Exit(1)
+	}
+	fmt.Printf("%s replied: %s", cred.Server, reply)
 }
 
-
 func authenticateWithKDC(plaintext string) (bool, error) {
 	// contacts kdc
 	conn, err := net.DialTimeout("tcp", "localhost:8080", 5*time.Second)
@@ -185,105 +312,245 @@ func authenticateWithKDC(plaintext string) (bool, error) {
 	return false, nil
 }
 
-func ZKAuth() {
-	// 1) compile the circuit (same code as server)
-	var circuit Circuit
-	cs, err := frontend.Compile(
-		ecc.BN254.ScalarField(),
-		r1cs.NewBuilder,
-		&circuit,
-	)
-	if err != nil {
-		log.Fatalf("compile circuit: %v", err)
+// ZKAuth loads the circuit and proving key and returns a prover that
+// answers the KDC's PA-ZK challenges with knowledge of password.
+func ZKAuth(password string) krb.Prover {
+	cs, pk := loadProvingKey(circuitID, &Circuit{})
+	prove := passwordProver(cs, pk, password)
+
+	return func(ch *krb.PAZKChallenge, binding []byte) ([]byte, error) {
+		proof, err := prove(ch, binding)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Println("✅ Proof generated for the KDC's challenge.")
+		// for later group logins, which mustn't ask for it
+		saveSalt(*user, ch.Salt)
+		return proof, nil
+	}
+}
+
+// passwordProver is ZKAuth's prover over the compiled circuit cs and its
+// proving key pk.
+func passwordProver(cs constraint.ConstraintSystem, pk groth16.ProvingKey, password string) krb.Prover {
+	curve := pk.CurveID()
+
+	return func(ch *krb.PAZKChallenge, binding []byte) ([]byte, error) {
+		if ch.CircuitID != circuitID {
+			return nil, fmt.Errorf("KDC wants circuit %q, we have %q", ch.CircuitID, circuitID)
+		}
+
+		// 4) build a witness: the salt comes with the challenge, and we
+		// recompute the commitment from our stretched password
+		pw := commitment.Password(curve, ch.Salt, password)
+		commit, err := commitment.CommitStretched(curve, ch.Salt, pw)
+		if err != nil {
+			return nil, fmt.Errorf("commitment: %w", err)
+		}
+		challenge := new(big.Int).Mod(new(big.Int).SetBytes(binding), curve.ScalarField())
+		assignment := Circuit{
+			PW:         pw,
+			Salt:       new(big.Int).SetBytes(ch.Salt),
+			Commitment: new(big.Int).SetBytes(commit),
+			Challenge:  challenge,
+		}
+		fullWit, err := frontend.NewWitness(&assignment, curve.ScalarField())
+		if err != nil {
+			return nil, fmt.Errorf("new witness: %w", err)
+		}
+
+		// 5) generate proof
+		proof, err := groth16.Prove(cs, pk, fullWit)
+		if err != nil {
+			return nil, fmt.Errorf("prove: %w", err)
+		}
+
+		// ─── serialize proof ──────────────────────────────────────────
+		// use WriteTo to dump the proof into a bytes.Buffer, behind a
+		// tag naming its curve
+		buf := new(bytes.Buffer)
+		if _, err := proof.WriteTo(buf); err != nil {
+			return nil, fmt.Errorf("proof.WriteTo: %w", err)
+		}
+		return curves.Tag(curve, buf.Bytes()), nil
 	}
+}
 
-	// ─────── STEP 2: FETCH PK FROM SERVER ───────
-	resp, err := http.Get("http://localhost:8081/pk")
+// loadProvingKey returns the compiled circuit id and the KDC's proving
+// key for it, accepting only those named in the KDC's signed manifest,
+// over whichever curve it names. Both are cached between runs; circuit is
+// compiled only if neither the cache nor the KDC has it compiled.
+func loadProvingKey(id string, circuit frontend.Circuit) (constraint.ConstraintSystem, groth16.ProvingKey) {
+	m, err := fetchManifest(id)
 	if err != nil {
-		log.Fatalf("GET /pk error: %v", err)
+		log.Fatalf("manifest: %v", err)
 	}
-	defer resp.Body.Close()
-	var got struct {
-		PK string `json:"pk"`
+	if m.CircuitID != id || m.Backend != "groth16" {
+		log.Fatalf("manifest is for %s/%s, we have %s/groth16", m.CircuitID, m.Backend, id)
 	}
-	if err := json.NewDecoder(resp.Body).Decode(&got); err != nil {
-		log.Fatalf("decode /pk response: %v", err)
+	curve, err := curves.Parse(m.Curve)
+	if err != nil {
+		log.Fatalf("manifest: %v", err)
 	}
-	// Base64 → raw bytes
-	rawPK, err := base64.StdEncoding.DecodeString(got.PK)
+	return loadConstraintSystem(m, curve, circuit), loadPK(m, curve)
+}
+
+// kdcCurve asks the KDC which curve its circuits are over, which the
+// commitments we send it must be made on.
+func kdcCurve() ecc.ID {
+	c, err := api.Circuit(context.Background())
 	if err != nil {
-		log.Fatalf("invalid base64 PK: %v", err)
+		log.Fatalf("circuit: %v", err)
 	}
-	// fill a new ProvingKey
-	pk := groth16.NewProvingKey(ecc.BN254)
-	if _, err := pk.ReadFrom(bytes.NewReader(rawPK)); err != nil {
-		log.Fatalf("unmarshal PK: %v", err)
+	curve, err := curves.Parse(c.Curve)
+	if err != nil {
+		log.Fatalf("circuit: %v", err)
 	}
+	return curve
+}
 
-	// 3) build a witness for x=2053 etc. 
-	x := 4093 //2053, 3079, 4093, 1021
-	y := x*x*x*x - 10246*x*x*x + 36745188*x*x - 53772937114*x + 26415943377211
-	assignment := Circuit{X: x, Y: y}
-	fullWit, err := frontend.NewWitness(&assignment, ecc.BN254.ScalarField())
+// fetchManifest downloads the KDC's key manifest for circuit id and checks
+// it against the pinned signing key.
+func fetchManifest(id string) (*manifest.Manifest, error) {
+	key, err := manifest.LoadPublicKey(*kdcSigner)
 	if err != nil {
-		log.Fatalf("new witness: %v", err)
+		return nil, err
 	}
-
-	// 4) generate proof
-	proof, err := groth16.Prove(cs, pk, fullWit)
+	signed, err := api.CircuitManifest(context.Background(), id)
 	if err != nil {
-		log.Fatalf("prove: %v", err)
+		return nil, err
 	}
+	return signed.Verify(key, time.Now())
+}
 
-	// ─── serialize proof ──────────────────────────────────────────
-	// use WriteTo to dump the proof into a bytes.Buffer
-	buf := new(bytes.Buffer)
-	if _, err := proof.WriteTo(buf); err != nil {
-		log.Fatalf("proof.WriteTo: %v", err)
+// readPassword takes the password from $ZK_KERB_PASSWORD or, failing
+// that, a line on stdin.
+func readPassword() string {
+	if pw := os.Getenv("ZK_KERB_PASSWORD"); pw != "" {
+		return pw
 	}
-	proofBytes := buf.Bytes()
-
-	// 2) Base64-encode for JSON transport
-	proofB64 := base64.StdEncoding.EncodeToString(proofBytes)
+	fmt.Printf("Password for %s: ", *user)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("reading password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
 
-	// 5) send proof + public Y to server
-	payload := map[string]interface{}{
-		"proof": proofB64,
+// printCommitment prints a principal database holding just user, salted
+// fresh, in the shape the KDC reads: the curve, then the principals by
+// name. The password itself never leaves this machine.
+func printCommitment(curve ecc.ID, user, password string) {
+	salt, err := commitment.NewSalt()
+	if err != nil {
+		log.Fatal(err)
+	}
+	commit, err := commitment.Commit(curve, salt, password)
+	if err != nil {
+		log.Fatal(err)
 	}
-	b, _ := json.Marshal(payload)
-	resp2, err := http.Post("http://localhost:8081/prove", "application/json", bytes.NewReader(b))
+	entry, err := json.MarshalIndent(map[string]any{
+		"curve": curve.String(),
+		"principals": map[string]any{
+			user: map[string]any{"salt": salt, "commitment": commit, "kvno": 1},
+		},
+	}, "", "  ")
 	if err != nil {
-		log.Fatalf("POST error: %v", err)
+		log.Fatal(err)
 	}
-	defer resp2.Body.Close()
-	respBody, _ := io.ReadAll(resp2.Body)
-	fmt.Println("✅ Authenticated — now starting client session.")
-	fmt.Printf("Server responded [%d]: %s\n", resp2.StatusCode, string(respBody))
+	fmt.Println(string(entry))
 }
 
+// enroll sets the password of a principal an admin created, sending the
+// KDC only its salted commitment.
+func enroll(user, token, password string) {
+	salt, err := commitment.NewSalt()
+	if err != nil {
+		log.Fatal(err)
+	}
+	commit, err := commitment.Commit(kdcCurve(), salt, password)
+	if err != nil {
+		log.Fatal(err)
+	}
+	res, err := api.Enroll(context.Background(), kdcapi.EnrollRequest{
+		Principal:  user,
+		Token:      token,
+		Salt:       salt,
+		Commitment: commit,
+	})
+	if err != nil {
+		log.Fatalf("enrolling %s: %v", user, err)
+	}
+	saveSalt(user, salt)
+	fmt.Printf("✅ Enrolled %s (circuit %s)\n", res.Principal, res.CircuitID)
+}
 
-// Decrypt the ticket using AES
-func decryptTicket(encryptedTicket []byte, key []byte) (*Ticket, error) {
-    block, err := aes.NewCipher(key)
-    if err != nil {
-        return nil, fmt.Errorf("failed to create cipher: %w", err)
-    }
-
-    if len(encryptedTicket) < aes.BlockSize {
-        return nil, fmt.Errorf("ciphertext too short")
-    }
-
-    iv := encryptedTicket[:aes.BlockSize]
-    ciphertext := encryptedTicket[aes.BlockSize:]
+// readNewPassword takes the new password from $ZK_KERB_NEW_PASSWORD or,
+// failing that, a line on stdin.
+func readNewPassword() string {
+	if pw := os.Getenv("ZK_KERB_NEW_PASSWORD"); pw != "" {
+		return pw
+	}
+	fmt.Printf("New password for %s: ", *user)
+	line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil && line == "" {
+		log.Fatalf("reading password: %v", err)
+	}
+	return strings.TrimRight(line, "\r\n")
+}
 
-    stream := cipher.NewCFBDecrypter(block, iv)
-    stream.XORKeyStream(ciphertext, ciphertext)
+// changePassword proves we know user's current password, over a KDC
+// challenge bound to the new commitment, and has the KDC switch to it.
+// The challenge is asked for with cred, a ticket from logging in.
+func changePassword(user, oldPassword, newPassword string, revoke bool, cred *krb.Credential) {
+	ctx := context.Background()
+	auth, err := apReq(cred)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ch, err := api.Challenge(ctx, user, auth)
+	if err != nil {
+		log.Fatalf("challenge: %v", err)
+	}
+	salt, err := commitment.NewSalt()
+	if err != nil {
+		log.Fatal(err)
+	}
+	commit, err := commitment.Commit(kdcCurve(), salt, newPassword)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-    var ticket Ticket
-    err = gob.NewDecoder(bytes.NewReader(ciphertext)).Decode(&ticket)
-    if err != nil {
-        return nil, fmt.Errorf("failed to decode ticket: %w", err)
-    }
+	prove := ZKAuth(oldPassword)
+	proof, err := prove(&krb.PAZKChallenge{
+		CircuitID: ch.CircuitID,
+		Challenge: ch.Challenge,
+		Expires:   ch.Expires,
+		Salt:      ch.Salt,
+	}, kdcapi.PasswordChangeBinding(ch.Challenge, salt, commit))
+	if err != nil {
+		log.Fatalf("proving: %v", err)
+	}
 
-    return &ticket, nil
-}
\ No newline at end of file
+	res, err := api.ChangePassword(ctx, kdcapi.PasswordChangeRequest{
+		Principal:     user,
+		Challenge:     ch.Challenge,
+		KVNO:          ch.KVNO,
+		Proof:         proof,
+		NewSalt:       salt,
+		NewCommitment: commit,
+		RevokeTickets: revoke,
+	})
+	if err != nil {
+		log.Fatalf("changing password: %v", err)
+	}
+	saveSalt(user, salt)
+	fmt.Printf("✅ Password of %s changed, kvno %d\n", res.Principal, res.KVNO)
+	// a login prepared with the old password would only count as a failure
+	if *cacheDir != "" {
+		os.Remove(preparedPath(user))
+	}
+	if res.TicketsRevoked {
+		fmt.Println("Existing TGTs were revoked; log in again.")
+	}
+}
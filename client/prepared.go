@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// preparedMargin is how long before its challenge expires we stop
+// trusting a prepared proof to get to the KDC in time.
+const preparedMargin = 30 * time.Second
+
+// preparedPath is where user's prepared login is kept.
+func preparedPath(user string) string {
+	return filepath.Join(*cacheDir, user+".prepared")
+}
+
+// takePrepared returns user's prepared login, if there is one that is
+// still good. It is removed either way: its challenge is good once.
+func takePrepared(user string) (*krb.PreparedZK, bool) {
+	if *cacheDir == "" {
+		return nil, false
+	}
+	b, err := os.ReadFile(preparedPath(user))
+	if err != nil {
+		return nil, false
+	}
+	os.Remove(preparedPath(user))
+	var p krb.PreparedZK
+	if err := json.Unmarshal(b, &p); err != nil || time.Until(p.Expires) < preparedMargin {
+		return nil, false
+	}
+	return &p, true
+}
+
+// prepareLogin proves knowledge of password over a long-lived challenge
+// for user, asked for with cred from this login, and keeps the answer for
+// the next login.
+func prepareLogin(user, password string, cred *krb.Credential) error {
+	auth, err := apReq(cred)
+	if err != nil {
+		return err
+	}
+	ch, err := api.PrecomputeChallenge(context.Background(), user, auth)
+	if err != nil {
+		return err
+	}
+	p, err := krb.PrepareZK(&krb.PAZKChallenge{
+		CircuitID: ch.CircuitID,
+		Challenge: ch.Challenge,
+		Expires:   ch.Expires,
+		Salt:      ch.Salt,
+	}, ZKAuth(password))
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(*cacheDir, 0o700); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(*cacheDir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(b)
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), preparedPath(user)); err != nil {
+		return err
+	}
+	fmt.Printf("✅ Prepared the next login for %s (good until %s).\n", user, p.Expires.Format(time.RFC3339))
+	return nil
+}
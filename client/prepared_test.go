@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/logger"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/commitment"
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// BenchmarkLoginAnswer compares, over each curve, the work between
+// receiving the KDC's challenge and sending the answer: proving on the
+// spot, against sending a proof prepared ahead of time (-precompute),
+// which also saves the round trip for the challenge.
+func BenchmarkLoginAnswer(b *testing.B) {
+	logger.Disable()
+	for _, curve := range curves.Supported {
+		cs, err := frontend.Compile(curve.ScalarField(), r1cs.NewBuilder, &Circuit{})
+		if err != nil {
+			b.Fatal(err)
+		}
+		pk, _, err := groth16.Setup(cs)
+		if err != nil {
+			b.Fatal(err)
+		}
+		salt, err := commitment.NewSalt()
+		if err != nil {
+			b.Fatal(err)
+		}
+		ch := &krb.PAZKChallenge{CircuitID: circuitID, Challenge: make([]byte, 32), Expires: time.Now().Add(time.Hour), Salt: salt}
+		rand.Read(ch.Challenge)
+		prove := passwordProver(cs, pk, "correct horse")
+
+		b.Run("prove/"+curve.String(), func(b *testing.B) {
+			for b.Loop() {
+				p, err := krb.PrepareZK(ch, prove)
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, err := krb.NewPAZK(krb.PAZKReq{CircuitID: p.CircuitID, Challenge: p.Challenge, DHPublic: p.DHPublic, Proof: p.Proof}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("prepared/"+curve.String(), func(b *testing.B) {
+			p, err := krb.PrepareZK(ch, prove)
+			if err != nil {
+				b.Fatal(err)
+			}
+			stored, err := json.Marshal(p)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for b.Loop() {
+				var p krb.PreparedZK
+				if err := json.Unmarshal(stored, &p); err != nil {
+					b.Fatal(err)
+				}
+				if _, err := krb.NewPAZK(krb.PAZKReq{CircuitID: p.CircuitID, Challenge: p.Challenge, DHPublic: p.DHPublic, Proof: p.Proof}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/commitment"
+)
+
+// A group login proves knowledge of the password behind one of the group's
+// commitments, and needs its salt to. Group trees don't publish salts, and
+// asking the KDC for ours as the named principal right before logging in
+// anonymously would tell it who we are. So we keep the salt from when we
+// enrolled, changed password or last logged in by name.
+
+// saltPath is where user's salt is kept.
+func saltPath(user string) string {
+	return filepath.Join(*cacheDir, user+".salt")
+}
+
+// saveSalt keeps user's salt for group logins. Failing to is not fatal:
+// -salt still works.
+func saveSalt(user string, salt []byte) {
+	if *cacheDir == "" {
+		return
+	}
+	err := os.MkdirAll(*cacheDir, 0o700)
+	if err == nil {
+		err = os.WriteFile(saltPath(user), []byte(hex.EncodeToString(salt)+"\n"), 0o600)
+	}
+	if err != nil {
+		fmt.Printf("Not keeping the salt of %s for group logins: %v\n", user, err)
+	}
+}
+
+// loadSalt returns user's salt: -salt if given, else the one kept by
+// saveSalt. It never asks the KDC.
+func loadSalt(user string) ([]byte, error) {
+	s := *saltHex
+	if s == "" {
+		if *cacheDir == "" {
+			return nil, errors.New("no salt: pass -salt, or -cache to keep it")
+		}
+		b, err := os.ReadFile(saltPath(user))
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no salt kept for %s: log in once as %s, or pass -salt", user, user)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s = string(b)
+	}
+	salt, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(salt) != commitment.SaltSize {
+		return nil, fmt.Errorf("bad salt for %s: want %d bytes in hex", user, commitment.SaltSize)
+	}
+	return salt, nil
+}
@@ -0,0 +1,99 @@
+// Package commitment computes the salted password commitments that users
+// prove knowledge of: commitment = MiMC(salt, pw) over the scalar field of
+// the deployment's curve, where pw is the password stretched with argon2id
+// over the salt and mapped into the field. The KDC stores only the salt and
+// the commitment.
+package commitment
+
+import (
+	"crypto/rand"
+	"math/big"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"golang.org/x/crypto/argon2"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+)
+
+// SaltSize is the length of a salt in bytes. Salts are shorter than a
+// field element, so any salt is a canonical one.
+const SaltSize = 16
+
+// NewSalt returns a fresh random salt.
+func NewSalt() ([]byte, error) {
+	salt := make([]byte, SaltSize)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, err
+	}
+	return salt, nil
+}
+
+// The argon2id cost of stretching a password: RFC 9106's second
+// recommended setting. Anyone who sees a salt and a commitment can guess
+// passwords offline, and pays this per guess.
+const (
+	argonTime    = 3
+	argonMemory  = 64 << 10 // KiB
+	argonThreads = 4
+)
+
+// Password stretches a password with argon2id over salt and maps it into
+// the scalar field of curve. This is the circuit's secret input.
+func Password(curve ecc.ID, salt []byte, password string) *big.Int {
+	k := argon2.IDKey([]byte(password), salt, argonTime, argonMemory, argonThreads, 32)
+	return new(big.Int).Mod(new(big.Int).SetBytes(k), curve.ScalarField())
+}
+
+// Commit returns MiMC(salt, Password(salt, password)) over curve's scalar field
+// as a big-endian field element.
+func Commit(curve ecc.ID, salt []byte, password string) ([]byte, error) {
+	return CommitStretched(curve, salt, Password(curve, salt, password))
+}
+
+// CommitStretched is Commit for a password already stretched by Password,
+// for provers that need both and would rather not stretch it twice.
+func CommitStretched(curve ecc.ID, salt []byte, pw *big.Int) ([]byte, error) {
+	h := curves.MiMC(curve)
+	if _, err := h.Write(element(new(big.Int).SetBytes(salt))); err != nil {
+		return nil, err
+	}
+	if _, err := h.Write(element(pw)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// NullifierTag is the first block hashed into a nullifier key, setting it
+// apart from a commitment, which starts with the salt.
+var NullifierTag = new(big.Int).SetBytes([]byte("zk-kerb nullifier key"))
+
+// Nullifier returns MiMC(nk, challenge) for the nullifier key
+// nk = MiMC(NullifierTag, pw, salt), where pw is the password as stretched
+// by Password: a value that is the same every time one user answers one
+// challenge. MiMC's state after the salt and password is the commitment
+// itself, so a nullifier that carried on from there could be matched
+// against every published leaf; nk starts from the tag instead, and can't
+// be computed without the password. Anonymous logins publish the
+// nullifier in place of the user's identity.
+func Nullifier(curve ecc.ID, salt []byte, pw, challenge *big.Int) ([]byte, error) {
+	h := curves.MiMC(curve)
+	for _, x := range []*big.Int{NullifierTag, pw, new(big.Int).SetBytes(salt)} {
+		if _, err := h.Write(element(x)); err != nil {
+			return nil, err
+		}
+	}
+	nk := h.Sum(nil)
+	h.Reset()
+	if _, err := h.Write(nk); err != nil {
+		return nil, err
+	}
+	if _, err := h.Write(element(challenge)); err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// element encodes x as one 32-byte MiMC block.
+func element(x *big.Int) []byte {
+	return x.FillBytes(make([]byte, curves.ElementSize))
+}
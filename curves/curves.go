@@ -0,0 +1,121 @@
+// Package curves names the pairing-friendly curves ZK-Kerb runs its
+// circuits over, and tags serialized keys and proofs with theirs.
+//
+// BN254 is the default and the fastest, but gives only about 100 bits of
+// security; BLS12-381 gives about 128. A deployment picks one curve for
+// all its circuits, and the salted commitments and Merkle trees built for
+// them are elements of that curve's scalar field.
+package curves
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"hash"
+	"math/big"
+	"strings"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	tedwards "github.com/consensys/gnark-crypto/ecc/twistededwards"
+	gchash "github.com/consensys/gnark-crypto/hash"
+
+	// register MiMC for every supported curve
+	_ "github.com/consensys/gnark-crypto/ecc/bls12-377/fr/mimc"
+	_ "github.com/consensys/gnark-crypto/ecc/bls12-381/fr/mimc"
+	_ "github.com/consensys/gnark-crypto/ecc/bn254/fr/mimc"
+)
+
+// Supported lists the curves we run on, the default first.
+var Supported = []ecc.ID{ecc.BN254, ecc.BLS12_381, ecc.BLS12_377}
+
+// ElementSize is the size of a scalar field element of every supported
+// curve, in bytes.
+const ElementSize = 32
+
+var (
+	ErrUnsupported = errors.New("curves: unsupported curve")
+	ErrUntagged    = errors.New("curves: missing curve tag")
+)
+
+// Parse returns the curve called name: "bn254", "bls12-381" or
+// "bls12-377", with _ accepted for -.
+func Parse(name string) (ecc.ID, error) {
+	name = strings.ReplaceAll(strings.ToLower(name), "-", "_")
+	for _, id := range Supported {
+		if id.String() == name {
+			return id, nil
+		}
+	}
+	return ecc.UNKNOWN, fmt.Errorf("%w %q", ErrUnsupported, name)
+}
+
+// FromField returns the supported curve whose scalar field has modulus
+// q, as in a circuit's api.Compiler().Field().
+func FromField(q *big.Int) (ecc.ID, error) {
+	for _, id := range Supported {
+		if id.ScalarField().Cmp(q) == 0 {
+			return id, nil
+		}
+	}
+	return ecc.UNKNOWN, ErrUnsupported
+}
+
+// MiMC returns a MiMC hash over id's scalar field.
+func MiMC(id ecc.ID) hash.Hash {
+	switch id {
+	case ecc.BLS12_381:
+		return gchash.MIMC_BLS12_381.New()
+	case ecc.BLS12_377:
+		return gchash.MIMC_BLS12_377.New()
+	}
+	return gchash.MIMC_BN254.New()
+}
+
+// TwistedEdwards returns the twisted Edwards curve over id's scalar
+// field, which EdDSA signatures checked in id's circuits are made on.
+func TwistedEdwards(id ecc.ID) tedwards.ID {
+	switch id {
+	case ecc.BLS12_381:
+		return tedwards.BLS12_381
+	case ecc.BLS12_377:
+		return tedwards.BLS12_377
+	}
+	return tedwards.BN254
+}
+
+// tagMagic starts every tag; the curve's name follows, then a NUL.
+const tagMagic = "zkc1:"
+
+// Tag prefixes the serialized key or proof b with its curve.
+func Tag(id ecc.ID, b []byte) []byte {
+	return append([]byte(tagMagic+id.String()+"\x00"), b...)
+}
+
+// Untag splits a tagged key or proof into its curve and the key or proof.
+func Untag(b []byte) (ecc.ID, []byte, error) {
+	rest, ok := bytes.CutPrefix(b, []byte(tagMagic))
+	if !ok {
+		return ecc.UNKNOWN, nil, ErrUntagged
+	}
+	name, body, ok := bytes.Cut(rest, []byte{0})
+	if !ok {
+		return ecc.UNKNOWN, nil, ErrUntagged
+	}
+	id, err := Parse(string(name))
+	if err != nil {
+		return ecc.UNKNOWN, nil, err
+	}
+	return id, body, nil
+}
+
+// UntagFor is Untag, failing unless b is for curve want.
+func UntagFor(want ecc.ID, b []byte) ([]byte, error) {
+	id, body, err := Untag(b)
+	if err != nil {
+		return nil, err
+	}
+	if id != want {
+		return nil, fmt.Errorf("%w: tagged %s, want %s", ErrUnsupported, id, want)
+	}
+	return body, nil
+}
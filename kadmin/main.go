@@ -0,0 +1,152 @@
+// Command kadmin manages the KDC's principal database over its admin API.
+//
+//	kadmin add alice
+//
+// creates alice and prints the one-time token she enrolls with:
+//
+//	client -user alice -enroll <token>
+//
+// Her password is set on her machine; the KDC only ever sees its salted
+// commitment. If the token expires before she uses it, running kadmin add
+// again issues a new one.
+//
+//	kadmin cred alice role=admin clearance=3 > alice.cred
+//
+// has the KDC sign attributes for alice, which she can later prove claims
+// about without revealing them:
+//
+//	client -user alice -credential alice.cred -claims "clearance>=2"
+//
+//	kadmin stats
+//
+// shows how many proofs the KDC has checked and refused, and which
+// addresses and principals it is holding off.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+	"github.com/evanhong7384/ZK-Kerb/kdc/tlsutil"
+)
+
+var (
+	kdcHTTP   = flag.String("kdc-http", "https://localhost:8081", "base URL of the KDC's HTTPS endpoints")
+	tokenPath = flag.String("admin-token", "kdc-admin.token", "file holding the KDC's admin token")
+)
+
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] add <principal>...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] cred <principal> <attribute>=<value>...\n", os.Args[0])
+	fmt.Fprintf(flag.CommandLine.Output(), "       %s [flags] stats\n", os.Args[0])
+	flag.PrintDefaults()
+}
+
+func main() {
+	var tlsOpts tlsutil.ClientOptions
+	flag.StringVar(&tlsOpts.CAFile, "ca", "kdc.crt", "CA (or self-signed KDC certificate) to verify the KDC against")
+	flag.StringVar(&tlsOpts.Pin, "pin", "", "hex SHA-256 fingerprint of the KDC's certificate; overrides -ca")
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "", "client certificate for the KDC")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "", "client certificate key")
+	flag.Usage = usage
+	flag.Parse()
+
+	args := flag.Args()
+	if !(len(args) >= 2 && (args[0] == "add" || args[0] == "cred") || len(args) == 1 && args[0] == "stats") {
+		usage()
+		os.Exit(2)
+	}
+
+	token, err := os.ReadFile(*tokenPath)
+	if err != nil {
+		log.Fatalf("admin token: %v", err)
+	}
+	if tlsOpts.Pin != "" {
+		tlsOpts.CAFile = ""
+	}
+	tlsConfig, err := tlsutil.ClientConfig(tlsOpts)
+	if err != nil {
+		log.Fatal(err)
+	}
+	api := kdcapi.New(*kdcHTTP, &http.Client{
+		Timeout:   30 * time.Second,
+		Transport: &http.Transport{TLSClientConfig: tlsConfig},
+	})
+	api.AdminToken = strings.TrimSpace(string(token))
+
+	if args[0] == "stats" {
+		printStats(api)
+		return
+	}
+	if args[0] == "cred" {
+		issueCredential(api, args[1], args[2:])
+		return
+	}
+
+	failed := false
+	for _, name := range args[1:] {
+		e, err := api.CreatePrincipal(context.Background(), name)
+		if err != nil {
+			log.Printf("adding %s: %v", name, err)
+			failed = true
+			continue
+		}
+		fmt.Printf("%s\t%s\t(expires %s)\n", e.Principal, e.Token, e.Expires.Format(time.RFC3339))
+	}
+	if failed {
+		os.Exit(1)
+	}
+}
+
+// issueCredential prints the KDC's signature over name's attributes.
+func issueCredential(api *kdcapi.Client, name string, kvs []string) {
+	req := kdcapi.CredentialRequest{Principal: name, Attributes: map[string]string{}}
+	for _, kv := range kvs {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			log.Fatalf("attribute %q: want name=value", kv)
+		}
+		req.Attributes[k] = v
+	}
+	cred, err := api.IssueCredential(context.Background(), req)
+	if err != nil {
+		log.Fatalf("issuing credential for %s: %v", name, err)
+	}
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cred); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// printStats prints the KDC's proof counters and who it is holding off.
+func printStats(api *kdcapi.Client) {
+	st, err := api.Stats(context.Background())
+	if err != nil {
+		log.Fatalf("stats: %v", err)
+	}
+	fmt.Printf("proofs accepted %d, failed %d\n", st.Accepted, st.Failed)
+	fmt.Printf("refused unchecked: %d rate limited, %d locked out\n", st.RateLimited, st.LockedOut)
+	fmt.Printf("lockouts %d\n", st.Lockouts)
+	for _, l := range st.Locked {
+		from := "everywhere"
+		if l.Source != "" {
+			from = "from " + l.Source
+		}
+		fmt.Printf("locked\t%s\t%s\tuntil %s\n", l.Principal, from, l.Until.Format(time.RFC3339))
+	}
+	for _, b := range st.Principals {
+		fmt.Printf("principal\t%s\t%d failures\tuntil %s\n", b.Name, b.Failures, b.Until.Format(time.RFC3339))
+	}
+	for _, b := range st.Sources {
+		fmt.Printf("source\t%s\t%d failures\tuntil %s\n", b.Name, b.Failures, b.Until.Format(time.RFC3339))
+	}
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+)
+
+// maxTicketLife caps how long any ticket we issue stays valid.
+const maxTicketLife = 10 * time.Hour
+
+// keytab holds the long-term keys of krbtgt and every service we issue
+// tickets for.
+var keytab krb.Keytab
+
+// handleASReq pre-authenticates the client, issues a ticket for
+// req.SName and seals the session key under the client's reply key.
+func handleASReq(req *krb.ASReq, source string) (*krb.ASRep, error) {
+	replyKey, repPA, authz, err := checkPreauth(req, source)
+	if err != nil {
+		return nil, err
+	}
+	tkt, part, err := issueTicket(req.CName, req.SName, req.Till, time.Time{}, authz)
+	if err != nil {
+		return nil, err
+	}
+	part.Nonce = req.Nonce
+	encPart, err := krb.Seal(replyKey, 0, krb.UsageASRepEncPart, part)
+	if err != nil {
+		return nil, err
+	}
+	return &krb.ASRep{CName: req.CName, Ticket: tkt, EncPart: encPart, PAData: repPA}, nil
+}
+
+// checkPreauth requires services to prove they hold their long-term key
+// (PA-ENC-TIMESTAMP) and users to prove knowledge of their secret (PA-ZK).
+// It returns the AS reply key, any padata for the reply and the
+// authorization data the proof earned.
+func checkPreauth(req *krb.ASReq, source string) ([]byte, []krb.PAData, []krb.AuthData, error) {
+	key, ok := keytab[req.CName]
+	if !ok {
+		if _, ok := krb.FindPAData(req.PAData, krb.PAZK); !ok {
+			return nil, nil, nil, preauthRequired(req.CName, source)
+		}
+		replyKey, repPA, authz, err := checkPAZK(req.CName, source, req.PAData)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		return replyKey, []krb.PAData{repPA}, authz, nil
+	}
+
+	pa, ok := krb.FindPAData(req.PAData, krb.PAEncTimestamp)
+	if !ok {
+		return nil, nil, nil, krb.NewError(krb.ErrPreauthRequired, "PA-ENC-TIMESTAMP required")
+	}
+	ts, err := krb.VerifyPAEncTimestamp(pa, key)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	paHash := sha256.Sum256(pa.Value)
+	err = replayCache.Check(replay.Key{
+		Principal: req.CName,
+		Timestamp: ts,
+		Nonce:     hex.EncodeToString(paHash[:]),
+	})
+	if errors.Is(err, replay.ErrReplay) {
+		return nil, nil, nil, krb.NewError(krb.ErrRepeat, "pre-authentication is a replay")
+	}
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return key.Key, nil, nil, nil
+}
+
+// handleTGSReq uses the TGT in req to issue a ticket for req.SName.
+func handleTGSReq(req *krb.TGSReq) (*krb.TGSRep, error) {
+	tgt, err := krb.VerifyTGSReq(req, keytab, replayCache)
+	if err != nil {
+		return nil, err
+	}
+	if tgtRevoked(tgt.Client, tgt.Ticket.AuthTime) {
+		return nil, krb.NewError(krb.ErrTGTRevoked, "TGT revoked by a password change")
+	}
+	tkt, part, err := issueTicket(tgt.Client, req.SName, req.Till, tgt.Ticket.EndTime, tgt.Ticket.AuthorizationData)
+	if err != nil {
+		return nil, err
+	}
+	part.Nonce = req.Nonce
+	encPart, err := krb.Seal(tgt.SessionKey, 0, krb.UsageTGSRepEncPart, part)
+	if err != nil {
+		return nil, err
+	}
+	return &krb.TGSRep{CName: tgt.Client, Ticket: tkt, EncPart: encPart}, nil
+}
+
+// issueTicket creates a ticket for cname to sname, carrying authz, and the
+// matching reply part. The ticket ends at the earliest of till, notAfter
+// and the maximum lifetime; zero times are ignored.
+func issueTicket(cname, sname string, till, notAfter time.Time, authz []krb.AuthData) (krb.Ticket, krb.EncKDCRepPart, error) {
+	svc, err := keytab.Lookup(sname)
+	if err != nil {
+		return krb.Ticket{}, krb.EncKDCRepPart{}, err
+	}
+	sessionKey, err := krb.NewKey()
+	if err != nil {
+		return krb.Ticket{}, krb.EncKDCRepPart{}, err
+	}
+
+	now := time.Now().UTC()
+	end := now.Add(maxTicketLife)
+	for _, t := range []time.Time{till, notAfter} {
+		if !t.IsZero() && t.Before(end) {
+			end = t
+		}
+	}
+
+	encTicket, err := krb.Seal(svc.Key, svc.KVNO, krb.UsageASRepTicket, krb.EncTicketPart{
+		SessionKey: sessionKey,
+		CName:      cname,
+		AuthTime:   now,
+		EndTime:    end,
+
+		AuthorizationData: authz,
+	})
+	if err != nil {
+		return krb.Ticket{}, krb.EncKDCRepPart{}, err
+	}
+	return krb.Ticket{SName: sname, EncPart: encTicket}, krb.EncKDCRepPart{
+		SessionKey: sessionKey,
+		SName:      sname,
+		AuthTime:   now,
+		EndTime:    end,
+	}, nil
+}
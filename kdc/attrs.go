@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/algebra/native/twistededwards"
+	"github.com/consensys/gnark/std/hash/mimc"
+	stdeddsa "github.com/consensys/gnark/std/signature/eddsa"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/attrs"
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// attrCircuitID names the attribute claim circuit (must match client).
+const attrCircuitID = "eddsa-attr-v1"
+
+// AttrCircuit proves claims about the attributes in a credential we
+// signed for Principal, revealing nothing about the attributes beyond
+// the claims. Each attribute i is claimed with operator Op[i]: 0 for no
+// claim, else krb.ClaimEq, ClaimGE or ClaimLE against Value[i].
+type AttrCircuit struct {
+	Attr      [attrs.N]frontend.Variable `gnark:"attr"` // secret: encoded attribute values
+	Signature stdeddsa.Signature         `gnark:"signature"`
+
+	PublicKey stdeddsa.PublicKey         `gnark:",public"` // our credential signing key
+	Principal frontend.Variable          `gnark:",public"` // attrs.Principal of the holder
+	Op        [attrs.N]frontend.Variable `gnark:",public"`
+	Value     [attrs.N]frontend.Variable `gnark:",public"`
+	Challenge frontend.Variable          `gnark:",public"` // binds the proof to a KDC challenge
+}
+
+func (c *AttrCircuit) Define(api frontend.API) error {
+	id, err := curves.FromField(api.Compiler().Field())
+	if err != nil {
+		return err
+	}
+	curve, err := twistededwards.NewEdCurve(api, curves.TwistedEdwards(id))
+	if err != nil {
+		return err
+	}
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.Principal)
+	h.Write(c.Attr[:]...)
+	msg := h.Sum()
+	h.Reset()
+	if err := stdeddsa.Verify(curve, c.Signature, msg, c.PublicKey, &h); err != nil {
+		return err
+	}
+
+	for i := range attrs.N {
+		op := api.ToBinary(c.Op[i], 2)
+		eq := api.IsZero(api.Sub(c.Attr[i], c.Value[i]))
+		cmp := api.Cmp(c.Attr[i], c.Value[i])
+		ge := api.Sub(1, api.IsZero(api.Add(cmp, 1)))
+		le := api.Sub(1, api.IsZero(api.Sub(cmp, 1)))
+		api.AssertIsEqual(api.Lookup2(op[0], op[1], 1, eq, ge, le), 1)
+		// ranges (ops 2 and 3) only hold for numbers, not hashed strings
+		api.ToBinary(api.Mul(c.Attr[i], op[1]), 64)
+	}
+
+	// Groth16 only binds public inputs that appear in a constraint
+	api.Mul(c.Challenge, c.Challenge)
+	return nil
+}
+
+// attrKey signs the attribute credentials we issue.
+var attrKey *attrs.Key
+
+// handleIssueCredential signs a set of attributes for a principal. The
+// admin hands the credential to the user, who proves claims about it when
+// logging in; we keep no copy.
+func handleIssueCredential(w http.ResponseWriter, r *http.Request) {
+	var req kdcapi.CredentialRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if !principalExists(req.Principal) {
+		writeError(w, http.StatusNotFound, kdcapi.CodePrincipalUnknown, "no such principal "+req.Principal)
+		return
+	}
+	cred, err := attrs.Issue(attrKey, req.Principal, req.Attributes)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, kdcapi.CodeBadRequest, err.Error())
+		return
+	}
+	log.Printf("📜 issued credential for %s", req.Principal)
+	writeJSON(w, http.StatusOK, cred)
+}
+
+// verifyClaims checks a PA-ZK-ATTR for cname against the challenge
+// binding of the same AS exchange, and returns the AD-ZK-CLAIMS the
+// ticket should carry.
+func verifyClaims(cname string, pa krb.PAData, binding []byte) ([]krb.AuthData, error) {
+	var z krb.PAZKAttrReq
+	if err := krb.ParsePAZK(pa, &z); err != nil {
+		return nil, errProofFormat
+	}
+	if z.CircuitID != attrCircuitID {
+		return nil, fmt.Errorf("%w: claims need circuit %s", errProofFormat, attrCircuitID)
+	}
+	if err := attrs.CheckClaims(z.Claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", errProofFormat, err)
+	}
+
+	assignment := AttrCircuit{
+		Principal: attrs.Principal(zkCurve, cname),
+		Challenge: challengeInput(binding),
+	}
+	assignment.PublicKey.Assign(curves.TwistedEdwards(zkCurve), attrKey.Signer.Public().Bytes())
+	for i := range attrs.N {
+		assignment.Op[i], assignment.Value[i] = 0, 0
+	}
+	for _, c := range z.Claims {
+		i := attrs.Index(c.Attribute)
+		assignment.Op[i], assignment.Value[i] = c.Op, attrs.Encode(zkCurve, c.Value)
+	}
+	proof, err := readProof(z.Proof)
+	if err != nil {
+		return nil, err
+	}
+	pubWit, err := frontend.NewWitness(&assignment, zkCurve.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return nil, fmt.Errorf("public witness: %w", err)
+	}
+	if err := circuits[attrCircuitID].verifier.Verify(proof, pubWit); err != nil {
+		return nil, errProofRejected
+	}
+
+	ad, err := krb.NewAuthData(krb.ADZKClaims, krb.ZKClaims{Claims: z.Claims})
+	if err != nil {
+		return nil, err
+	}
+	return []krb.AuthData{ad}, nil
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/batchverify"
+)
+
+// batchWindow is how long a circuit's verifier gathers proofs to verify
+// together after the first one arrives; 0 verifies each proof on its own.
+// batchMax caps a batch.
+var (
+	batchWindow = 5 * time.Millisecond
+	batchMax    = 64
+)
+
+// verifyReq is a proof waiting in a verifier's queue.
+type verifyReq struct {
+	proof groth16.Proof
+	pub   witness.Witness
+	done  chan error
+}
+
+// verifier batches the proofs for one circuit. Under load, a batch is
+// checked with one multi-pairing. If it fails, it is split in half and
+// each half checked the same way, down to single proofs: a bad proof in
+// a batch of n delays the others by about 2·log2(n) multi-pairings,
+// rather than costing n single verifications.
+type verifier struct {
+	vk   groth16.VerifyingKey
+	reqs chan verifyReq
+}
+
+func newVerifier(vk groth16.VerifyingKey) *verifier {
+	v := &verifier{vk: vk, reqs: make(chan verifyReq)}
+	go v.run()
+	return v
+}
+
+// Verify checks proof against pub, batched with whatever else arrives in
+// the same window. Only BN254 proofs can be batched.
+func (v *verifier) Verify(proof groth16.Proof, pub witness.Witness) error {
+	if batchWindow <= 0 || v.vk.CurveID() != ecc.BN254 {
+		return groth16.Verify(proof, v.vk, pub)
+	}
+	done := make(chan error, 1)
+	v.reqs <- verifyReq{proof, pub, done}
+	return <-done
+}
+
+func (v *verifier) run() {
+	for first := range v.reqs {
+		batch := []verifyReq{first}
+		window := time.NewTimer(batchWindow)
+	gather:
+		for len(batch) < batchMax {
+			select {
+			case r := <-v.reqs:
+				batch = append(batch, r)
+			case <-window.C:
+				break gather
+			}
+		}
+		window.Stop()
+		go v.verifyBatch(batch)
+	}
+}
+
+// verifyBatch answers every request in batch, bisecting it until the
+// halves that fail are single proofs.
+func (v *verifier) verifyBatch(batch []verifyReq) {
+	if len(batch) == 1 {
+		batch[0].done <- groth16.Verify(batch[0].proof, v.vk, batch[0].pub)
+		return
+	}
+	proofs := make([]groth16.Proof, len(batch))
+	pubs := make([]witness.Witness, len(batch))
+	for i, r := range batch {
+		proofs[i], pubs[i] = r.proof, r.pub
+	}
+	switch err := batchverify.Verify(v.vk, proofs, pubs); {
+	case err == nil:
+		for _, r := range batch {
+			r.done <- nil
+		}
+	case errors.Is(err, batchverify.ErrBatch):
+		v.verifyBatch(batch[:len(batch)/2])
+		v.verifyBatch(batch[len(batch)/2:])
+	default:
+		// can't be batched at all
+		for _, r := range batch {
+			r.done <- groth16.Verify(r.proof, v.vk, r.pub)
+		}
+	}
+}
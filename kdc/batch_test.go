@@ -0,0 +1,146 @@
+package main
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"sync"
+	"testing"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/backend/witness"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/logger"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/batchverify"
+	"github.com/evanhong7384/ZK-Kerb/kdc/commitment"
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+)
+
+// testProofs holds proofs of the password circuit over one curve.
+type testProofs struct {
+	vk     groth16.VerifyingKey
+	proofs []groth16.Proof
+	pubs   []witness.Witness
+}
+
+// proofCache keeps testProofs by curve, as benchmarks run many times.
+var proofCache = struct {
+	sync.Mutex
+	m map[ecc.ID]*testProofs
+}{m: map[ecc.ID]*testProofs{}}
+
+// passwordProofs sets up the password circuit over curve and proves it
+// for n random passwords over random challenges. Passwords are random
+// field elements rather than stretched, which would only slow it down.
+func passwordProofs(tb testing.TB, curve ecc.ID, n int) *testProofs {
+	tb.Helper()
+	proofCache.Lock()
+	defer proofCache.Unlock()
+	if p := proofCache.m[curve]; p != nil && len(p.proofs) >= n {
+		return p
+	}
+	logger.Disable()
+	cs, err := frontend.Compile(curve.ScalarField(), r1cs.NewBuilder, &Circuit{})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	pk, vk, err := groth16.Setup(cs)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	p := &testProofs{vk: vk, proofs: make([]groth16.Proof, n), pubs: make([]witness.Witness, n)}
+	for i := range n {
+		salt, err := commitment.NewSalt()
+		if err != nil {
+			tb.Fatal(err)
+		}
+		pw, err := rand.Int(rand.Reader, curve.ScalarField())
+		if err != nil {
+			tb.Fatal(err)
+		}
+		commit, err := commitment.CommitStretched(curve, salt, pw)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		challenge, err := rand.Int(rand.Reader, curve.ScalarField())
+		if err != nil {
+			tb.Fatal(err)
+		}
+		full, err := frontend.NewWitness(&Circuit{
+			PW:         pw,
+			Salt:       new(big.Int).SetBytes(salt),
+			Commitment: new(big.Int).SetBytes(commit),
+			Challenge:  challenge,
+		}, curve.ScalarField())
+		if err != nil {
+			tb.Fatal(err)
+		}
+		if p.proofs[i], err = groth16.Prove(cs, pk, full); err != nil {
+			tb.Fatal(err)
+		}
+		if p.pubs[i], err = full.Public(); err != nil {
+			tb.Fatal(err)
+		}
+	}
+	proofCache.m[curve] = p
+	return p
+}
+
+// TestVerifierBisects checks that a batch with bad proofs in it fails
+// exactly those, and passes the rest.
+func TestVerifierBisects(t *testing.T) {
+	p := passwordProofs(t, ecc.BN254, 8)
+	v := newVerifier(p.vk)
+	bad := map[int]bool{2: true, 5: true}
+
+	errs := make([]error, len(p.proofs))
+	var wg sync.WaitGroup
+	for i := range p.proofs {
+		pub := p.pubs[i]
+		if bad[i] {
+			// the proof of another password
+			pub = p.pubs[(i+1)%len(p.pubs)]
+		}
+		wg.Go(func() { errs[i] = v.Verify(p.proofs[i], pub) })
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if bad[i] && err == nil {
+			t.Errorf("proof %d: bad proof verified", i)
+		}
+		if !bad[i] && err != nil {
+			t.Errorf("proof %d: %v", i, err)
+		}
+	}
+}
+
+// BenchmarkVerify compares one groth16.Verify per proof, over each curve,
+// with batchverify.Verify over batches of several sizes, which is BN254
+// only. ns/proof is the cost of each proof on one core.
+func BenchmarkVerify(b *testing.B) {
+	for _, curve := range curves.Supported {
+		b.Run("groth16.Verify/"+curve.String(), func(b *testing.B) {
+			p := passwordProofs(b, curve, 1)
+			for b.Loop() {
+				if err := groth16.Verify(p.proofs[0], p.vk, p.pubs[0]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N), "ns/proof")
+		})
+	}
+	for _, n := range []int{8, 32, 64} {
+		b.Run(fmt.Sprintf("batch-%d/bn254", n), func(b *testing.B) {
+			p := passwordProofs(b, ecc.BN254, n)
+			for b.Loop() {
+				if err := batchverify.Verify(p.vk, p.proofs[:n], p.pubs[:n]); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*n), "ns/proof")
+		})
+	}
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	crypto_rand "crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// challengeTTL is how long a client has to answer a PA-ZK challenge.
+const challengeTTL = 2 * time.Minute
+
+// precomputeTTL is how long a long-lived challenge lasts: one a client
+// proves over ahead of time, so that logging in later takes no proving.
+// Only named principals that authenticated get them, and each has at most
+// maxPrecomputed pending; past that we refuse more rather than drop one a
+// client may still hold a proof for. 0 disables them.
+var precomputeTTL = 12 * time.Hour
+
+const maxPrecomputed = 4
+
+// maxChallenges caps the challenges pending at once; past it we refuse to
+// issue more. maxChallengesPer caps the short-lived ones pending for one
+// principal, or for anonymous logins one source address, past which the
+// oldest is dropped: a client answers one at a time. Expired challenges
+// are swept out every challengeSweep.
+var maxChallenges = 1 << 17
+
+const (
+	maxChallengesPer = 8
+	challengeSweep   = 30 * time.Second
+)
+
+var (
+	errPrecomputeDisabled  = errors.New("long-lived challenges are disabled")
+	errPrecomputeAnonymous = errors.New("long-lived challenges are only for named principals")
+	errTooManyPrecomputed  = fmt.Errorf("principal already holds %d long-lived challenges; answer one or wait for it to expire", maxPrecomputed)
+	errTooManyChallenges   = errors.New("too many pending challenges; try again later")
+)
+
+type pendingChallenge struct {
+	principal string
+	owner     string
+	expires   time.Time
+	longLived bool
+}
+
+// challenges holds the PA-ZK challenges we have issued and not yet seen
+// answered, keyed by the hex challenge. short and long list each owner's
+// short- and long-lived challenges, oldest first.
+var challenges = struct {
+	sync.Mutex
+	m           map[string]pendingChallenge
+	short, long map[string][]string
+}{m: map[string]pendingChallenge{}, short: map[string][]string{}, long: map[string][]string{}}
+
+// challengeOwner is who a challenge to principal from source counts
+// against: the principal, except that anonymous clients all log in as
+// one, so theirs count against their address.
+func challengeOwner(principal, source string) string {
+	if principal == krb.Anonymous {
+		return principal + "@" + source
+	}
+	return principal
+}
+
+// issueChallenge creates a fresh challenge for principal, asked for from
+// source, carrying the salt the client needs to prove over. Anonymous
+// clients are challenged to prove group membership instead. A long-lived
+// challenge lasts precomputeTTL; the caller must have authenticated
+// principal, which can't be anonymous, and it is refused if the principal
+// already has maxPrecomputed.
+func issueChallenge(principal, source string, longLived bool) (*krb.PAZKChallenge, error) {
+	ttl := challengeTTL
+	if longLived {
+		if precomputeTTL <= 0 {
+			return nil, errPrecomputeDisabled
+		}
+		if principal == krb.Anonymous {
+			return nil, errPrecomputeAnonymous
+		}
+		ttl = precomputeTTL
+	}
+	circuit, salt := groupCircuitID, []byte(nil)
+	if principal != krb.Anonymous {
+		rec, ok := lookupPrincipal(principal)
+		if !ok {
+			return nil, errUnknownPrincipal
+		}
+		circuit, salt = circuitID, rec.Salt
+	}
+	nonce := make([]byte, 32)
+	if _, err := crypto_rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	key := hex.EncodeToString(nonce)
+	owner := challengeOwner(principal, source)
+	expires := time.Now().Add(ttl).UTC().Truncate(time.Second)
+
+	challenges.Lock()
+	defer challenges.Unlock()
+	if longLived && len(challenges.long[owner]) >= maxPrecomputed {
+		return nil, errTooManyPrecomputed
+	}
+	held := challenges.short
+	if longLived {
+		held = challenges.long
+	}
+	if keys := held[owner]; len(keys) >= maxChallengesPer {
+		forgetChallenge(keys[0])
+	}
+	if len(challenges.m) >= maxChallenges {
+		return nil, errTooManyChallenges
+	}
+	challenges.m[key] = pendingChallenge{principal, owner, expires, longLived}
+	held[owner] = append(held[owner], key)
+	return &krb.PAZKChallenge{CircuitID: circuit, Challenge: nonce, Expires: expires, Salt: salt}, nil
+}
+
+// forgetChallenge drops a pending challenge. challenges must be locked.
+func forgetChallenge(key string) {
+	c, ok := challenges.m[key]
+	if !ok {
+		return
+	}
+	delete(challenges.m, key)
+	held := challenges.short
+	if c.longLived {
+		held = challenges.long
+	}
+	keys := slices.DeleteFunc(held[c.owner], func(k string) bool { return k == key })
+	if len(keys) == 0 {
+		delete(held, c.owner)
+	} else {
+		held[c.owner] = keys
+	}
+}
+
+// sweepChallenges drops expired challenges every challengeSweep, so
+// issuing one never has to look at the others.
+func sweepChallenges() {
+	for range time.Tick(challengeSweep) {
+		now := time.Now()
+		challenges.Lock()
+		for k, c := range challenges.m {
+			if now.After(c.expires) {
+				forgetChallenge(k)
+			}
+		}
+		challenges.Unlock()
+	}
+}
+
+// errUnauthenticated is returned when a caller outside the AS exchange
+// asks for a named principal's challenge, and with it the salt, without an
+// AP-REQ from that principal.
+var errUnauthenticated = errors.New("an AP-REQ from the principal is required")
+
+// authenticateCaller checks that der is a DER AP-REQ from principal, made
+// with a ticket we issued that a password change hasn't revoked, e.g. the
+// one the caller just logged in with. Its authenticator is accepted once.
+func authenticateCaller(der []byte, principal string) error {
+	m, err := krb.Unmarshal(der)
+	if err != nil || m.APReq == nil {
+		return errUnauthenticated
+	}
+	ctx, err := krb.VerifyAPReq(m.APReq, keytab, replayCache)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errUnauthenticated, err)
+	}
+	if ctx.Client != principal || tgtRevoked(ctx.Client, ctx.Ticket.AuthTime) {
+		return errUnauthenticated
+	}
+	return nil
+}
+
+// errChallenge is returned for a challenge we didn't issue, issued to
+// someone else, already used or expired.
+var errChallenge = errors.New("no live challenge")
+
+// consumeChallenge accepts a challenge once, and only from the principal
+// it was issued to, before it expires.
+func consumeChallenge(principal string, nonce []byte) error {
+	key := hex.EncodeToString(nonce)
+	challenges.Lock()
+	c, ok := challenges.m[key]
+	forgetChallenge(key)
+	challenges.Unlock()
+
+	if !ok {
+		return fmt.Errorf("%w: unknown or already used challenge", errChallenge)
+	}
+	if c.principal != principal {
+		return fmt.Errorf("%w: challenge was issued to another principal", errChallenge)
+	}
+	if time.Now().After(c.expires) {
+		return fmt.Errorf("%w: challenge expired", errChallenge)
+	}
+	return nil
+}
+
+// preauthRequired builds the PREAUTH_REQUIRED error that carries a new
+// PA-ZK challenge for principal, asked for from source.
+func preauthRequired(principal, source string) error {
+	ch, err := issueChallenge(principal, source, false)
+	if errors.Is(err, errUnknownPrincipal) {
+		return krb.NewError(krb.ErrCPrincipalUnknown, "no such principal "+principal)
+	}
+	if errors.Is(err, errTooManyChallenges) {
+		return krb.NewError(krb.ErrGeneric, err.Error())
+	}
+	if err != nil {
+		return err
+	}
+	pa, err := krb.NewPAZK(*ch)
+	if err != nil {
+		return err
+	}
+	data, err := krb.MarshalMethodData([]krb.PAData{pa})
+	if err != nil {
+		return err
+	}
+	ke := krb.NewError(krb.ErrPreauthRequired, "answer the PA-ZK challenge")
+	ke.Data = data
+	return ke
+}
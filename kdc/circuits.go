@@ -0,0 +1,243 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/consensys/gnark-crypto/ecc"
+	"github.com/consensys/gnark/backend/groth16"
+	"github.com/consensys/gnark/constraint"
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/frontend/cs/r1cs"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+	"github.com/evanhong7384/ZK-Kerb/kdc/manifest"
+)
+
+// zkCircuit is a circuit we accept proofs for, compiled and with its keys,
+// the manifest describing them as signed when they were set up, and the
+// queue its proofs are verified in.
+type zkCircuit struct {
+	publicInputs []string
+	cs           constraint.ConstraintSystem
+	pk           groth16.ProvingKey
+	vk           groth16.VerifyingKey
+	manifest     manifest.Manifest
+	signed       *manifest.Signed
+	verifier     *verifier
+}
+
+// zkCurve is the curve every circuit is compiled over. Proofs for any
+// other curve are rejected, and the salted commitments in the principal
+// database are elements of its scalar field, so changing it means
+// enrolling everyone again. The principal database and the group file
+// record their curve, and we refuse to start on files over another.
+var zkCurve = ecc.BN254
+
+// checkFileCurve checks that the file at path, which records that it is
+// over the curve called name, is over zkCurve. An empty name is a file
+// from before curves were recorded, when every file was over BN254.
+func checkFileCurve(path, name string) error {
+	if name == "" {
+		name = ecc.BN254.String()
+	}
+	id, err := curves.Parse(name)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if id != zkCurve {
+		return fmt.Errorf("%s is over %s, not %s; run with -curve %s", path, id, zkCurve, id)
+	}
+	return nil
+}
+
+// circuits holds every circuit we serve, by circuit ID. circuitID is the
+// one clients get when they don't name one.
+var circuits = map[string]*zkCircuit{}
+
+// keysDir holds each circuit's keys and the manifest signed for them, so a
+// generation of keys outlives restarts until its manifest expires. Empty
+// sets up new keys at every start.
+var keysDir = "kdc-keys"
+
+// setupCircuit compiles c and registers it as id, with the keys saved for
+// it if they are still good, else with new ones from a fresh trusted
+// setup.
+func setupCircuit(id string, c frontend.Circuit, publicInputs ...string) error {
+	cs, err := frontend.Compile(zkCurve.ScalarField(), r1cs.NewBuilder, c)
+	if err != nil {
+		return fmt.Errorf("compile %s: %w", id, err)
+	}
+	z, err := loadKeys(id, cs)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			log.Printf("🔑 circuit %s: %v; setting up new keys", id, err)
+		}
+		if z, err = newKeys(id, cs); err != nil {
+			return err
+		}
+	}
+	z.publicInputs, z.verifier = publicInputs, newVerifier(z.vk)
+	circuits[id] = z
+	log.Printf("🔑 circuit %s: %d constraints over %s, keys valid until %s",
+		id, cs.GetNbConstraints(), zkCurve, z.manifest.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// newKeys runs the trusted setup for cs, signs the manifest of the keys
+// once, for all of manifestValidity, and saves both to keysDir.
+func newKeys(id string, cs constraint.ConstraintSystem) (*zkCircuit, error) {
+	pk, vk, err := groth16.Setup(cs)
+	if err != nil {
+		return nil, fmt.Errorf("setup %s: %w", id, err)
+	}
+	m, err := describeKeys(id, cs, pk, vk)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", id, err)
+	}
+	m.NotAfter = m.NotBefore.Add(manifestValidity)
+	signed, err := manifest.Sign(manifestKey, &m)
+	if err != nil {
+		return nil, fmt.Errorf("manifest %s: %w", id, err)
+	}
+	z := &zkCircuit{cs: cs, pk: pk, vk: vk, manifest: m, signed: signed}
+	if keysDir == "" {
+		return z, nil
+	}
+	if err := saveKeys(id, z); err != nil {
+		return nil, fmt.Errorf("save keys %s: %w", id, err)
+	}
+	return z, nil
+}
+
+// keyPath is the file in keysDir holding circuit id's ext: "pk", "vk" or
+// "manifest".
+func keyPath(id, ext string) string {
+	return filepath.Join(keysDir, id+"."+ext)
+}
+
+func saveKeys(id string, z *zkCircuit) error {
+	if err := os.MkdirAll(keysDir, 0o700); err != nil {
+		return err
+	}
+	for ext, key := range map[string]io.WriterTo{"pk": z.pk, "vk": z.vk} {
+		b, err := serialize(key)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(keyPath(id, ext), b, 0o600); err != nil {
+			return err
+		}
+	}
+	// the manifest goes last: it vouches for the keys written before it
+	b, err := json.Marshal(z.signed)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(keyPath(id, "manifest"), b, 0o600)
+}
+
+// loadKeys reads circuit id's saved keys, provided that we signed their
+// manifest, it is still valid, and it names cs and the keys.
+func loadKeys(id string, cs constraint.ConstraintSystem) (*zkCircuit, error) {
+	if keysDir == "" {
+		return nil, os.ErrNotExist
+	}
+	b, err := os.ReadFile(keyPath(id, "manifest"))
+	if err != nil {
+		return nil, err
+	}
+	var signed manifest.Signed
+	if err := json.Unmarshal(b, &signed); err != nil {
+		return nil, fmt.Errorf("saved manifest: %w", err)
+	}
+	m, err := signed.Verify(manifestKey.Public().(ed25519.PublicKey), time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("saved manifest: %w", err)
+	}
+	if m.CircuitID != id || m.Curve != zkCurve.String() {
+		return nil, fmt.Errorf("saved keys are for %s over %s", m.CircuitID, m.Curve)
+	}
+	raw, err := serialize(cs)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.CheckCircuit(raw); err != nil {
+		return nil, fmt.Errorf("circuit changed since its keys were set up: %w", err)
+	}
+	pk, vk := groth16.NewProvingKey(zkCurve), groth16.NewVerifyingKey(zkCurve)
+	if err := readKey(id, "pk", m.CheckPK, pk); err != nil {
+		return nil, err
+	}
+	if err := readKey(id, "vk", m.CheckVK, vk); err != nil {
+		return nil, err
+	}
+	return &zkCircuit{cs: cs, pk: pk, vk: vk, manifest: *m, signed: &signed}, nil
+}
+
+// readKey reads the saved key ext of circuit id into key, if check
+// accepts it.
+func readKey(id, ext string, check func([]byte) error, key io.ReaderFrom) error {
+	b, err := os.ReadFile(keyPath(id, ext))
+	if err != nil {
+		return err
+	}
+	if err := check(b); err != nil {
+		return err
+	}
+	body, err := curves.UntagFor(zkCurve, b)
+	if err != nil {
+		return err
+	}
+	if _, err := key.ReadFrom(bytes.NewReader(body)); err != nil {
+		return fmt.Errorf("saved %s of %s: %w", ext, id, err)
+	}
+	return nil
+}
+
+// serialize returns w in gnark's binary encoding, tagged with zkCurve.
+func serialize(w io.WriterTo) ([]byte, error) {
+	var buf bytes.Buffer
+	if _, err := w.WriteTo(&buf); err != nil {
+		return nil, err
+	}
+	return curves.Tag(zkCurve, buf.Bytes()), nil
+}
+
+// readProof decodes a proof tagged with its curve, which must be zkCurve.
+func readProof(b []byte) (groth16.Proof, error) {
+	body, err := curves.UntagFor(zkCurve, b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", errProofFormat, err)
+	}
+	proof := groth16.NewProof(zkCurve)
+	if _, err := proof.ReadFrom(bytes.NewReader(body)); err != nil {
+		return nil, errProofFormat
+	}
+	return proof, nil
+}
+
+// requestCircuit returns the circuit named by the request's "circuit"
+// query parameter, answering the request itself if there is no such
+// circuit.
+func requestCircuit(w http.ResponseWriter, r *http.Request) (*zkCircuit, bool) {
+	id := r.URL.Query().Get("circuit")
+	if id == "" {
+		id = circuitID
+	}
+	c, ok := circuits[id]
+	if !ok {
+		writeError(w, http.StatusNotFound, kdcapi.CodeNotFound, "no such circuit "+id)
+	}
+	return c, ok
+}
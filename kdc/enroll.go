@@ -0,0 +1,100 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+)
+
+// adminToken authorizes the admin endpoints. It is read from a file only
+// the KDC's operator can read, and created there on first start.
+var adminToken string
+
+// loadAdminToken reads the admin token from path, creating it if missing.
+func loadAdminToken(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return err
+		}
+		b = []byte(hex.EncodeToString(raw) + "\n")
+		if err := os.WriteFile(path, b, 0o600); err != nil {
+			return err
+		}
+		log.Printf("created admin token %s", path)
+	} else if err != nil {
+		return err
+	}
+	adminToken = strings.TrimSpace(string(b))
+	if adminToken == "" {
+		return fmt.Errorf("%s is empty", path)
+	}
+	return nil
+}
+
+// admin wraps h so only requests bearing the admin token reach it.
+func admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || adminToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(adminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="zk-kerb admin"`)
+			writeError(w, http.StatusUnauthorized, kdcapi.CodeUnauthorized, "admin token required")
+			return
+		}
+		h(w, r)
+	}
+}
+
+// handleCreatePrincipal registers a principal and hands back the one-time
+// token its user enrolls with.
+func handleCreatePrincipal(w http.ResponseWriter, r *http.Request) {
+	var req kdcapi.CreatePrincipalRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	token, expires, err := createPrincipal(req.Principal)
+	switch {
+	case errors.Is(err, errPrincipalName):
+		writeError(w, http.StatusBadRequest, kdcapi.CodeBadRequest, "invalid principal name "+req.Principal)
+		return
+	case errors.Is(err, errPrincipalExists):
+		writeError(w, http.StatusConflict, kdcapi.CodePrincipalExists, "principal "+req.Principal+" already exists")
+		return
+	case err != nil:
+		log.Printf("creating principal %s: %v", req.Principal, err)
+		writeError(w, http.StatusInternalServerError, kdcapi.CodeInternal, "failed to create principal")
+		return
+	}
+	log.Printf("👤 created principal %s, awaiting enrollment", req.Principal)
+	writeJSON(w, http.StatusOK, kdcapi.Enrollment{Principal: req.Principal, Token: token, Expires: expires})
+}
+
+// handleEnroll stores the commitment a user computed from their password.
+// The password itself never leaves the client.
+func handleEnroll(w http.ResponseWriter, r *http.Request) {
+	var req kdcapi.EnrollRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	err := enrollPrincipal(req.Principal, req.Token, req.Salt, req.Commitment)
+	switch {
+	case errors.Is(err, errEnrollment):
+		writeError(w, http.StatusForbidden, kdcapi.CodeEnrollmentInvalid, err.Error())
+		return
+	case err != nil:
+		log.Printf("enrolling %s: %v", req.Principal, err)
+		writeError(w, http.StatusInternalServerError, kdcapi.CodeInternal, "failed to enroll")
+		return
+	}
+	log.Printf("👤 %s enrolled", req.Principal)
+	writeJSON(w, http.StatusOK, kdcapi.EnrollResult{Principal: req.Principal, CircuitID: circuitID})
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+	"github.com/consensys/gnark/std/hash/mimc"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/commitment"
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/merkle"
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+)
+
+// groupCircuitID names the group membership circuit (must match client).
+const groupCircuitID = "mimc-group-v2"
+
+// groupDepth is the depth of group Merkle trees, so a group has at most
+// 2^groupDepth members.
+const groupDepth = 10
+
+// GroupCircuit proves that the prover's commitment MiMC(Salt, PW) is a
+// leaf of the group tree with root Root, without saying which, and that
+// Nullifier = MiMC(nk, Challenge) for the nullifier key
+// nk = MiMC(NullifierTag, PW, Salt) (see commitment.Nullifier).
+type GroupCircuit struct {
+	PW    frontend.Variable             `gnark:"pw"`   // secret
+	Salt  frontend.Variable             `gnark:"salt"` // secret too: salts are per principal
+	Path  [groupDepth]frontend.Variable `gnark:"path"` // siblings, from the leaf up
+	Index frontend.Variable             `gnark:"index"`
+
+	Root      frontend.Variable `gnark:",public"`
+	Nullifier frontend.Variable `gnark:",public"`
+	Challenge frontend.Variable `gnark:",public"` // binds the proof to a KDC challenge
+}
+
+func (c *GroupCircuit) Define(api frontend.API) error {
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.Salt, c.PW)
+	node := h.Sum()
+
+	bits := api.ToBinary(c.Index, groupDepth)
+	for i := range groupDepth {
+		left := api.Select(bits[i], c.Path[i], node)
+		right := api.Select(bits[i], node, c.Path[i])
+		h.Reset()
+		h.Write(left, right)
+		node = h.Sum()
+	}
+	api.AssertIsEqual(node, c.Root)
+
+	h.Reset()
+	h.Write(commitment.NullifierTag, c.PW, c.Salt)
+	nk := h.Sum()
+	h.Reset()
+	h.Write(nk, c.Challenge)
+	api.AssertIsEqual(h.Sum(), c.Nullifier)
+	return nil
+}
+
+var errUnknownGroup = errors.New("unknown group")
+
+// groups maps each group to its member principals, in leaf order.
+var groups map[string][]string
+
+// groupFile is the group file, e.g.
+//
+//	{"curve": "bn254", "groups": {"eng": ["alice", "bob"]}}
+//
+// Curve is the curve the group trees are built over, which must be the
+// one the principal database is over. A file that is just the map of
+// groups is over BN254, as every file was before curves were recorded.
+type groupFile struct {
+	Curve  string              `json:"curve"`
+	Groups map[string][]string `json:"groups"`
+}
+
+// loadGroups reads the group file, which must be over zkCurve. A missing
+// file means no groups.
+func loadGroups(path string) error {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f groupFile
+	if err := decodeStrict(b, &f); err != nil || f.Curve == "" {
+		f = groupFile{}
+		if err := json.Unmarshal(b, &f.Groups); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := checkFileCurve(path, f.Curve); err != nil {
+		return err
+	}
+	groups = f.Groups
+	for g, members := range groups {
+		if len(members) > 1<<groupDepth {
+			return fmt.Errorf("%s: group %s has more than %d members", path, g, 1<<groupDepth)
+		}
+	}
+	return nil
+}
+
+// groupTree builds the tree of group's enrolled members' commitments, as
+// they stand now.
+func groupTree(group string) (*merkle.Tree, []kdcapi.GroupMember, error) {
+	names, ok := groups[group]
+	if !ok {
+		return nil, nil, errUnknownGroup
+	}
+	var members []kdcapi.GroupMember
+	var leaves [][]byte
+	for _, name := range names {
+		rec, ok := lookupPrincipal(name)
+		if !ok {
+			continue
+		}
+		members = append(members, kdcapi.GroupMember{Commitment: rec.Commitment})
+		leaves = append(leaves, rec.Commitment)
+	}
+	tree, err := merkle.New(zkCurve, groupDepth, leaves)
+	return tree, members, err
+}
+
+// handleGroup publishes a group's root and leaves. Leaves are listed
+// without names or salts: a member finds its own by recomputing its
+// commitment from the salt it kept when it enrolled.
+func handleGroup(w http.ResponseWriter, r *http.Request) {
+	group := r.PathValue("group")
+	tree, members, err := groupTree(group)
+	if errors.Is(err, errUnknownGroup) {
+		writeError(w, http.StatusNotFound, kdcapi.CodeNotFound, "no such group "+group)
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, kdcapi.CodeInternal, "failed to build group tree")
+		return
+	}
+	writeJSON(w, http.StatusOK, kdcapi.Group{
+		Group:     group,
+		CircuitID: groupCircuitID,
+		Depth:     groupDepth,
+		Root:      tree.Root(),
+		Members:   members,
+	})
+}
+
+// verifyGroupProof checks an anonymous PA-ZK-REQ: that its proof shows
+// membership of its group for the challenge binding, and that its
+// nullifier is fresh. It returns the authorization data for the ticket.
+func verifyGroupProof(cname string, z krb.PAZKReq, binding []byte) ([]krb.AuthData, error) {
+	if cname != krb.Anonymous {
+		return nil, fmt.Errorf("%w: group proofs log in as %s", errProofFormat, krb.Anonymous)
+	}
+	tree, _, err := groupTree(z.Group)
+	if err != nil {
+		return nil, err
+	}
+	nullifier := new(big.Int).SetBytes(z.Nullifier)
+	if len(z.Nullifier) != curves.ElementSize || nullifier.Cmp(zkCurve.ScalarField()) >= 0 {
+		return nil, fmt.Errorf("%w: bad nullifier", errProofFormat)
+	}
+
+	proof, err := readProof(z.Proof)
+	if err != nil {
+		return nil, err
+	}
+	pubWit, err := frontend.NewWitness(&GroupCircuit{
+		Root:      new(big.Int).SetBytes(tree.Root()),
+		Nullifier: nullifier,
+		Challenge: challengeInput(binding),
+	}, zkCurve.ScalarField(), frontend.PublicOnly())
+	if err != nil {
+		return nil, fmt.Errorf("public witness: %w", err)
+	}
+	if err := circuits[groupCircuitID].verifier.Verify(proof, pubWit); err != nil {
+		return nil, errProofRejected
+	}
+
+	err = replayCache.Check(replay.Key{
+		Principal: "group:" + z.Group,
+		Timestamp: time.Now(),
+		Nonce:     hex.EncodeToString(z.Nullifier),
+	})
+	if errors.Is(err, replay.ErrReplay) {
+		return nil, errProofReplayed
+	}
+	if err != nil {
+		return nil, err
+	}
+	ad, err := krb.NewAuthData(krb.ADZKGroup, krb.ZKGroupAuth{Group: z.Group, Nullifier: z.Nullifier})
+	if err != nil {
+		return nil, err
+	}
+	return []krb.AuthData{ad}, nil
+}
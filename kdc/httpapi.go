@@ -0,0 +1,173 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// shutdownTimeout bounds how long we wait for in-flight requests on exit.
+const shutdownTimeout = 15 * time.Second
+
+// endpoint is one route: the method it accepts, the largest body it reads
+// and the handler behind it.
+type endpoint struct {
+	method  string
+	maxBody int64
+	handler http.HandlerFunc
+}
+
+func (e endpoint) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != e.method && !(e.method == http.MethodGet && r.Method == http.MethodHead) {
+		w.Header().Set("Allow", e.method)
+		writeError(w, http.StatusMethodNotAllowed, kdcapi.CodeMethodNotAllowed, r.Method+" not allowed here")
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, e.maxBody)
+	e.handler(w, r)
+}
+
+// newRouter returns the handler for the KDC's HTTPS endpoints.
+func newRouter() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/pk", endpoint{http.MethodGet, 0, handlePK})
+	mux.Handle("/vk", endpoint{http.MethodGet, 0, handleVK})
+	mux.Handle("/manifest", endpoint{http.MethodGet, 0, handleManifest})
+	mux.Handle("/challenge", endpoint{http.MethodPost, 4 << 10, handleChallenge})
+	mux.Handle("/prove", endpoint{http.MethodPost, 64 << 10, handleProve})
+	mux.Handle(krb.ProxyPath, endpoint{http.MethodPost, krb.MaxMessageSize + 64, handleKDCProxy})
+
+	// the versioned API, described by openapi.json
+	v1 := kdcapi.Prefix
+	mux.Handle(v1+"/health", endpoint{http.MethodGet, 0, handleHealth})
+	mux.Handle(v1+"/openapi.json", endpoint{http.MethodGet, 0, handleOpenAPI})
+	mux.Handle(v1+"/circuit", endpoint{http.MethodGet, 0, handleCircuit})
+	mux.Handle(v1+"/keys/proving", endpoint{http.MethodGet, 0, handleKey(func(c *zkCircuit) io.WriterTo { return c.pk })})
+	mux.Handle(v1+"/keys/constraint-system", endpoint{http.MethodGet, 0, handleKey(func(c *zkCircuit) io.WriterTo { return c.cs })})
+	mux.Handle(v1+"/keys/verifying", endpoint{http.MethodGet, 0, handleKey(func(c *zkCircuit) io.WriterTo { return c.vk })})
+	mux.Handle(v1+"/keys/manifest", endpoint{http.MethodGet, 0, handleManifest})
+	mux.Handle(v1+"/challenges", endpoint{http.MethodPost, 4 << 10, handleChallenge})
+	mux.Handle(v1+"/proofs", endpoint{http.MethodPost, 64 << 10, handleProof})
+	mux.Handle(v1+"/tickets", endpoint{http.MethodPost, 2*krb.MaxMessageSize + 64, handleTicket})
+	mux.Handle(v1+"/groups/{group}", endpoint{http.MethodGet, 0, handleGroup})
+	mux.Handle(v1+"/password", endpoint{http.MethodPost, 64 << 10, handlePasswordChange})
+	mux.Handle(v1+"/enrollments", endpoint{http.MethodPost, 4 << 10, handleEnroll})
+	mux.Handle(v1+"/admin/principals", endpoint{http.MethodPost, 4 << 10, admin(handleCreatePrincipal)})
+	mux.Handle(v1+"/admin/credentials", endpoint{http.MethodPost, 4 << 10, admin(handleIssueCredential)})
+	mux.Handle(v1+"/admin/stats", endpoint{http.MethodGet, 0, admin(handleStats)})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		writeError(w, http.StatusNotFound, kdcapi.CodeNotFound, "no such endpoint "+r.URL.Path)
+	})
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("writing response: %v", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, kdcapi.Error{Code: code, Message: message})
+}
+
+// readJSON decodes the request body into v, answering the request itself
+// if it can't.
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	err := dec.Decode(v)
+	var tooBig *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooBig):
+		writeError(w, http.StatusRequestEntityTooLarge, kdcapi.CodeTooLarge, err.Error())
+		return false
+	case err != nil:
+		writeError(w, http.StatusBadRequest, kdcapi.CodeBadRequest, "malformed JSON: "+err.Error())
+		return false
+	}
+	return true
+}
+
+// handlePK serves the proving key.
+func handlePK(w http.ResponseWriter, r *http.Request) {
+	pk, err := serialize(circuits[circuitID].pk)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, kdcapi.CodeInternal, "failed to serialize PK")
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{"pk": base64.StdEncoding.EncodeToString(pk)})
+}
+
+// handleVK serves the verifying key.
+func handleVK(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, circuits[circuitID].vk)
+}
+
+// handleProve checks a proof over a challenge from /challenge without
+// issuing anything; logins use PA-ZK in the AS exchange instead.
+func handleProve(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Principal    string `json:"principal"`
+		ProofB64     string `json:"proof"`
+		ChallengeB64 string `json:"challenge"`
+	}
+	if !readJSON(w, r, &req) {
+		return
+	}
+	proofBytes, err := base64.StdEncoding.DecodeString(req.ProofB64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, kdcapi.CodeBadRequest, "invalid proof encoding")
+		return
+	}
+	challenge, err := base64.StdEncoding.DecodeString(req.ChallengeB64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, kdcapi.CodeBadRequest, "invalid challenge encoding")
+		return
+	}
+
+	if writeProofError(w, verifyChallengeProof(req.Principal, sourceOf(r.RemoteAddr), proofBytes, challenge)) {
+		return
+	}
+	writeJSON(w, http.StatusOK, kdcapi.ProofResult{Valid: true})
+}
+
+// writeProofError answers the request if err, from verifyProof, is set.
+func writeProofError(w http.ResponseWriter, err error) bool {
+	var te *throttleError
+	switch {
+	case err == nil:
+		return false
+	case errors.As(err, &te):
+		w.Header().Set("Retry-After", strconv.Itoa(int(te.retryAfter.Seconds())+1))
+		code := kdcapi.CodeRateLimited
+		if errors.Is(err, errLockedOut) {
+			code = kdcapi.CodePrincipalLocked
+		}
+		writeError(w, http.StatusTooManyRequests, code, err.Error())
+	case errors.Is(err, errUnknownPrincipal):
+		writeError(w, http.StatusNotFound, kdcapi.CodePrincipalUnknown, err.Error())
+	case errors.Is(err, errChallenge):
+		writeError(w, http.StatusForbidden, kdcapi.CodeChallengeInvalid, err.Error())
+	case errors.Is(err, errProofFormat):
+		writeError(w, http.StatusBadRequest, kdcapi.CodeProofMalformed, err.Error())
+	case errors.Is(err, errProofRejected):
+		writeError(w, http.StatusForbidden, kdcapi.CodeProofRejected, "proof does not verify")
+	case errors.Is(err, errProofReplayed):
+		writeError(w, http.StatusForbidden, kdcapi.CodeProofReplayed, err.Error())
+	default:
+		log.Printf("verifying proof: %v", err)
+		writeError(w, http.StatusInternalServerError, kdcapi.CodeInternal, "internal error")
+	}
+	return true
+}
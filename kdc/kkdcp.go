@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// handleKDCProxy serves Kerberos over HTTPS (MS-KKDCP): the body is a
+// KDC-PROXY-MESSAGE wrapping an AS or TGS request, and the reply comes back
+// wrapped the same way.
+func handleKDCProxy(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		writeError(w, http.StatusRequestEntityTooLarge, kdcapi.CodeTooLarge, err.Error())
+		return
+	}
+	req, realm, err := krb.UnmarshalProxyMessage(body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, kdcapi.CodeBadRequest, err.Error())
+		return
+	}
+	if realm != "" && realm != krb.Realm {
+		writeError(w, http.StatusBadRequest, kdcapi.CodeUnknownRealm, "unknown realm "+realm)
+		return
+	}
+
+	reply, err := krb.MarshalProxyMessage(process(req, sourceOf(r.RemoteAddr)), "")
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, kdcapi.CodeInternal, "internal error")
+		return
+	}
+	w.Header().Set("Content-Type", krb.ProxyContentType)
+	w.Write(reply)
+}
@@ -1,251 +1,217 @@
 package main
 
 import (
-	"bytes"
 	"context"
-	crypto_rand "crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/gob"
-	"encoding/json"
-	"fmt"
+	"crypto/tls"
+	"errors"
+	"flag"
 	"log"
-	"math/big"
-	math_rand "math/rand"
-	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
 	"time"
 
-	"github.com/consensys/gnark-crypto/ecc"
-	"github.com/consensys/gnark/backend/groth16"
 	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/consensys/gnark/std/hash/mimc"
+	"google.golang.org/grpc"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/attrs"
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/manifest"
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+	"github.com/evanhong7384/ZK-Kerb/kdc/tlsutil"
 )
 
+// Circuit proves knowledge of the password behind a principal's salted
+// commitment: MiMC(Salt, PW) == Commitment. Only Salt and Commitment are
+// stored, and neither gives the password away.
 type Circuit struct {
-	X frontend.Variable `gnark:"x"`       // x  --> secret visibility (default)
-	Y frontend.Variable `gnark:",public"` // Y  --> public visibility
+	PW         frontend.Variable `gnark:"pw"`      // password as a field element --> secret
+	Salt       frontend.Variable `gnark:",public"` // per-principal salt
+	Commitment frontend.Variable `gnark:",public"` // MiMC(Salt, PW)
+	Challenge  frontend.Variable `gnark:",public"` // binds the proof to a KDC challenge
 }
 
 func (c *Circuit) Define(api frontend.API) error {
-	//x^4+- 10246*x^3 + 36745188*x^2 - 53772937114*x + 26415943377211 == 0
-    x2 := api.Mul(c.X, c.X)      
-    x3 := api.Mul(x2, c.X)       
-    x4 := api.Mul(x3, c.X)       
-
-    neg10246, _    := new(big.Int).SetString("-10246", 10)
-    pos36745188, _ := new(big.Int).SetString("36745188", 10)
-    neg53772937114, _ := new(big.Int).SetString("-53772937114", 10)
-    pos26415943377211, _ := new(big.Int).SetString("26415943377211", 10)
-
-    t3 := api.Mul(x3, neg10246)           
-    t2 := api.Mul(x2, pos36745188)       
-    t1 := api.Mul(c.X, neg53772937114)    
-    c0 := pos26415943377211               
-
-    acc := api.Add(x4, t3)
-    acc = api.Add(acc, t2)
-    acc = api.Add(acc, t1)
-    acc = api.Add(acc, c0)
-
-    api.AssertIsEqual(acc, c.Y)
-    return nil
-}
-
-var verifyingKey groth16.VerifyingKey
-var provingKey groth16.ProvingKey
-var authenticated bool = false
-var expectedY int = 0 // global public y 
-
-// Same p and g (must match client)
-var (
-	pHex = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
-		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
-		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
-		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
-		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
-		"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
-		"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
-		"670C354E4ABC9804F1746C08CA237327FFFFFFFFFFFFFFFF"
-	g = big.NewInt(2)
-)
-
-const tgt_aes_key = "fe86ed5edd0cfbefc32f904747c30bb20de64010b6c62a97a70e2e021abdbee0"
+	h, err := mimc.NewMiMC(api)
+	if err != nil {
+		return err
+	}
+	h.Write(c.Salt, c.PW)
+	api.AssertIsEqual(h.Sum(), c.Commitment)
 
-type Ticket struct {
-	session_key int
-	// username string
-	// address string
-	service_name string
-	// lifespan int
-	// timestamp int
+	// Groth16 only binds public inputs that appear in a constraint
+	api.Mul(c.Challenge, c.Challenge)
+	return nil
 }
 
+var replayCache replay.Cache
+
 func main() {
-	ZKKDC()
-	startServer()
-}
+	rcachePath := flag.String("rcache", "", "replay cache file (in-memory if empty)")
+	keytabPath := flag.String("keytab", "kdc.keytab", "keytab holding krbtgt and service keys")
+	services := flag.String("services", "serv,server1,server2", "comma-separated services to create keys for")
+	tcpAddr := flag.String("tcp", ":8080", "address for Kerberos over TCP (empty to disable)")
+	udpAddr := flag.String("udp", ":8080", "address for Kerberos over UDP (empty to disable)")
+	flag.IntVar(&maxUDPReply, "udp-max-reply", maxUDPReply, "largest reply sent over UDP; bigger ones get RESPONSE_TOO_BIG")
+	httpAddr := flag.String("http", ":8081", "address for the HTTPS endpoints (keys, proofs, KDC proxy)")
+	grpcAddr := flag.String("grpc", ":8082", "address for the gRPC service (empty to disable)")
+	var tlsOpts tlsutil.ServerOptions
+	flag.StringVar(&tlsOpts.CertFile, "tls-cert", "kdc.crt", "HTTPS certificate (a self-signed one is created if missing)")
+	flag.StringVar(&tlsOpts.KeyFile, "tls-key", "kdc.key", "HTTPS private key")
+	flag.StringVar(&tlsOpts.ClientCAFile, "tls-client-ca", "", "CAs for client certificates (client certificates not requested if empty)")
+	flag.BoolVar(&tlsOpts.RequireClientCert, "tls-require-client-cert", false, "refuse HTTPS clients without a certificate")
+	principalsPath := flag.String("principals", "principals.json", "principal database: salts and password commitments")
+	groupsPath := flag.String("groups", "groups.json", "groups for anonymous login: group name to member principals")
+	attrKeyPath := flag.String("attr-key", "kdc-attr.key", "key signing attribute credentials (created if missing)")
+	adminTokenPath := flag.String("admin-token", "kdc-admin.token", "bearer token for the admin endpoints (created if missing)")
+	manifestKeyPath := flag.String("manifest-key", "kdc-manifest.key", "key signing the proving-key manifest (created if missing, public half in <file>.pub)")
+	flag.Float64Var(&proofRate, "proof-rate", proofRate, "proofs verified per second per source address")
+	flag.IntVar(&proofBurst, "proof-burst", proofBurst, "proofs a source may send at once before -proof-rate applies")
+	flag.IntVar(&lockoutThreshold, "lockout-threshold", lockoutThreshold, "failed proofs in a row from one source that lock a principal out of it (0 never locks)")
+	flag.IntVar(&principalLockoutThreshold, "principal-lockout-threshold", principalLockoutThreshold, "failed proofs in a row from any sources that lock a principal out everywhere (0 never locks)")
+	flag.DurationVar(&lockoutDuration, "lockout-duration", lockoutDuration, "how long a lockout lasts")
+	flag.IntVar(&maxChallenges, "max-challenges", maxChallenges, "most PA-ZK challenges pending at once")
+	flag.DurationVar(&precomputeTTL, "precompute-ttl", precomputeTTL, "lifetime of long-lived challenges clients prove over ahead of time (0 disables them)")
+	flag.DurationVar(&batchWindow, "batch-window", batchWindow, "how long to gather proofs to verify in one batch (0 verifies each alone)")
+	flag.IntVar(&batchMax, "batch-max", batchMax, "most proofs verified in one batch")
+	curveName := flag.String("curve", zkCurve.String(), "curve to run the circuits over: bn254, bls12-381 or bls12-377; -principals and -groups must be over it")
+	flag.StringVar(&keysDir, "keys-dir", keysDir, "directory keeping circuit keys and their signed manifests across restarts (empty sets up new keys at each start)")
+	flag.DurationVar(&manifestValidity, "manifest-validity", manifestValidity, "lifetime of a generation of circuit keys and the manifest signed for them; new keys are set up at the first start after it")
+	flag.Parse()
+	if proofRate <= 0 || proofBurst < 1 {
+		log.Fatal("-proof-rate and -proof-burst must be positive")
+	}
+	if batchMax < 1 {
+		log.Fatal("-batch-max must be positive")
+	}
 
-func startServer() {
-	// Server (listening on a port)
-	math_rand.Seed(time.Now().UnixNano())
-	listener, err := net.Listen("tcp", ":8080")
+	var err error
+	if zkCurve, err = curves.Parse(*curveName); err != nil {
+		log.Fatal(err)
+	}
+	keytab, err = krb.LoadKeytab(*keytabPath)
 	if err != nil {
-		fmt.Println(err)
-		os.Exit(1)
+		log.Fatalf("keytab: %v", err)
 	}
-	defer listener.Close()
-
-	for {
-		conn, err := listener.Accept()
-		if err != nil {
-			fmt.Println("Error accepting connection: ", err)
-			continue
+	added, err := keytab.Ensure(append([]string{krb.TGS}, strings.Split(*services, ",")...)...)
+	if err != nil {
+		log.Fatalf("keytab: %v", err)
+	}
+	if added {
+		if err := keytab.Save(*keytabPath); err != nil {
+			log.Fatalf("keytab: %v", err)
 		}
-
-		go handleConnection(conn) // Handle each connection in a goroutine
-
 	}
-}
-
-func handleConnection(conn net.Conn) {
-	defer conn.Close()
 
-	// key exchange
-	var clientPub big.Int
-	decoder := gob.NewDecoder(conn)
-	err := decoder.Decode(&clientPub)
-	if err != nil {
-		fmt.Println("Error receiving client public key:", err)
-		return
+	if err := loadGroups(*groupsPath); err != nil {
+		log.Fatalf("groups: %v", err)
 	}
+	if err := loadPrincipals(*principalsPath); err != nil {
+		log.Fatalf("principals: %v", err)
+	}
+	go sweepChallenges()
+	go sweepLookaside()
 
-	p, _ := new(big.Int).SetString(pHex, 16)
-	kdcPrivate, _ := crypto_rand.Int(crypto_rand.Reader, p)
-	kdcPublic := new(big.Int).Exp(g, kdcPrivate, p)
-
-	encoder := gob.NewEncoder(conn)
-	err = encoder.Encode(kdcPublic)
+	replayCache, err = replay.Open(*rcachePath, replay.DefaultWindow)
 	if err != nil {
-		fmt.Println("Error sending KDC public key:", err)
-		return
+		log.Fatalf("replay cache: %v", err)
 	}
+	defer replayCache.Close()
 
-	sharedSecret := new(big.Int).Exp(&clientPub, kdcPrivate, p)
-	mock_password := sha256.Sum256(sharedSecret.Bytes())
-	fmt.Printf("Shared secret (session key) calculated: %x\n", mock_password)
-
-	return
-}
-
-func ZKKDC() {
-
-	proofOK := make(chan struct{})
-	mux := http.NewServeMux()
-
-	// ——— compile + trusted setup ———
-	var circuit Circuit
-	cs, err := frontend.Compile(
-		ecc.BN254.ScalarField(),
-		r1cs.NewBuilder,
-		&circuit,
-	)
+	created, err := tlsutil.EnsureSelfSigned(tlsOpts.CertFile, tlsOpts.KeyFile, "localhost", "127.0.0.1", "::1")
 	if err != nil {
-		log.Fatalf("compile error: %v", err)
+		log.Fatalf("tls: %v", err)
+	}
+	if created {
+		log.Printf("created self-signed certificate %s", tlsOpts.CertFile)
 	}
-	pk, vk, err := groth16.Setup(cs)
+	tlsConfig, err := tlsutil.ServerConfig(tlsOpts)
 	if err != nil {
-		log.Fatalf("setup error: %v", err)
-	}
-	provingKey = pk
-	verifyingKey = vk
-	log.Printf("🔑 Setup complete; server listening on :8081")
-
-	// 2) expose proving key
-	http.HandleFunc("/pk", func(w http.ResponseWriter, r *http.Request) {
-		var buf bytes.Buffer
-		if _, err := provingKey.WriteTo(&buf); err != nil {
-			http.Error(w, "failed to serialize PK", http.StatusInternalServerError)
-			return
-		}
-		pkB64 := base64.StdEncoding.EncodeToString(buf.Bytes())
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"pk": pkB64})
-	})
-
-	// ——— expose verifying key ———
-	http.HandleFunc("/vk", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(verifyingKey)
-	})
-
-	// ——— proof‐verification endpoint ———
-	http.HandleFunc("/prove", func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			ProofB64 string `json:"proof"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
-			return
-		}
-
-		// 2) Base64 → []byte
-		proofBytes, err := base64.StdEncoding.DecodeString(req.ProofB64)
-		if err != nil {
-			http.Error(w, "invalid proof encoding", http.StatusBadRequest)
-			return
-		}
+		log.Fatal(err)
+	}
+	if fp, err := tlsutil.Fingerprint(tlsOpts.CertFile); err == nil {
+		log.Printf("HTTPS certificate fingerprint (for -pin): %s", fp)
+	}
 
-		// 3) Allocate an empty Proof of the right curve type
-		proof := groth16.NewProof(ecc.BN254)
+	if manifestKey, err = manifest.LoadOrCreateKey(*manifestKeyPath); err != nil {
+		log.Fatalf("manifest key: %v", err)
+	}
+	if attrKey, err = attrs.LoadOrCreateKey(*attrKeyPath, zkCurve); err != nil {
+		log.Fatalf("attribute key: %v", err)
+	}
+	if err := loadAdminToken(*adminTokenPath); err != nil {
+		log.Fatalf("admin token: %v", err)
+	}
 
-		buf := bytes.NewBuffer(proofBytes)
-		if _, err := proof.ReadFrom(buf); err != nil {
-			http.Error(w, "invalid proof format", http.StatusBadRequest)
-			return
-		}
-		// build a public witness with just Y
-		assignment := Circuit{Y: expectedY}
-		pubWit, err := frontend.NewWitness(
-			&assignment,
-			ecc.BN254.ScalarField(),
-			frontend.PublicOnly(),
-		)
-		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
-			return
-		}
-		// verify
-		if err := groth16.Verify(proof, verifyingKey, pubWit); err != nil {
-			http.Error(w, "forbidden", http.StatusForbidden)
-			return
+	if *tcpAddr == "" && *udpAddr == "" {
+		log.Fatal("at least one of -tcp and -udp is needed")
+	}
+	srv := ZKKDC(*httpAddr, tlsConfig)
+	if *udpAddr != "" {
+		go func() { log.Fatal(serveUDP(*udpAddr)) }()
+	}
+	if *tcpAddr != "" {
+		go func() { log.Fatal(serveTCP(*tcpAddr)) }()
+	}
+	var grpcSrv *grpc.Server
+	if *grpcAddr != "" {
+		if grpcSrv, err = serveGRPC(*grpcAddr, tlsConfig); err != nil {
+			log.Fatalf("grpc: %v", err)
 		}
+	}
+
+	// run until told to stop, then let in-flight HTTPS requests finish
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	<-ctx.Done()
+	stop()
+	log.Printf("shutting down; draining HTTPS requests")
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		log.Printf("shutdown: %v", err)
+	}
+	if grpcSrv != nil {
+		stopped := make(chan struct{})
+		go func() { grpcSrv.GracefulStop(); close(stopped) }()
 		select {
-		case <-proofOK:
-		default:
-			close(proofOK)
+		case <-stopped:
+		case <-ctx.Done():
+			grpcSrv.Stop()
 		}
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "OK")
+	}
+}
 
-	})
+// ZKKDC sets up the circuit keys and serves them, proof checks and the
+// KDC proxy over HTTPS on addr.
+func ZKKDC(addr string, tlsConfig *tls.Config) *http.Server {
 
-	srv := &http.Server{
-		Addr:    ":8081",
-		Handler: mux,
+	// ——— compile + trusted setup ———
+	if err := setupCircuit(circuitID, &Circuit{}, "Salt", "Commitment", "Challenge"); err != nil {
+		log.Fatal(err)
+	}
+	if err := setupCircuit(groupCircuitID, &GroupCircuit{}, "Root", "Nullifier", "Challenge"); err != nil {
+		log.Fatal(err)
 	}
+	if err := setupCircuit(attrCircuitID, &AttrCircuit{}, "PublicKey", "Principal", "Op", "Value", "Challenge"); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("🔑 Setup complete; server listening on https %s", addr)
 
+	srv := &http.Server{
+		Addr:              addr,
+		Handler:           newRouter(),
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       time.Minute,
+	}
 	go func() {
-		log.Fatal(http.ListenAndServe(":8081", nil))
+		if err := srv.ListenAndServeTLS("", ""); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
 	}()
-	<-proofOK
-
-	// 6) gracefully shut down the HTTP server
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("HTTP shutdown error: %v", err)
-	}
-
+	return srv
 }
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/manifest"
+)
+
+var (
+	// manifestKey signs the manifests we publish; clients pin its public
+	// half.
+	manifestKey ed25519.PrivateKey
+	// manifestValidity is how long one generation of circuit keys, and
+	// the manifest signed for it at setup, stays valid.
+	manifestValidity = 30 * 24 * time.Hour
+)
+
+// describeKeys returns the manifest of the circuit id and the keys set up
+// for it, hashed as served: tagged with their curve. Validity is filled
+// in when it is signed.
+func describeKeys(id string, cs, pk, vk io.WriterTo) (manifest.Manifest, error) {
+	hash := func(w io.WriterTo) (string, error) {
+		b, err := serialize(w)
+		if err != nil {
+			return "", err
+		}
+		return manifest.Hash(b), nil
+	}
+	m := manifest.Manifest{
+		CircuitID: id,
+		Backend:   "groth16",
+		Curve:     zkCurve.String(),
+		NotBefore: time.Now().UTC().Truncate(time.Second),
+	}
+	var err error
+	if m.CircuitHash, err = hash(cs); err != nil {
+		return m, err
+	}
+	if m.PKHash, err = hash(pk); err != nil {
+		return m, err
+	}
+	if m.VKHash, err = hash(vk); err != nil {
+		return m, err
+	}
+	return m, nil
+}
+
+// handleManifest serves a circuit's key manifest, as signed when its keys
+// were set up.
+func handleManifest(w http.ResponseWriter, r *http.Request) {
+	c, ok := requestCircuit(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, c.signed)
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/commitment"
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+)
+
+// changePassword replaces principal's commitment once the client has
+// proved knowledge of the current password over a live challenge. The
+// proof is bound to the new salt and commitment, and the change only
+// lands if the principal is still at the kvno the proof was made for.
+func changePassword(req kdcapi.PasswordChangeRequest, source string) (principalRecord, error) {
+	if err := consumeChallenge(req.Principal, req.Challenge); err != nil {
+		return principalRecord{}, err
+	}
+	rec, ok := lookupPrincipal(req.Principal)
+	if !ok {
+		return principalRecord{}, errUnknownPrincipal
+	}
+	if rec.KVNO != req.KVNO {
+		return principalRecord{}, errPrincipalStale
+	}
+	binding := kdcapi.PasswordChangeBinding(req.Challenge, req.NewSalt, req.NewCommitment)
+	err := guardProof(req.Principal, source, func() error {
+		return verifyRecordProof(req.Principal, rec, req.Proof, binding)
+	})
+	if err != nil {
+		return principalRecord{}, err
+	}
+	return changeCommitment(req.Principal, rec.KVNO, req.NewSalt, req.NewCommitment, req.RevokeTickets)
+}
+
+func handlePasswordChange(w http.ResponseWriter, r *http.Request) {
+	var req kdcapi.PasswordChangeRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if len(req.NewSalt) != commitment.SaltSize || len(req.NewCommitment) != 32 {
+		writeError(w, http.StatusBadRequest, kdcapi.CodeBadRequest, "new_salt must be 16 bytes and new_commitment 32")
+		return
+	}
+	rec, err := changePassword(req, sourceOf(r.RemoteAddr))
+	if errors.Is(err, errPrincipalStale) {
+		writeError(w, http.StatusConflict, kdcapi.CodeConflict, "principal changed since the challenge; start over")
+		return
+	}
+	if writeProofError(w, err) {
+		return
+	}
+	log.Printf("🔑 %s changed password, kvno %d", req.Principal, rec.KVNO)
+	if req.RevokeTickets {
+		log.Printf("🔑 revoked TGTs of %s issued up to %s", req.Principal, rec.TicketsRevoked.Format("15:04:05"))
+	}
+	writeJSON(w, http.StatusOK, kdcapi.PasswordChangeResult{
+		Principal:      req.Principal,
+		KVNO:           rec.KVNO,
+		TicketsRevoked: req.RevokeTickets,
+	})
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/commitment"
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+)
+
+// enrollmentTTL is how long an admin-issued enrollment token stays usable.
+const enrollmentTTL = 24 * time.Hour
+
+var (
+	errPrincipalExists = errors.New("principal already exists")
+	errPrincipalName   = errors.New("invalid principal name")
+	errEnrollment      = errors.New("enrollment refused")
+	errPrincipalStale  = errors.New("principal changed concurrently")
+)
+
+// principalNameRE is what we accept as a user principal name.
+var principalNameRE = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}$`)
+
+// principalRecord is what we keep for a user: the salt and commitment of
+// their password, never the password itself. Until the user enrolls, it
+// holds only the hash of their enrollment token.
+//
+// KVNO counts the commitments the principal has had. TGTs authenticated
+// at or before TicketsRevoked are no longer honoured. No proofs are
+// verified until LockedUntil; the failures leading up to a lockout are
+// only counted in memory (see recordProof).
+type principalRecord struct {
+	Salt           []byte    `json:"salt,omitempty"`
+	Commitment     []byte    `json:"commitment,omitempty"`
+	KVNO           int       `json:"kvno,omitempty"`
+	TicketsRevoked time.Time `json:"tickets_revoked,omitzero"`
+	LockedUntil    time.Time `json:"locked_until,omitzero"`
+
+	EnrollTokenHash []byte    `json:"enroll_token_hash,omitempty"`
+	EnrollExpires   time.Time `json:"enroll_expires,omitzero"`
+}
+
+func (r principalRecord) enrolled() bool { return len(r.Commitment) > 0 }
+
+// principals is the principal database, keyed by principal name, and the
+// file it is kept in.
+var principals = struct {
+	sync.RWMutex
+	m    map[string]principalRecord
+	path string
+}{m: map[string]principalRecord{}}
+
+// principalFile is the principal database on disk. Curve is the curve
+// whose scalar field the commitments are in; files from before it was
+// recorded are just the map of records, and over BN254.
+type principalFile struct {
+	Curve      string                     `json:"curve"`
+	Principals map[string]principalRecord `json:"principals"`
+}
+
+// decodeStrict is json.Unmarshal refusing unknown fields, which tells our
+// files from the bare maps they used to be.
+func decodeStrict(b []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// loadPrincipals reads the principal database, which must be over zkCurve.
+// A missing file is an empty database.
+func loadPrincipals(path string) error {
+	principals.Lock()
+	defer principals.Unlock()
+	principals.path = path
+
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var f principalFile
+	if err := decodeStrict(b, &f); err != nil || f.Curve == "" {
+		f = principalFile{}
+		if err := json.Unmarshal(b, &f.Principals); err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	if err := checkFileCurve(path, f.Curve); err != nil {
+		return err
+	}
+	if f.Principals != nil {
+		principals.m = f.Principals
+	}
+	return nil
+}
+
+// savePrincipalsLocked writes the database out atomically. The caller
+// holds principals' lock.
+func savePrincipalsLocked() error {
+	b, err := json.MarshalIndent(principalFile{zkCurve.String(), principals.m}, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(principals.path), ".principals-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), principals.path)
+}
+
+// lookupPrincipal returns the record of an enrolled principal.
+func lookupPrincipal(name string) (principalRecord, bool) {
+	principals.RLock()
+	defer principals.RUnlock()
+	rec, ok := principals.m[name]
+	return rec, ok && rec.enrolled()
+}
+
+// principalExists reports whether name is in the database, enrolled or
+// not.
+func principalExists(name string) bool {
+	principals.RLock()
+	defer principals.RUnlock()
+	_, ok := principals.m[name]
+	return ok
+}
+
+// createPrincipal adds a principal that has yet to enroll and returns the
+// one-time token the user enrolls with. A pending principal whose token
+// has expired is replaced, so an admin can issue a new token.
+func createPrincipal(name string) (string, time.Time, error) {
+	if _, ok := keytab[name]; ok || !principalNameRE.MatchString(name) {
+		return "", time.Time{}, errPrincipalName
+	}
+	raw := make([]byte, 24)
+	if _, err := rand.Read(raw); err != nil {
+		return "", time.Time{}, err
+	}
+	token := base64.RawURLEncoding.EncodeToString(raw)
+	hash := sha256.Sum256([]byte(token))
+	expires := time.Now().Add(enrollmentTTL).UTC().Truncate(time.Second)
+
+	principals.Lock()
+	defer principals.Unlock()
+	old, ok := principals.m[name]
+	if ok && (old.enrolled() || time.Now().Before(old.EnrollExpires)) {
+		return "", time.Time{}, errPrincipalExists
+	}
+	principals.m[name] = principalRecord{EnrollTokenHash: hash[:], EnrollExpires: expires}
+	if err := savePrincipalsLocked(); err != nil {
+		if ok {
+			principals.m[name] = old
+		} else {
+			delete(principals.m, name)
+		}
+		return "", time.Time{}, err
+	}
+	return token, expires, nil
+}
+
+// enrollPrincipal sets the commitment of a principal created by an admin,
+// if token is its enrollment token.
+func enrollPrincipal(name, token string, salt, commit []byte) error {
+	if len(salt) != commitment.SaltSize || len(commit) != 32 {
+		return fmt.Errorf("%w: malformed salt or commitment", errEnrollment)
+	}
+	hash := sha256.Sum256([]byte(token))
+
+	principals.Lock()
+	defer principals.Unlock()
+	rec, ok := principals.m[name]
+	switch {
+	case !ok, rec.enrolled(), subtle.ConstantTimeCompare(hash[:], rec.EnrollTokenHash) != 1:
+		return fmt.Errorf("%w: no pending enrollment for %s with that token", errEnrollment, name)
+	case time.Now().After(rec.EnrollExpires):
+		return fmt.Errorf("%w: enrollment token expired", errEnrollment)
+	}
+	principals.m[name] = principalRecord{Salt: salt, Commitment: commit, KVNO: 1}
+	if err := savePrincipalsLocked(); err != nil {
+		principals.m[name] = rec
+		return err
+	}
+	return nil
+}
+
+// changeCommitment replaces the commitment of an enrolled principal whose
+// record is still at kvno, bumping the kvno, and if revoke is set revokes
+// every TGT issued so far. It returns the new record.
+func changeCommitment(name string, kvno int, salt, commit []byte, revoke bool) (principalRecord, error) {
+	if len(salt) != commitment.SaltSize || len(commit) != 32 {
+		return principalRecord{}, errors.New("malformed salt or commitment")
+	}
+
+	principals.Lock()
+	defer principals.Unlock()
+	old, ok := principals.m[name]
+	if !ok || !old.enrolled() {
+		return principalRecord{}, errUnknownPrincipal
+	}
+	if old.KVNO != kvno {
+		return principalRecord{}, errPrincipalStale
+	}
+	rec := principalRecord{Salt: salt, Commitment: commit, KVNO: old.KVNO + 1, TicketsRevoked: old.TicketsRevoked}
+	if revoke {
+		rec.TicketsRevoked = time.Now().UTC().Truncate(time.Second)
+	}
+	principals.m[name] = rec
+	if err := savePrincipalsLocked(); err != nil {
+		principals.m[name] = old
+		return principalRecord{}, err
+	}
+	return rec, nil
+}
+
+// tgtRevoked reports whether a TGT for name authenticated at authTime has
+// been revoked by a password change. Ticket times carry whole seconds, so
+// a TGT from the second of the change counts as revoked.
+func tgtRevoked(name string, authTime time.Time) bool {
+	rec, ok := lookupPrincipal(name)
+	return ok && !rec.TicketsRevoked.IsZero() && !authTime.After(rec.TicketsRevoked)
+}
+
+// lockPrincipal locks name out everywhere for lockoutDuration and
+// writes the lockout to the database, so it outlasts a restart. It
+// reports whether name was enrolled and so could be locked.
+func lockPrincipal(name string) (bool, error) {
+	principals.Lock()
+	defer principals.Unlock()
+	old, ok := principals.m[name]
+	if !ok || !old.enrolled() {
+		return false, nil
+	}
+	rec := old
+	rec.LockedUntil = time.Now().Add(lockoutDuration).UTC().Truncate(time.Second)
+	principals.m[name] = rec
+	if err := savePrincipalsLocked(); err != nil {
+		principals.m[name] = old
+		return false, err
+	}
+	return true, nil
+}
+
+// lockedPrincipals lists the principals locked out everywhere at now.
+func lockedPrincipals(now time.Time) []kdcapi.Lockout {
+	principals.RLock()
+	defer principals.RUnlock()
+	var locked []kdcapi.Lockout
+	for name, rec := range principals.m {
+		if now.Before(rec.LockedUntil) {
+			locked = append(locked, kdcapi.Lockout{Principal: name, Until: rec.LockedUntil})
+		}
+	}
+	slices.SortFunc(locked, func(a, b kdcapi.Lockout) int { return strings.Compare(a.Principal, b.Principal) })
+	return locked
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/consensys/gnark/frontend"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+)
+
+// circuitID names the circuit proofs are checked against (must match client).
+const circuitID = "mimc-pw-v1"
+
+var (
+	errProofFormat   = errors.New("invalid proof format")
+	errProofRejected = errors.New("proof does not verify")
+	errProofReplayed = errors.New("replayed proof")
+
+	errUnknownPrincipal = errors.New("unknown principal")
+)
+
+// verifyProof checks a serialized Groth16 proof for the given challenge
+// binding against the verifying key and records the binding in the replay
+// cache, so each challenge is answered only once.
+func verifyProof(principal string, proofBytes, challenge []byte) error {
+	rec, ok := lookupPrincipal(principal)
+	if !ok {
+		return errUnknownPrincipal
+	}
+	return verifyRecordProof(principal, rec, proofBytes, challenge)
+}
+
+// verifyRecordProof is verifyProof against a record the caller looked up.
+func verifyRecordProof(principal string, rec principalRecord, proofBytes, challenge []byte) error {
+	proof, err := readProof(proofBytes)
+	if err != nil {
+		return err
+	}
+	// build a public witness from the principal's record and the challenge
+	input := challengeInput(challenge)
+	assignment := Circuit{
+		Salt:       new(big.Int).SetBytes(rec.Salt),
+		Commitment: new(big.Int).SetBytes(rec.Commitment),
+		Challenge:  input,
+	}
+	pubWit, err := frontend.NewWitness(
+		&assignment,
+		zkCurve.ScalarField(),
+		frontend.PublicOnly(),
+	)
+	if err != nil {
+		return fmt.Errorf("public witness: %w", err)
+	}
+	if err := circuits[circuitID].verifier.Verify(proof, pubWit); err != nil {
+		return errProofRejected
+	}
+
+	// reject a second proof over the same challenge binding. The key is
+	// the public input, not the proof: anyone can re-randomize a Groth16
+	// proof into new bytes that still verify. Nor is it the principal the
+	// caller names, which would let a proof be replayed under another name.
+	err = replayCache.Check(replay.Key{
+		Principal: circuitID,
+		Timestamp: time.Now(),
+		Nonce:     input.Text(16),
+	})
+	if errors.Is(err, replay.ErrReplay) {
+		return errProofReplayed
+	}
+	return err
+}
+
+// verifyChallengeProof checks a proof submitted outside the AS exchange.
+// Its public challenge input must be a live challenge issued to principal,
+// which is used up whether or not the proof verifies.
+func verifyChallengeProof(principal, source string, proofBytes, challenge []byte) error {
+	if err := consumeChallenge(principal, challenge); err != nil {
+		return err
+	}
+	return guardProof(principal, source, func() error {
+		return verifyProof(principal, proofBytes, challenge)
+	})
+}
+
+// challengeInput reduces a challenge binding into zkCurve's scalar field.
+func challengeInput(binding []byte) *big.Int {
+	return new(big.Int).Mod(new(big.Int).SetBytes(binding), zkCurve.ScalarField())
+}
+
+// checkPAZK verifies the answer to a PA-ZK challenge, and any PA-ZK-ATTR
+// claims sent with it, and completes the DH exchange. It returns the AS
+// reply key, the PA-ZK reply padata and the authorization data the proofs
+// earned.
+func checkPAZK(cname, source string, pas []krb.PAData) ([]byte, krb.PAData, []krb.AuthData, error) {
+	pa, _ := krb.FindPAData(pas, krb.PAZK)
+	var z krb.PAZKReq
+	if err := krb.ParsePAZK(pa, &z); err != nil {
+		return nil, krb.PAData{}, nil, err
+	}
+	if _, ok := circuits[z.CircuitID]; !ok {
+		return nil, krb.PAData{}, nil, krb.NewError(krb.ErrPreauthFailed, "unknown circuit "+z.CircuitID)
+	}
+	if err := consumeChallenge(cname, z.Challenge); err != nil {
+		return nil, krb.PAData{}, nil, krb.NewError(krb.ErrPreauthFailed, err.Error())
+	}
+
+	var authz []krb.AuthData
+	binding := krb.ZKBinding(z.Challenge, z.DHPublic)
+	err := guardProof(cname, source, func() (err error) {
+		switch z.CircuitID {
+		case circuitID:
+			err = verifyProof(cname, z.Proof, binding)
+		case groupCircuitID:
+			authz, err = verifyGroupProof(cname, z, binding)
+		default:
+			err = fmt.Errorf("%w: circuit %s is not for logging in", errProofFormat, z.CircuitID)
+		}
+		return err
+	})
+	// claims are checked once the password proof is good, outside
+	// guardProof: a claim that fails says nothing about the password, so
+	// must not count towards a lockout
+	if apa, ok := krb.FindPAData(pas, krb.PAZKAttr); ok && err == nil && z.CircuitID == circuitID {
+		authz, err = verifyClaims(cname, apa, binding)
+	}
+	switch {
+	case errors.Is(err, errLockedOut):
+		return nil, krb.PAData{}, nil, krb.NewError(krb.ErrClientRevoked, err.Error())
+	case errors.Is(err, errRateLimited):
+		return nil, krb.PAData{}, nil, krb.NewError(krb.ErrGeneric, err.Error())
+	case errors.Is(err, errProofReplayed):
+		return nil, krb.PAData{}, nil, krb.NewError(krb.ErrRepeat, err.Error())
+	case errors.Is(err, errUnknownPrincipal):
+		return nil, krb.PAData{}, nil, krb.NewError(krb.ErrCPrincipalUnknown, err.Error())
+	case errors.Is(err, errProofFormat), errors.Is(err, errProofRejected), errors.Is(err, errUnknownGroup):
+		return nil, krb.PAData{}, nil, krb.NewError(krb.ErrPreauthFailed, err.Error())
+	case err != nil:
+		return nil, krb.PAData{}, nil, err
+	}
+
+	priv, pub, err := krb.NewDHKey()
+	if err != nil {
+		return nil, krb.PAData{}, nil, err
+	}
+	replyKey, err := krb.DHReplyKey(priv, z.DHPublic)
+	if err != nil {
+		return nil, krb.PAData{}, nil, err
+	}
+	repPA, err := krb.NewPAZK(krb.PAZKRep{DHPublic: pub})
+	return replyKey, repPA, authz, err
+}
@@ -0,0 +1,349 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// Verifying a proof is the most expensive thing the KDC does, and the
+// only thing between a guesser and a user's password. So each source gets
+// a bucket of proofRate verifications a second, and failed proofs put the
+// source, and the principal at that source, into exponential backoff.
+//
+// Anyone can get a challenge for any principal and send a proof for it,
+// so a guesser at one address must not hold the user off everywhere.
+// Only proofs that don't verify count against a principal, not malformed
+// ones, and they hold it off only at the source they came from until they
+// come from backoffSources sources; then the principal backs off
+// everywhere. A principal failing lockoutThreshold proofs in a row from
+// one source is locked out of that source for lockoutDuration. Only after
+// principalLockoutThreshold failures in a row from any sources is it
+// locked out everywhere, and only that lockout is kept in the principal
+// database; the counts are kept in memory.
+var (
+	proofRate                 = 2.0
+	proofBurst                = 10
+	lockoutThreshold          = 10
+	principalLockoutThreshold = 100
+	lockoutDuration           = 15 * time.Minute
+)
+
+const (
+	backoffFree    = 3 // failures before backoff starts
+	backoffBase    = time.Second
+	backoffMax     = 5 * time.Minute
+	backoffSources = 3 // sources a principal fails from before it backs off everywhere
+)
+
+var (
+	errRateLimited = errors.New("too many proofs")
+	errLockedOut   = errors.New("principal locked out")
+)
+
+// throttleError is errRateLimited or errLockedOut with how long to wait.
+type throttleError struct {
+	err        error
+	retryAfter time.Duration
+}
+
+func (e *throttleError) Error() string {
+	return fmt.Sprintf("%v; retry in %s", e.err, (e.retryAfter + time.Second - 1).Truncate(time.Second))
+}
+
+func (e *throttleError) Unwrap() error { return e.err }
+
+// limit is what we remember of one source or principal.
+type limit struct {
+	tokens   float64
+	refilled time.Time
+	failures int       // consecutive failed proofs
+	until    time.Time // no proofs are verified before this
+}
+
+// pairLimit is what we remember of one principal's proofs from one
+// source.
+type pairLimit struct {
+	failures int       // consecutive failed proofs
+	failed   time.Time // the last of them
+	until    time.Time // backing off until
+	locked   time.Time // locked out until
+}
+
+// failures counts a principal's failed proofs in a row from any source,
+// and the distinct sources they came from, up to backoffSources.
+type failures struct {
+	count   int
+	sources map[string]bool
+	last    time.Time
+}
+
+// limits holds the limits of sources, by address, and of principals, which
+// only back off once they fail from backoffSources sources. pairs holds,
+// by pairKey, each principal's limit at each source, and failed each
+// principal's failures since it last got a proof through.
+var limits = struct {
+	sync.Mutex
+	sources    map[string]*limit
+	principals map[string]*limit
+	pairs      map[string]*pairLimit
+	failed     map[string]*failures
+	pruned     time.Time
+}{sources: map[string]*limit{}, principals: map[string]*limit{}, pairs: map[string]*pairLimit{}, failed: map[string]*failures{}}
+
+// pairKey is the key in limits.pairs of principal's proofs from source.
+func pairKey(principal, source string) string {
+	return principal + "\x00" + source
+}
+
+// proofStats counts the fate of proofs, for operators.
+var proofStats struct {
+	accepted, failed, rateLimited, lockedOut, lockouts atomic.Int64
+}
+
+// sourceOf is the host of a remote address, which is what we limit.
+func sourceOf(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+	return host
+}
+
+// backoff is how long to hold off after failures consecutive failures.
+func backoff(failures int) time.Duration {
+	n := failures - backoffFree
+	switch {
+	case n < 0:
+		return 0
+	case n > 20:
+		return backoffMax
+	}
+	return min(backoffBase<<n, backoffMax)
+}
+
+// getLimitLocked returns the limit for key in m, creating it with a full
+// bucket. The caller holds limits' lock.
+func getLimitLocked(m map[string]*limit, key string, now time.Time) *limit {
+	l, ok := m[key]
+	if !ok {
+		l = &limit{tokens: float64(proofBurst), refilled: now}
+		m[key] = l
+	}
+	return l
+}
+
+// pruneLimitsLocked forgets limits that are back to their initial state,
+// at most once a minute. The caller holds limits' lock.
+func pruneLimitsLocked(now time.Time) {
+	if now.Sub(limits.pruned) < time.Minute {
+		return
+	}
+	limits.pruned = now
+	idle := time.Duration(float64(proofBurst)/proofRate*float64(time.Second)) + backoffMax
+	for _, m := range []map[string]*limit{limits.sources, limits.principals} {
+		for k, l := range m {
+			if now.Sub(l.refilled) > idle && now.Sub(l.until) > backoffMax {
+				delete(m, k)
+			}
+		}
+	}
+	for k, p := range limits.pairs {
+		if now.Sub(p.failed) > lockoutDuration && now.After(p.until) && now.After(p.locked) {
+			delete(limits.pairs, k)
+		}
+	}
+	for k, f := range limits.failed {
+		if now.Sub(f.last) > lockoutDuration {
+			delete(limits.failed, k)
+		}
+	}
+}
+
+// admitProof decides whether to verify a proof for principal from source
+// now, and if so takes it from source's bucket.
+func admitProof(principal, source string) error {
+	now := time.Now()
+	if rec, ok := lookupPrincipal(principal); ok && now.Before(rec.LockedUntil) {
+		proofStats.lockedOut.Add(1)
+		return &throttleError{errLockedOut, rec.LockedUntil.Sub(now)}
+	}
+
+	limits.Lock()
+	defer limits.Unlock()
+	pruneLimitsLocked(now)
+	pair := limits.pairs[pairKey(principal, source)]
+	if pair != nil && now.Before(pair.locked) {
+		proofStats.lockedOut.Add(1)
+		return &throttleError{errLockedOut, pair.locked.Sub(now)}
+	}
+	s := getLimitLocked(limits.sources, source, now)
+	s.tokens = min(s.tokens+now.Sub(s.refilled).Seconds()*proofRate, float64(proofBurst))
+	s.refilled = now
+
+	wait := s.until.Sub(now)
+	if pair != nil {
+		wait = max(wait, pair.until.Sub(now))
+	}
+	// anonymous logins are limited by source alone, or one guesser could
+	// shut every group out
+	if p := limits.principals[principal]; p != nil && principal != krb.Anonymous {
+		wait = max(wait, p.until.Sub(now))
+	}
+	if wait <= 0 && s.tokens < 1 {
+		wait = time.Duration((1 - s.tokens) / proofRate * float64(time.Second))
+	}
+	if wait > 0 {
+		proofStats.rateLimited.Add(1)
+		return &throttleError{errRateLimited, wait}
+	}
+	s.tokens--
+	return nil
+}
+
+// recordProof books the outcome of verifying a proof for principal from
+// source. Only proofs that fail count against them, and of those only the
+// ones that don't verify against an enrolled principal: a malformed proof
+// says nothing about its principal's password. Only enrolled principals
+// are ever locked out.
+func recordProof(principal, source string, err error) {
+	rejected := errors.Is(err, errProofRejected)
+	failed := rejected || errors.Is(err, errProofFormat)
+	if err != nil && !failed {
+		return
+	}
+	if failed {
+		proofStats.failed.Add(1)
+	} else {
+		proofStats.accepted.Add(1)
+	}
+	_, enrolled := lookupPrincipal(principal)
+
+	now := time.Now()
+	pairLocked, lockEverywhere := false, false
+	limits.Lock()
+	if s := limits.sources[source]; s != nil {
+		if failed {
+			s.failures++
+			s.until = now.Add(backoff(s.failures))
+		} else {
+			s.failures, s.until = 0, time.Time{}
+		}
+	}
+	key := pairKey(principal, source)
+	switch {
+	case !enrolled:
+	case err == nil:
+		delete(limits.pairs, key)
+		delete(limits.failed, principal)
+		delete(limits.principals, principal)
+	case rejected:
+		p, ok := limits.pairs[key]
+		if !ok {
+			p = &pairLimit{}
+			limits.pairs[key] = p
+		}
+		p.failures++
+		p.failed = now
+		p.until = now.Add(backoff(p.failures))
+		if lockoutThreshold > 0 && p.failures >= lockoutThreshold {
+			p.failures, p.locked = 0, now.Add(lockoutDuration)
+			pairLocked = true
+		}
+
+		f, ok := limits.failed[principal]
+		if !ok {
+			f = &failures{sources: map[string]bool{}}
+			limits.failed[principal] = f
+		}
+		f.count++
+		f.last = now
+		if len(f.sources) < backoffSources {
+			f.sources[source] = true
+		}
+		if len(f.sources) >= backoffSources {
+			l := getLimitLocked(limits.principals, principal, now)
+			l.failures++
+			l.until = now.Add(backoff(l.failures))
+		}
+		if principalLockoutThreshold > 0 && f.count >= principalLockoutThreshold {
+			delete(limits.failed, principal)
+			lockEverywhere = true
+		}
+	}
+	limits.Unlock()
+
+	if pairLocked {
+		proofStats.lockouts.Add(1)
+		log.Printf("🔒 locked out %s from %s for %s after %d failed proofs", principal, source, lockoutDuration, lockoutThreshold)
+	}
+	if !lockEverywhere {
+		return
+	}
+	locked, err := lockPrincipal(principal)
+	if err != nil {
+		log.Printf("locking out %s: %v", principal, err)
+	}
+	if locked {
+		proofStats.lockouts.Add(1)
+		log.Printf("🔒 locked out %s for %s after %d failed proofs (last from %s)", principal, lockoutDuration, principalLockoutThreshold, source)
+	}
+}
+
+// guardProof runs verify, which checks a proof for principal sent from
+// source, unless either is being throttled, and books the outcome.
+func guardProof(principal, source string, verify func() error) error {
+	if err := admitProof(principal, source); err != nil {
+		return err
+	}
+	err := verify()
+	recordProof(principal, source, err)
+	return err
+}
+
+// handleStats serves the proof counters and who is being held off.
+func handleStats(w http.ResponseWriter, r *http.Request) {
+	now := time.Now()
+	stats := kdcapi.ProofStats{
+		Accepted:    proofStats.accepted.Load(),
+		Failed:      proofStats.failed.Load(),
+		RateLimited: proofStats.rateLimited.Load(),
+		LockedOut:   proofStats.lockedOut.Load(),
+		Lockouts:    proofStats.lockouts.Load(),
+		Locked:      lockedPrincipals(now),
+	}
+	limits.Lock()
+	for k, p := range limits.pairs {
+		if now.Before(p.locked) {
+			principal, source, _ := strings.Cut(k, "\x00")
+			stats.Locked = append(stats.Locked, kdcapi.Lockout{Principal: principal, Source: source, Until: p.locked.UTC()})
+		}
+	}
+	slices.SortFunc(stats.Locked, func(a, b kdcapi.Lockout) int {
+		return cmp.Or(strings.Compare(a.Principal, b.Principal), strings.Compare(a.Source, b.Source))
+	})
+	for _, m := range []struct {
+		m    map[string]*limit
+		list *[]kdcapi.Backoff
+	}{{limits.sources, &stats.Sources}, {limits.principals, &stats.Principals}} {
+		for k, l := range m.m {
+			if l.failures > 0 {
+				*m.list = append(*m.list, kdcapi.Backoff{Name: k, Failures: l.failures, Until: l.until.UTC()})
+			}
+		}
+		slices.SortFunc(*m.list, func(a, b kdcapi.Backoff) int { return strings.Compare(a.Name, b.Name) })
+	}
+	limits.Unlock()
+	writeJSON(w, http.StatusOK, stats)
+}
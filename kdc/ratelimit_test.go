@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// resetLimits gives a test fresh limits and a principal database holding
+// an enrolled alice, and puts both back when it is done.
+func resetLimits(t *testing.T) {
+	t.Helper()
+	limits.Lock()
+	limits.sources, limits.principals = map[string]*limit{}, map[string]*limit{}
+	limits.pairs, limits.failed = map[string]*pairLimit{}, map[string]*failures{}
+	limits.Unlock()
+
+	principals.Lock()
+	oldM, oldPath := principals.m, principals.path
+	principals.m = map[string]principalRecord{
+		"alice": {Salt: make([]byte, 16), Commitment: make([]byte, 32), KVNO: 1},
+	}
+	principals.path = filepath.Join(t.TempDir(), "principals.json")
+	principals.Unlock()
+	t.Cleanup(func() {
+		principals.Lock()
+		principals.m, principals.path = oldM, oldPath
+		principals.Unlock()
+	})
+}
+
+// sendProof has source send a proof for principal that fails with err, if
+// it is admitted, and returns what admitProof said.
+func sendProof(principal, source string, err error) error {
+	return guardProof(principal, source, func() error { return err })
+}
+
+func TestJunkFromOneSourceDoesNotHoldOthersOff(t *testing.T) {
+	resetLimits(t)
+	const attacker, user = "198.51.100.7", "203.0.113.5"
+
+	// a malformed proof and a wrong one every few minutes, sent as if
+	// spaced out past the attacker's own backoff
+	for i := range 2 * lockoutThreshold {
+		junk := errProofRejected
+		if i%2 == 0 {
+			junk = fmt.Errorf("%w: junk", errProofFormat)
+		}
+		if err := sendProof("alice", attacker, junk); !errors.Is(err, junk) && !errors.Is(err, errLockedOut) {
+			t.Fatalf("attempt %d: %v", i, err)
+		}
+		limits.Lock()
+		limits.sources[attacker].until = time.Time{}
+		limits.sources[attacker].tokens = float64(proofBurst)
+		if p := limits.pairs[pairKey("alice", attacker)]; p != nil {
+			p.until = time.Time{}
+		}
+		limits.Unlock()
+	}
+
+	if err := admitProof("alice", user); err != nil {
+		t.Fatalf("alice's own address held off by junk from another: %v", err)
+	}
+	if err := admitProof("alice", attacker); !errors.Is(err, errLockedOut) {
+		t.Errorf("attacker's address: got %v, want %v", err, errLockedOut)
+	}
+	if rec, _ := lookupPrincipal("alice"); !rec.LockedUntil.IsZero() {
+		t.Errorf("alice locked out everywhere until %s", rec.LockedUntil)
+	}
+}
+
+func TestMalformedProofsDoNotCountAgainstPrincipal(t *testing.T) {
+	resetLimits(t)
+	for i := range backoffSources + backoffFree + 1 {
+		sendProof("alice", fmt.Sprintf("198.51.100.%d", i), errProofFormat)
+	}
+	limits.Lock()
+	defer limits.Unlock()
+	if n := len(limits.pairs) + len(limits.failed) + len(limits.principals); n != 0 {
+		t.Errorf("malformed proofs left %d limits on alice", n)
+	}
+}
+
+func TestPrincipalBacksOffEverywhereAfterSeveralSources(t *testing.T) {
+	resetLimits(t)
+	const user = "203.0.113.5"
+	// the principal counts failures once they come from backoffSources
+	// sources, and backs off after backoffFree of them
+	for i := range backoffSources + backoffFree - 1 {
+		source := fmt.Sprintf("198.51.100.%d", i%backoffSources)
+		if err := sendProof("alice", source, errProofRejected); !errors.Is(err, errProofRejected) {
+			t.Fatalf("attempt %d from %s: %v", i, source, err)
+		}
+	}
+	if err := admitProof("alice", user); !errors.Is(err, errRateLimited) {
+		t.Errorf("after failures from %d sources: got %v, want %v", backoffSources, err, errRateLimited)
+	}
+
+	// the right password gets through once the backoff is over
+	limits.Lock()
+	limits.principals["alice"].until = time.Time{}
+	limits.Unlock()
+	if err := sendProof("alice", user, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := admitProof("alice", user); err != nil {
+		t.Errorf("after a good proof: %v", err)
+	}
+}
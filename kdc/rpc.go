@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcrpc"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/manifest"
+)
+
+// keyChunkSize is how much of the proving key goes in each streamed chunk.
+const keyChunkSize = 64 << 10
+
+// rpcServer implements the gRPC KDC service on the same core as the
+// Kerberos listeners and the HTTPS API.
+type rpcServer struct {
+	kdcrpc.UnimplementedKDCServer
+}
+
+// serveGRPC starts the gRPC service on addr over TLS.
+func serveGRPC(addr string, tlsConfig *tls.Config) (*grpc.Server, error) {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s := grpc.NewServer(grpc.Creds(credentials.NewTLS(tlsConfig)))
+	kdcrpc.RegisterKDCServer(s, rpcServer{})
+	log.Printf("KDC gRPC listening on %s", lis.Addr())
+	go func() {
+		if err := s.Serve(lis); err != nil {
+			log.Fatal(err)
+		}
+	}()
+	return s, nil
+}
+
+func (rpcServer) GetCircuit(ctx context.Context, _ *kdcrpc.GetCircuitRequest) (*kdcrpc.Circuit, error) {
+	c := circuitInfo(circuits[circuitID])
+	return &kdcrpc.Circuit{
+		CircuitId:    c.CircuitID,
+		Backend:      c.Backend,
+		Curve:        c.Curve,
+		PublicInputs: c.PublicInputs,
+		CircuitHash:  c.CircuitHash,
+		PkSha256:     c.PKHash,
+		VkSha256:     c.VKHash,
+	}, nil
+}
+
+func (rpcServer) GetProvingKey(_ *kdcrpc.GetProvingKeyRequest, stream grpc.ServerStreamingServer[kdcrpc.KeyChunk]) error {
+	key, err := serialize(circuits[circuitID].pk)
+	if err != nil {
+		return status.Error(codes.Internal, "failed to serialize key")
+	}
+	first := &kdcrpc.KeyChunk{TotalSize: int64(len(key)), Sha256: manifest.Hash(key)}
+	for off := 0; off < len(key); off += keyChunkSize {
+		chunk := first
+		if off > 0 {
+			chunk = &kdcrpc.KeyChunk{}
+		}
+		chunk.Offset = int64(off)
+		chunk.Data = key[off:min(off+keyChunkSize, len(key))]
+		if err := stream.Send(chunk); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (rpcServer) Challenge(ctx context.Context, req *kdcrpc.ChallengeRequest) (*kdcrpc.ChallengeReply, error) {
+	if req.GetPrincipal() == "" {
+		return nil, status.Error(codes.InvalidArgument, "principal is required")
+	}
+	if req.GetPrincipal() != krb.Anonymous {
+		if err := authenticateCaller(req.GetApReq(), req.GetPrincipal()); err != nil {
+			return nil, status.Error(codes.Unauthenticated, err.Error())
+		}
+	}
+	ch, err := issueChallenge(req.GetPrincipal(), rpcSource(ctx), false)
+	rec, _ := lookupPrincipal(req.GetPrincipal())
+	if errors.Is(err, errUnknownPrincipal) {
+		return nil, status.Error(codes.NotFound, "no such principal "+req.Principal)
+	}
+	if errors.Is(err, errTooManyChallenges) {
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, "failed to issue challenge")
+	}
+	return &kdcrpc.ChallengeReply{
+		Principal:   req.Principal,
+		CircuitId:   ch.CircuitID,
+		Challenge:   ch.Challenge,
+		ExpiresUnix: ch.Expires.Unix(),
+		Salt:        ch.Salt,
+		Kvno:        int32(rec.KVNO),
+	}, nil
+}
+
+func (rpcServer) SubmitProof(ctx context.Context, req *kdcrpc.ProofRequest) (*kdcrpc.ProofReply, error) {
+	err := verifyChallengeProof(req.Principal, rpcSource(ctx), req.Proof, req.Challenge)
+	switch {
+	case err == nil:
+		return &kdcrpc.ProofReply{Valid: true}, nil
+	case errors.Is(err, errLockedOut):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, errRateLimited):
+		return nil, status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, errUnknownPrincipal):
+		return nil, status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, errChallenge):
+		return nil, status.Error(codes.FailedPrecondition, err.Error())
+	case errors.Is(err, errProofFormat):
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errProofRejected):
+		return nil, status.Error(codes.PermissionDenied, "proof does not verify")
+	case errors.Is(err, errProofReplayed):
+		return nil, status.Error(codes.AlreadyExists, err.Error())
+	}
+	log.Printf("verifying proof: %v", err)
+	return nil, status.Error(codes.Internal, "internal error")
+}
+
+// AS and TGS answer like the Kerberos listeners: KDC errors are a
+// KRB-ERROR reply, not an RPC error.
+func (rpcServer) AS(ctx context.Context, req *kdcrpc.KerberosMessage) (*kdcrpc.KerberosMessage, error) {
+	return kerberosRPC(ctx, req, func(m *krb.Message) bool { return m.ASReq != nil }, "AS-REQ")
+}
+
+func (rpcServer) TGS(ctx context.Context, req *kdcrpc.KerberosMessage) (*kdcrpc.KerberosMessage, error) {
+	return kerberosRPC(ctx, req, func(m *krb.Message) bool { return m.TGSReq != nil }, "TGS-REQ")
+}
+
+func kerberosRPC(ctx context.Context, req *kdcrpc.KerberosMessage, ok func(*krb.Message) bool, want string) (*kdcrpc.KerberosMessage, error) {
+	m, err := krb.Unmarshal(req.GetDer())
+	if err != nil || !ok(m) {
+		return nil, status.Error(codes.InvalidArgument, "expected a DER "+want)
+	}
+	return &kdcrpc.KerberosMessage{Der: process(req.GetDer(), rpcSource(ctx))}, nil
+}
+
+// rpcSource is the address of the peer making the call in ctx.
+func rpcSource(ctx context.Context) string {
+	if p, ok := peer.FromContext(ctx); ok {
+		return sourceOf(p.Addr.String())
+	}
+	return ""
+}
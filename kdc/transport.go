@@ -0,0 +1,234 @@
+package main
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// maxUDPReply is the largest reply we send over UDP. Anything bigger is
+// answered with RESPONSE_TOO_BIG and the client retries over TCP.
+var maxUDPReply = 1465
+
+// lookasideTTL is how long we remember a reply for retransmissions, and
+// maxLookaside how many replies; once it is full, replies go uncached until
+// the sweep every lookasideSweep makes room.
+const (
+	lookasideTTL   = 2 * time.Minute
+	lookasideSweep = 30 * time.Second
+	maxLookaside   = 1 << 14
+)
+
+type cachedReply struct {
+	reply   []byte
+	expires time.Time
+}
+
+// lookaside maps a request to the reply we sent for it. A retransmitted
+// request, or the TCP retry of a request whose reply was too big for UDP,
+// gets the original reply instead of being processed (and rejected as a
+// replay) a second time. Errors that may not hold for a retry aren't kept
+// (see transient).
+var lookaside = struct {
+	sync.Mutex
+	m map[[sha256.Size]byte]cachedReply
+}{m: map[[sha256.Size]byte]cachedReply{}}
+
+// serveTCP accepts Kerberos over TCP: each message carries a 4-byte length
+// prefix, and a connection may carry any number of exchanges.
+func serveTCP(addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+	log.Printf("KDC listening on tcp %s", listener.Addr())
+	return acceptTCP(listener)
+}
+
+// acceptTCP serves Kerberos over TCP to every connection listener accepts.
+func acceptTCP(listener net.Listener) error {
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		if err != nil {
+			fmt.Println("Error accepting connection: ", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+
+		go handleConnection(conn) // Handle each connection in a goroutine
+	}
+}
+
+func handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	// AS and TGS exchanges
+	for {
+		req, err := krb.ReadFrame(conn)
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			fmt.Println("Error receiving KDC request:", err)
+			return
+		}
+		if err := krb.WriteFrame(conn, process(req, sourceOf(conn.RemoteAddr().String()))); err != nil {
+			fmt.Println("Error sending KDC reply:", err)
+			return
+		}
+	}
+}
+
+// serveUDP accepts Kerberos over UDP: one bare message per datagram.
+func serveUDP(addr string) error {
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer pc.Close()
+	log.Printf("KDC listening on udp %s", pc.LocalAddr())
+	return servePackets(pc)
+}
+
+// servePackets answers every Kerberos datagram pc receives.
+func servePackets(pc net.PacketConn) error {
+	buf := make([]byte, krb.MaxDatagram)
+	for {
+		n, from, err := pc.ReadFrom(buf)
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
+		if err != nil {
+			fmt.Println("Error receiving datagram:", err)
+			continue
+		}
+		req := append([]byte(nil), buf[:n]...)
+		go func() {
+			reply := process(req, sourceOf(from.String()))
+			if len(reply) > maxUDPReply {
+				if reply, err = marshalError(krb.NewError(krb.ErrResponseTooBig, "reply too big for UDP; use TCP")); err != nil {
+					fmt.Println("Error encoding KDC reply:", err)
+					return
+				}
+			}
+			if _, err := pc.WriteTo(reply, from); err != nil {
+				fmt.Println("Error sending KDC reply:", err)
+			}
+		}()
+	}
+}
+
+// process answers one encoded KDC request with an encoded reply, repeating
+// the earlier reply if the request is a retransmission. source is the
+// address it came from.
+func process(req []byte, source string) []byte {
+	key := sha256.Sum256(req)
+	now := time.Now()
+
+	lookaside.Lock()
+	c, ok := lookaside.m[key]
+	lookaside.Unlock()
+	if ok && now.Before(c.expires) {
+		return c.reply
+	}
+
+	m := handleMessage(req, source)
+	reply, err := krb.Marshal(m)
+	if err != nil {
+		fmt.Println("Error encoding KDC reply:", err)
+		reply, _ = marshalError(err)
+		return reply
+	}
+	if transient(m) {
+		return reply
+	}
+
+	lookaside.Lock()
+	if len(lookaside.m) < maxLookaside {
+		lookaside.m[key] = cachedReply{reply, now.Add(lookasideTTL)}
+	}
+	lookaside.Unlock()
+	return reply
+}
+
+// transient reports whether reply is an error a retry of the same request
+// might not get: being rate limited or locked out, too many challenges
+// pending, or any other generic failure. Replaying those from the
+// lookaside cache would hold a client to a stale error.
+func transient(reply *krb.Message) bool {
+	ke := reply.KRBError
+	return ke != nil && (ke.Code == krb.ErrGeneric || ke.Code == krb.ErrClientRevoked)
+}
+
+// sweepLookaside drops expired replies every lookasideSweep.
+func sweepLookaside() {
+	for range time.Tick(lookasideSweep) {
+		now := time.Now()
+		lookaside.Lock()
+		for k, c := range lookaside.m {
+			if now.After(c.expires) {
+				delete(lookaside.m, k)
+			}
+		}
+		lookaside.Unlock()
+	}
+}
+
+// handleMessage runs one AS or TGS exchange.
+func handleMessage(req []byte, source string) *krb.Message {
+	msg, err := krb.Unmarshal(req)
+	if err != nil {
+		fmt.Println("Error receiving KDC request:", err)
+		return errorMessage(krb.NewError(krb.ErrGeneric, "malformed request"))
+	}
+
+	var reply krb.Message
+	switch {
+	case msg.ASReq != nil:
+		reply.ASRep, err = handleASReq(msg.ASReq, source)
+		if err == nil {
+			fmt.Printf("Issued ticket for %s to %s\n", msg.ASReq.SName, msg.ASReq.CName)
+		}
+	case msg.TGSReq != nil:
+		reply.TGSRep, err = handleTGSReq(msg.TGSReq)
+		if err == nil {
+			fmt.Printf("Issued ticket for %s to %s\n", msg.TGSReq.SName, reply.TGSRep.CName)
+		}
+	default:
+		err = krb.NewError(krb.ErrGeneric, "expected AS-REQ or TGS-REQ")
+	}
+	if ke, ok := err.(*krb.KRBError); ok && ke.Code == krb.ErrPreauthRequired {
+		fmt.Printf("Sent pre-authentication challenge to %s\n", msg.ASReq.CName)
+		return errorMessage(err)
+	}
+	if err != nil {
+		fmt.Println("Error issuing ticket:", err)
+		return errorMessage(err)
+	}
+	return &reply
+}
+
+// errorMessage wraps err in a KRB-ERROR; errors that are not already
+// KRBErrors are reported as KRB_ERR_GENERIC.
+func errorMessage(err error) *krb.Message {
+	ke, ok := err.(*krb.KRBError)
+	if !ok {
+		ke = krb.NewError(krb.ErrGeneric, err.Error())
+	}
+	return &krb.Message{KRBError: ke}
+}
+
+func marshalError(err error) ([]byte, error) {
+	return krb.Marshal(errorMessage(err))
+}
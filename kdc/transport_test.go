@@ -0,0 +1,189 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+)
+
+// useKeytab gives a test a keytab holding the TGS and serv, and an empty
+// replay cache, and puts the KDC's back when it is done.
+func useKeytab(t *testing.T) {
+	t.Helper()
+	oldKeytab, oldCache := keytab, replayCache
+	keytab = krb.Keytab{}
+	if _, err := keytab.Ensure(krb.TGS, "serv"); err != nil {
+		t.Fatal(err)
+	}
+	rc, err := replay.Open("", replay.DefaultWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayCache = rc
+	t.Cleanup(func() { keytab, replayCache = oldKeytab, oldCache })
+}
+
+// countingListener counts the connections it accepts.
+type countingListener struct {
+	net.Listener
+	accepted atomic.Int32
+}
+
+func (l *countingListener) Accept() (net.Conn, error) {
+	c, err := l.Listener.Accept()
+	if err == nil {
+		l.accepted.Add(1)
+	}
+	return c, err
+}
+
+// listenKDC serves Kerberos over UDP and TCP on one loopback port, as
+// clients expect, and returns its address and the TCP listener.
+func listenKDC(t *testing.T) (string, *countingListener) {
+	t.Helper()
+	for range 10 {
+		tl, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		pc, err := net.ListenPacket("udp", tl.Addr().String())
+		if err != nil {
+			tl.Close() // the UDP port is taken; try another
+			continue
+		}
+		l := &countingListener{Listener: tl}
+		t.Cleanup(func() { l.Close(); pc.Close() })
+		go acceptTCP(l)
+		go servePackets(pc)
+		return tl.Addr().String(), l
+	}
+	t.Fatal("no port free for both UDP and TCP")
+	return "", nil
+}
+
+func TestUDPFallsBackToTCP(t *testing.T) {
+	useKeytab(t)
+	addr, tcp := listenKDC(t)
+	entry, err := keytab.Lookup("serv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kdc, err := krb.DialKDCUDP(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer kdc.Close()
+	if _, err := kdc.AS("serv", krb.TGS, entry); err != nil {
+		t.Fatalf("AS over UDP: %v", err)
+	}
+	if n := tcp.accepted.Load(); n != 0 {
+		t.Fatalf("a reply that fits in UDP went over TCP (%d connections)", n)
+	}
+
+	old := maxUDPReply
+	maxUDPReply = 64
+	defer func() { maxUDPReply = old }()
+	cred, err := kdc.AS("serv", krb.TGS, entry)
+	if err != nil {
+		t.Fatalf("AS with a reply too big for UDP: %v", err)
+	}
+	if cred.Client != "serv" {
+		t.Errorf("got a ticket for %s, want serv", cred.Client)
+	}
+	if n := tcp.accepted.Load(); n != 1 {
+		t.Errorf("RESPONSE_TOO_BIG retried over %d TCP connections, want 1", n)
+	}
+}
+
+// asReq encodes an AS-REQ from cname for the TGS with padata pas.
+func asReq(t *testing.T, cname string, pas ...krb.PAData) []byte {
+	t.Helper()
+	nonce, err := krb.NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, err := krb.Marshal(&krb.Message{ASReq: &krb.ASReq{CName: cname, SName: krb.TGS, Nonce: nonce, PAData: pas}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return der
+}
+
+// cached reports whether the lookaside cache holds a reply to req.
+func cached(req []byte) bool {
+	lookaside.Lock()
+	defer lookaside.Unlock()
+	_, ok := lookaside.m[sha256.Sum256(req)]
+	return ok
+}
+
+func TestLookasideKeepsReplies(t *testing.T) {
+	useKeytab(t)
+	resetLimits(t)
+
+	// a retransmitted request for a challenge gets the same challenge
+	req := asReq(t, "alice")
+	first := process(req, "192.0.2.1")
+	m, err := krb.Unmarshal(first)
+	if err != nil || m.KRBError == nil || m.KRBError.Code != krb.ErrPreauthRequired {
+		t.Fatalf("got %+v, %v; want PREAUTH_REQUIRED", m, err)
+	}
+	if !cached(req) {
+		t.Fatal("challenge not kept for retransmissions")
+	}
+	if again := process(req, "192.0.2.1"); !bytes.Equal(again, first) {
+		t.Error("retransmission answered with a new reply")
+	}
+}
+
+func TestLookasideSkipsTransientErrors(t *testing.T) {
+	useKeytab(t)
+	resetLimits(t)
+	oldCircuits := circuits
+	circuits = map[string]*zkCircuit{circuitID: {}}
+	defer func() { circuits = oldCircuits }()
+
+	for _, tt := range []struct {
+		name     string
+		throttle func(source string)
+		code     int
+	}{
+		{"rate limited", func(source string) {
+			limits.sources[source] = &limit{refilled: time.Now(), until: time.Now().Add(time.Minute)}
+		}, krb.ErrGeneric},
+		{"locked out", func(source string) {
+			limits.pairs[pairKey("alice", source)] = &pairLimit{locked: time.Now().Add(time.Minute)}
+		}, krb.ErrClientRevoked},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			const source = "192.0.2.2"
+			ch, err := issueChallenge("alice", source, false)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pa, err := krb.NewPAZK(krb.PAZKReq{CircuitID: circuitID, Challenge: ch.Challenge, DHPublic: []byte{2}, Proof: []byte("junk")})
+			if err != nil {
+				t.Fatal(err)
+			}
+			req := asReq(t, "alice", pa)
+
+			limits.Lock()
+			tt.throttle(source)
+			limits.Unlock()
+			m, err := krb.Unmarshal(process(req, source))
+			if err != nil || m.KRBError == nil || m.KRBError.Code != tt.code {
+				t.Fatalf("got %+v, %v; want KRB-ERROR %d", m, err, tt.code)
+			}
+			if cached(req) {
+				t.Errorf("%s error kept for retries", tt.name)
+			}
+		})
+	}
+}
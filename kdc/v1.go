@@ -0,0 +1,138 @@
+package main
+
+import (
+	_ "embed"
+	"errors"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/kdcapi"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/manifest"
+)
+
+// openAPI describes the /v1 API.
+//
+//go:embed openapi.json
+var openAPI []byte
+
+func handleHealth(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, kdcapi.Health{Status: "ok", Realm: krb.Realm, Time: time.Now().UTC()})
+}
+
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(openAPI)
+}
+
+func handleCircuit(w http.ResponseWriter, r *http.Request) {
+	c, ok := requestCircuit(w, r)
+	if !ok {
+		return
+	}
+	writeJSON(w, http.StatusOK, circuitInfo(c))
+}
+
+// circuitInfo describes a circuit and the keys set up for it at startup.
+func circuitInfo(c *zkCircuit) kdcapi.Circuit {
+	return kdcapi.Circuit{
+		CircuitID:    c.manifest.CircuitID,
+		Backend:      c.manifest.Backend,
+		Curve:        c.manifest.Curve,
+		PublicInputs: c.publicInputs,
+		CircuitHash:  c.manifest.CircuitHash,
+		PKHash:       c.manifest.PKHash,
+		VKHash:       c.manifest.VKHash,
+	}
+}
+
+// handleKey serves the key of the requested circuit that get returns, in
+// gnark's binary encoding behind a curve tag.
+func handleKey(get func(*zkCircuit) io.WriterTo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		c, ok := requestCircuit(w, r)
+		if !ok {
+			return
+		}
+		key, err := serialize(get(c))
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, kdcapi.CodeInternal, "failed to serialize key")
+			return
+		}
+		writeJSON(w, http.StatusOK, kdcapi.Key{
+			CircuitID: c.manifest.CircuitID,
+			Curve:     c.manifest.Curve,
+			Key:       key,
+			SHA256:    manifest.Hash(key),
+		})
+	}
+}
+
+func handleChallenge(w http.ResponseWriter, r *http.Request) {
+	var req kdcapi.ChallengeRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if req.Principal == "" {
+		writeError(w, http.StatusBadRequest, kdcapi.CodeBadRequest, "principal is required")
+		return
+	}
+	if req.Principal != krb.Anonymous {
+		if err := authenticateCaller(req.APReq, req.Principal); err != nil {
+			writeError(w, http.StatusUnauthorized, kdcapi.CodeUnauthorized, err.Error())
+			return
+		}
+	}
+	ch, err := issueChallenge(req.Principal, sourceOf(r.RemoteAddr), req.Precompute)
+	rec, _ := lookupPrincipal(req.Principal)
+	if errors.Is(err, errUnknownPrincipal) {
+		writeError(w, http.StatusNotFound, kdcapi.CodePrincipalUnknown, "no such principal "+req.Principal)
+		return
+	}
+	if errors.Is(err, errPrecomputeDisabled) || errors.Is(err, errPrecomputeAnonymous) {
+		writeError(w, http.StatusBadRequest, kdcapi.CodeBadRequest, err.Error())
+		return
+	}
+	if errors.Is(err, errTooManyPrecomputed) {
+		writeError(w, http.StatusConflict, kdcapi.CodeConflict, err.Error())
+		return
+	}
+	if errors.Is(err, errTooManyChallenges) {
+		writeError(w, http.StatusServiceUnavailable, kdcapi.CodeUnavailable, err.Error())
+		return
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, kdcapi.CodeInternal, "failed to issue challenge")
+		return
+	}
+	writeJSON(w, http.StatusOK, kdcapi.Challenge{
+		Principal: req.Principal,
+		CircuitID: ch.CircuitID,
+		Challenge: ch.Challenge,
+		Expires:   ch.Expires,
+		Salt:      ch.Salt,
+		KVNO:      rec.KVNO,
+	})
+}
+
+func handleProof(w http.ResponseWriter, r *http.Request) {
+	var req kdcapi.ProofRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	if writeProofError(w, verifyChallengeProof(req.Principal, sourceOf(r.RemoteAddr), req.Proof, req.Challenge)) {
+		return
+	}
+	writeJSON(w, http.StatusOK, kdcapi.ProofResult{Valid: true})
+}
+
+// handleTicket runs an AS or TGS exchange; KDC errors come back as a
+// KRB-ERROR in the reply, not as an HTTP error.
+func handleTicket(w http.ResponseWriter, r *http.Request) {
+	var req kdcapi.TicketRequest
+	if !readJSON(w, r, &req) {
+		return
+	}
+	writeJSON(w, http.StatusOK, kdcapi.TicketReply{Reply: process(req.Request, sourceOf(r.RemoteAddr))})
+}
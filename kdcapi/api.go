@@ -0,0 +1,253 @@
+// Package kdcapi is the Go client of the KDC's versioned HTTPS API. The
+// API is described by openapi.json in the kdc command; the types here are
+// its schemas, shared with the server so the two can't drift apart, and
+// the requests are made by a client generated from the same document.
+package kdcapi
+
+import (
+	"crypto/sha256"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/attrs"
+	"github.com/evanhong7384/ZK-Kerb/kdc/manifest"
+)
+
+// Prefix is the path prefix of this version of the API.
+const Prefix = "/v1"
+
+// Health is the body of GET /v1/health.
+type Health struct {
+	Status string    `json:"status"`
+	Realm  string    `json:"realm"`
+	Time   time.Time `json:"time"`
+}
+
+// Circuit is the body of GET /v1/circuit.
+type Circuit struct {
+	CircuitID    string   `json:"circuit_id"`
+	Backend      string   `json:"backend"`
+	Curve        string   `json:"curve"`
+	PublicInputs []string `json:"public_inputs"`
+	CircuitHash  string   `json:"circuit_hash"`
+	PKHash       string   `json:"pk_sha256"`
+	VKHash       string   `json:"vk_sha256"`
+}
+
+// SignedManifest is the body of GET /v1/keys/manifest.
+type SignedManifest = manifest.Signed
+
+// Credential is the body of the reply to POST /v1/admin/credentials.
+type Credential = attrs.Credential
+
+// Key is the body of GET /v1/keys/proving, /v1/keys/verifying and
+// /v1/keys/constraint-system: a key, or the compiled circuit, in gnark's
+// binary encoding.
+type Key struct {
+	CircuitID string `json:"circuit_id"`
+	Curve     string `json:"curve"`
+	Key       []byte `json:"key"`
+	SHA256    string `json:"sha256"`
+}
+
+// ChallengeRequest is the body of POST /v1/challenges.
+//
+// A Precompute challenge lasts hours instead of minutes, for a client to
+// prove over ahead of time and answer a later PA-ZK exchange with. Only
+// named principals get them, and past a few pending the KDC refuses more.
+type ChallengeRequest struct {
+	Principal  string `json:"principal"`
+	Precompute bool   `json:"precompute,omitempty"`
+	// APReq is a DER AP-REQ from Principal, made with a ticket the KDC
+	// issued. It is required for every principal but the anonymous one,
+	// since the reply carries the principal's salt.
+	APReq []byte `json:"ap_req,omitempty"`
+}
+
+// Challenge is a fresh nonce to prove over, bound to one principal, with
+// the salt of that principal's commitment.
+type Challenge struct {
+	Principal string    `json:"principal"`
+	CircuitID string    `json:"circuit_id"`
+	Challenge []byte    `json:"challenge"`
+	Expires   time.Time `json:"expires"`
+	Salt      []byte    `json:"salt"`
+	KVNO      int       `json:"kvno"`
+}
+
+// ProofRequest is the body of POST /v1/proofs. Challenge is the proof's
+// public challenge input and must be a live challenge from POST
+// /v1/challenges for the same principal.
+type ProofRequest struct {
+	Principal string `json:"principal"`
+	Challenge []byte `json:"challenge"`
+	Proof     []byte `json:"proof"`
+}
+
+// ProofResult is the reply to an accepted proof.
+type ProofResult struct {
+	Valid bool `json:"valid"`
+}
+
+// TicketRequest is the body of POST /v1/tickets: a DER AS-REQ or TGS-REQ.
+type TicketRequest struct {
+	Request []byte `json:"request"`
+}
+
+// TicketReply carries the DER AS-REP, TGS-REP or KRB-ERROR.
+type TicketReply struct {
+	Reply []byte `json:"reply"`
+}
+
+// CreatePrincipalRequest is the body of POST /v1/admin/principals, which
+// needs the admin token.
+type CreatePrincipalRequest struct {
+	Principal string `json:"principal"`
+}
+
+// Enrollment is a principal waiting for its user to enroll, and the
+// one-time token to enroll with.
+type Enrollment struct {
+	Principal string    `json:"principal"`
+	Token     string    `json:"token"`
+	Expires   time.Time `json:"expires"`
+}
+
+// EnrollRequest is the body of POST /v1/enrollments: the salt and MiMC
+// commitment of the user's password, computed on the client.
+type EnrollRequest struct {
+	Principal  string `json:"principal"`
+	Token      string `json:"token"`
+	Salt       []byte `json:"salt"`
+	Commitment []byte `json:"commitment"`
+}
+
+// EnrollResult is the reply to an accepted enrollment.
+type EnrollResult struct {
+	Principal string `json:"principal"`
+	CircuitID string `json:"circuit_id"`
+}
+
+// PasswordChangeRequest is the body of POST /v1/password. Proof shows
+// knowledge of the current password; its public challenge input is
+// PasswordChangeBinding(Challenge, NewSalt, NewCommitment), where
+// Challenge is a live challenge from POST /v1/challenges. KVNO is the
+// kvno that challenge reported.
+type PasswordChangeRequest struct {
+	Principal     string `json:"principal"`
+	Challenge     []byte `json:"challenge"`
+	KVNO          int    `json:"kvno"`
+	Proof         []byte `json:"proof"`
+	NewSalt       []byte `json:"new_salt"`
+	NewCommitment []byte `json:"new_commitment"`
+	RevokeTickets bool   `json:"revoke_tickets,omitempty"`
+}
+
+// PasswordChangeResult is the reply to an accepted password change.
+type PasswordChangeResult struct {
+	Principal      string `json:"principal"`
+	KVNO           int    `json:"kvno"`
+	TicketsRevoked bool   `json:"tickets_revoked"`
+}
+
+// PasswordChangeBinding returns the challenge input of a password change
+// proof. It covers the new commitment, so the proof can't be replayed to
+// install a different one.
+func PasswordChangeBinding(challenge, newSalt, newCommitment []byte) []byte {
+	h := sha256.New()
+	h.Write([]byte("zk-kerb password change\x00"))
+	h.Write(challenge)
+	h.Write(newSalt)
+	h.Write(newCommitment)
+	return h.Sum(nil)
+}
+
+// CredentialRequest is the body of POST /v1/admin/credentials, which
+// needs the admin token. The reply is an attrs.Credential.
+type CredentialRequest struct {
+	Principal  string            `json:"principal"`
+	Attributes map[string]string `json:"attributes"`
+}
+
+// Group is the body of GET /v1/groups/{group}: the root that anonymous
+// logins as a member of the group prove against, and the leaves under it.
+// Members are listed by commitment alone, without names or salts; each
+// finds its own leaf by recomputing its commitment from its password and
+// the salt it keeps.
+type Group struct {
+	Group     string        `json:"group"`
+	CircuitID string        `json:"circuit_id"`
+	Depth     int           `json:"depth"`
+	Root      []byte        `json:"root"`
+	Members   []GroupMember `json:"members"`
+}
+
+// GroupMember is one leaf of a group tree. Salts are not published; a
+// member keeps its own from enrolling or logging in by name, since asking
+// for it just before an anonymous login would give the member away.
+type GroupMember struct {
+	Commitment []byte `json:"commitment"`
+}
+
+// ProofStats is the body of GET /v1/admin/stats, which needs the admin
+// token: what became of the proofs the KDC was sent since it started, and
+// who is being held off now.
+type ProofStats struct {
+	Accepted    int64 `json:"accepted"`
+	Failed      int64 `json:"failed"`       // proofs that did not verify
+	RateLimited int64 `json:"rate_limited"` // proofs refused unchecked for backoff or rate
+	LockedOut   int64 `json:"locked_out"`   // proofs refused unchecked for a lockout
+	Lockouts    int64 `json:"lockouts"`     // principals locked out
+
+	Sources    []Backoff `json:"sources"`
+	Principals []Backoff `json:"principals"`
+	Locked     []Lockout `json:"locked"`
+}
+
+// Backoff is a source address or principal whose last proofs failed.
+type Backoff struct {
+	Name     string    `json:"name"`
+	Failures int       `json:"failures"`
+	Until    time.Time `json:"until"`
+}
+
+// Lockout is a locked-out principal: from Source only, or if Source is
+// empty from everywhere.
+type Lockout struct {
+	Principal string    `json:"principal"`
+	Source    string    `json:"source,omitempty"`
+	Until     time.Time `json:"until"`
+}
+
+// Error is the body of every error response, and the error the client
+// returns for one. Code is stable; Message is for people.
+type Error struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return "kdcapi: " + e.Code + ": " + e.Message
+}
+
+// Stable error codes.
+const (
+	CodeBadRequest        = "bad_request"
+	CodeNotFound          = "not_found"
+	CodeMethodNotAllowed  = "method_not_allowed"
+	CodeTooLarge          = "request_too_large"
+	CodeProofMalformed    = "proof_malformed"
+	CodeProofRejected     = "proof_rejected"
+	CodeProofReplayed     = "proof_replayed"
+	CodeChallengeInvalid  = "challenge_invalid"
+	CodePrincipalUnknown  = "principal_unknown"
+	CodePrincipalExists   = "principal_exists"
+	CodeEnrollmentInvalid = "enrollment_invalid"
+	CodeUnauthorized      = "unauthorized"
+	CodeConflict          = "conflict"
+	CodeRateLimited       = "rate_limited"
+	CodePrincipalLocked   = "principal_locked"
+	CodeUnknownRealm      = "unknown_realm"
+	CodeUnavailable       = "unavailable"
+	CodeInternal          = "internal_error"
+)
@@ -0,0 +1,257 @@
+package kdcapi
+
+//go:generate oapi-codegen -config oapi-codegen.yaml ../kdc/openapi.json
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/attrs"
+	"github.com/evanhong7384/ZK-Kerb/kdc/manifest"
+)
+
+// maxReply bounds the replies we read; proving keys are the largest.
+const maxReply = 64 << 20
+
+// Client calls the API at BaseURL, e.g. https://kdc.example:8081, through
+// the client generated from openapi.json. AdminToken, if set, is sent as a
+// bearer token for the admin endpoints.
+type Client struct {
+	BaseURL    string
+	AdminToken string
+
+	api *ClientWithResponses
+}
+
+// New returns a client for the API at baseURL. A nil hc means
+// http.DefaultClient.
+func New(baseURL string, hc *http.Client) *Client {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	c := &Client{BaseURL: strings.TrimRight(baseURL, "/")}
+	c.api = &ClientWithResponses{&APIClient{
+		Server:         c.BaseURL + Prefix + "/",
+		Client:         limited{hc},
+		RequestEditors: []RequestEditorFn{c.editRequest},
+	}}
+	return c
+}
+
+// Health calls GET /v1/health.
+func (c *Client) Health(ctx context.Context) (*Health, error) {
+	r, err := c.api.HealthWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// Circuit calls GET /v1/circuit.
+func (c *Client) Circuit(ctx context.Context) (*Circuit, error) {
+	r, err := c.api.GetCircuitWithResponse(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// ProvingKey calls GET /v1/keys/proving.
+func (c *Client) ProvingKey(ctx context.Context) (*Key, error) {
+	r, err := c.api.GetProvingKeyWithResponse(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// CircuitProvingKey calls GET /v1/keys/proving for the named circuit.
+func (c *Client) CircuitProvingKey(ctx context.Context, circuitID string) (*Key, error) {
+	id := GetProvingKeyParamsCircuit(circuitID)
+	r, err := c.api.GetProvingKeyWithResponse(ctx, &GetProvingKeyParams{Circuit: &id})
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// CircuitConstraintSystem calls GET /v1/keys/constraint-system for the
+// named circuit.
+func (c *Client) CircuitConstraintSystem(ctx context.Context, circuitID string) (*Key, error) {
+	id := GetConstraintSystemParamsCircuit(circuitID)
+	r, err := c.api.GetConstraintSystemWithResponse(ctx, &GetConstraintSystemParams{Circuit: &id})
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// VerifyingKey calls GET /v1/keys/verifying.
+func (c *Client) VerifyingKey(ctx context.Context) (*Key, error) {
+	r, err := c.api.GetVerifyingKeyWithResponse(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// Manifest calls GET /v1/keys/manifest. The caller verifies it.
+func (c *Client) Manifest(ctx context.Context) (*manifest.Signed, error) {
+	r, err := c.api.GetManifestWithResponse(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// CircuitManifest calls GET /v1/keys/manifest for the named circuit. The
+// caller verifies it.
+func (c *Client) CircuitManifest(ctx context.Context, circuitID string) (*manifest.Signed, error) {
+	id := GetManifestParamsCircuit(circuitID)
+	r, err := c.api.GetManifestWithResponse(ctx, &GetManifestParams{Circuit: &id})
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// Group calls GET /v1/groups/{group}.
+func (c *Client) Group(ctx context.Context, group string) (*Group, error) {
+	r, err := c.api.GetGroupWithResponse(ctx, group)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// Challenge calls POST /v1/challenges, authenticated by apReq, a DER
+// AP-REQ from principal.
+func (c *Client) Challenge(ctx context.Context, principal string, apReq []byte) (*Challenge, error) {
+	r, err := c.api.CreateChallengeWithResponse(ctx, ChallengeRequest{Principal: principal, APReq: apReq})
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// PrecomputeChallenge calls POST /v1/challenges for a long-lived
+// challenge, to prove over ahead of a later login.
+func (c *Client) PrecomputeChallenge(ctx context.Context, principal string, apReq []byte) (*Challenge, error) {
+	r, err := c.api.CreateChallengeWithResponse(ctx, ChallengeRequest{Principal: principal, Precompute: true, APReq: apReq})
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// SubmitProof calls POST /v1/proofs.
+func (c *Client) SubmitProof(ctx context.Context, req ProofRequest) (*ProofResult, error) {
+	r, err := c.api.SubmitProofWithResponse(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// Ticket calls POST /v1/tickets with a DER KDC request and returns the DER
+// reply, which may be a KRB-ERROR.
+func (c *Client) Ticket(ctx context.Context, der []byte) ([]byte, error) {
+	r, err := c.api.IssueTicketWithResponse(ctx, TicketRequest{Request: der})
+	if err != nil {
+		return nil, err
+	}
+	out, err := reply(r.JSON200, r.HTTPResponse, r.Body)
+	if err != nil {
+		return nil, err
+	}
+	return out.Reply, nil
+}
+
+// CreatePrincipal calls POST /v1/admin/principals, authorized by
+// AdminToken.
+func (c *Client) CreatePrincipal(ctx context.Context, principal string) (*Enrollment, error) {
+	r, err := c.api.CreatePrincipalWithResponse(ctx, CreatePrincipalRequest{Principal: principal})
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// IssueCredential calls POST /v1/admin/credentials, authorized by
+// AdminToken.
+func (c *Client) IssueCredential(ctx context.Context, req CredentialRequest) (*attrs.Credential, error) {
+	r, err := c.api.IssueCredentialWithResponse(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// Stats calls GET /v1/admin/stats, authorized by AdminToken.
+func (c *Client) Stats(ctx context.Context) (*ProofStats, error) {
+	r, err := c.api.GetStatsWithResponse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// Enroll calls POST /v1/enrollments.
+func (c *Client) Enroll(ctx context.Context, req EnrollRequest) (*EnrollResult, error) {
+	r, err := c.api.EnrollWithResponse(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// ChangePassword calls POST /v1/password.
+func (c *Client) ChangePassword(ctx context.Context, req PasswordChangeRequest) (*PasswordChangeResult, error) {
+	r, err := c.api.ChangePasswordWithResponse(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return reply(r.JSON200, r.HTTPResponse, r.Body)
+}
+
+// editRequest adds the headers every call carries.
+func (c *Client) editRequest(_ context.Context, req *http.Request) error {
+	req.Header.Set("Accept", "application/json")
+	if c.AdminToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.AdminToken)
+	}
+	return nil
+}
+
+// reply returns the 200 body the generated client decoded, or the API
+// error the KDC sent instead.
+func reply[T any](ok *T, resp *http.Response, body []byte) (*T, error) {
+	if ok != nil {
+		return ok, nil
+	}
+	req := resp.Request
+	apiErr := &Error{Status: resp.StatusCode}
+	if err := json.Unmarshal(body, apiErr); err != nil || apiErr.Code == "" || resp.StatusCode == http.StatusOK {
+		return nil, fmt.Errorf("kdcapi: %s %s: %s", req.Method, req.URL.Path, resp.Status)
+	}
+	return nil, apiErr
+}
+
+// limited caps the reply bodies the generated client reads.
+type limited struct{ hc *http.Client }
+
+func (l limited) Do(req *http.Request) (*http.Response, error) {
+	resp, err := l.hc.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(resp.Body, maxReply), resp.Body}
+	return resp, nil
+}
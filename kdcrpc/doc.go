@@ -0,0 +1,6 @@
+// Package kdcrpc is the gRPC interface to the KDC, as defined in kdc.proto:
+// the messages, the service description, server registration and a client,
+// generated by protoc-gen-go and protoc-gen-go-grpc.
+package kdcrpc
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative kdc.proto
@@ -0,0 +1,668 @@
+// gRPC interface to the ZK-Kerb KDC. It runs on the same core as the
+// Kerberos TCP/UDP listeners and the HTTPS API.
+
+// Code generated by protoc-gen-go. DO NOT EDIT.
+// versions:
+// 	protoc-gen-go v1.36.11
+// 	protoc        (unknown)
+// source: kdc.proto
+
+package kdcrpc
+
+import (
+	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
+	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
+	reflect "reflect"
+	sync "sync"
+	unsafe "unsafe"
+)
+
+const (
+	// Verify that this generated code is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(20 - protoimpl.MinVersion)
+	// Verify that runtime/protoimpl is sufficiently up-to-date.
+	_ = protoimpl.EnforceVersion(protoimpl.MaxVersion - 20)
+)
+
+type GetCircuitRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetCircuitRequest) Reset() {
+	*x = GetCircuitRequest{}
+	mi := &file_kdc_proto_msgTypes[0]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetCircuitRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetCircuitRequest) ProtoMessage() {}
+
+func (x *GetCircuitRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_kdc_proto_msgTypes[0]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetCircuitRequest.ProtoReflect.Descriptor instead.
+func (*GetCircuitRequest) Descriptor() ([]byte, []int) {
+	return file_kdc_proto_rawDescGZIP(), []int{0}
+}
+
+type Circuit struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	CircuitId     string                 `protobuf:"bytes,1,opt,name=circuit_id,json=circuitId,proto3" json:"circuit_id,omitempty"`
+	Backend       string                 `protobuf:"bytes,2,opt,name=backend,proto3" json:"backend,omitempty"`
+	Curve         string                 `protobuf:"bytes,3,opt,name=curve,proto3" json:"curve,omitempty"`
+	PublicInputs  []string               `protobuf:"bytes,4,rep,name=public_inputs,json=publicInputs,proto3" json:"public_inputs,omitempty"`
+	CircuitHash   string                 `protobuf:"bytes,5,opt,name=circuit_hash,json=circuitHash,proto3" json:"circuit_hash,omitempty"`
+	PkSha256      string                 `protobuf:"bytes,6,opt,name=pk_sha256,json=pkSha256,proto3" json:"pk_sha256,omitempty"`
+	VkSha256      string                 `protobuf:"bytes,7,opt,name=vk_sha256,json=vkSha256,proto3" json:"vk_sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *Circuit) Reset() {
+	*x = Circuit{}
+	mi := &file_kdc_proto_msgTypes[1]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Circuit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Circuit) ProtoMessage() {}
+
+func (x *Circuit) ProtoReflect() protoreflect.Message {
+	mi := &file_kdc_proto_msgTypes[1]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Circuit.ProtoReflect.Descriptor instead.
+func (*Circuit) Descriptor() ([]byte, []int) {
+	return file_kdc_proto_rawDescGZIP(), []int{1}
+}
+
+func (x *Circuit) GetCircuitId() string {
+	if x != nil {
+		return x.CircuitId
+	}
+	return ""
+}
+
+func (x *Circuit) GetBackend() string {
+	if x != nil {
+		return x.Backend
+	}
+	return ""
+}
+
+func (x *Circuit) GetCurve() string {
+	if x != nil {
+		return x.Curve
+	}
+	return ""
+}
+
+func (x *Circuit) GetPublicInputs() []string {
+	if x != nil {
+		return x.PublicInputs
+	}
+	return nil
+}
+
+func (x *Circuit) GetCircuitHash() string {
+	if x != nil {
+		return x.CircuitHash
+	}
+	return ""
+}
+
+func (x *Circuit) GetPkSha256() string {
+	if x != nil {
+		return x.PkSha256
+	}
+	return ""
+}
+
+func (x *Circuit) GetVkSha256() string {
+	if x != nil {
+		return x.VkSha256
+	}
+	return ""
+}
+
+type GetProvingKeyRequest struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *GetProvingKeyRequest) Reset() {
+	*x = GetProvingKeyRequest{}
+	mi := &file_kdc_proto_msgTypes[2]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GetProvingKeyRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GetProvingKeyRequest) ProtoMessage() {}
+
+func (x *GetProvingKeyRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_kdc_proto_msgTypes[2]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GetProvingKeyRequest.ProtoReflect.Descriptor instead.
+func (*GetProvingKeyRequest) Descriptor() ([]byte, []int) {
+	return file_kdc_proto_rawDescGZIP(), []int{2}
+}
+
+type KeyChunk struct {
+	state  protoimpl.MessageState `protogen:"open.v1"`
+	Data   []byte                 `protobuf:"bytes,1,opt,name=data,proto3" json:"data,omitempty"`
+	Offset int64                  `protobuf:"varint,2,opt,name=offset,proto3" json:"offset,omitempty"`
+	// total_size and sha256 describe the whole key; they are set in the
+	// first chunk.
+	TotalSize     int64  `protobuf:"varint,3,opt,name=total_size,json=totalSize,proto3" json:"total_size,omitempty"`
+	Sha256        string `protobuf:"bytes,4,opt,name=sha256,proto3" json:"sha256,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KeyChunk) Reset() {
+	*x = KeyChunk{}
+	mi := &file_kdc_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KeyChunk) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KeyChunk) ProtoMessage() {}
+
+func (x *KeyChunk) ProtoReflect() protoreflect.Message {
+	mi := &file_kdc_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KeyChunk.ProtoReflect.Descriptor instead.
+func (*KeyChunk) Descriptor() ([]byte, []int) {
+	return file_kdc_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *KeyChunk) GetData() []byte {
+	if x != nil {
+		return x.Data
+	}
+	return nil
+}
+
+func (x *KeyChunk) GetOffset() int64 {
+	if x != nil {
+		return x.Offset
+	}
+	return 0
+}
+
+func (x *KeyChunk) GetTotalSize() int64 {
+	if x != nil {
+		return x.TotalSize
+	}
+	return 0
+}
+
+func (x *KeyChunk) GetSha256() string {
+	if x != nil {
+		return x.Sha256
+	}
+	return ""
+}
+
+type ChallengeRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Principal string                 `protobuf:"bytes,1,opt,name=principal,proto3" json:"principal,omitempty"`
+	// ap_req is a DER AP-REQ from principal, made with a ticket the KDC
+	// issued; required for every principal but the anonymous one.
+	ApReq         []byte `protobuf:"bytes,2,opt,name=ap_req,json=apReq,proto3" json:"ap_req,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChallengeRequest) Reset() {
+	*x = ChallengeRequest{}
+	mi := &file_kdc_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChallengeRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChallengeRequest) ProtoMessage() {}
+
+func (x *ChallengeRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_kdc_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChallengeRequest.ProtoReflect.Descriptor instead.
+func (*ChallengeRequest) Descriptor() ([]byte, []int) {
+	return file_kdc_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *ChallengeRequest) GetPrincipal() string {
+	if x != nil {
+		return x.Principal
+	}
+	return ""
+}
+
+func (x *ChallengeRequest) GetApReq() []byte {
+	if x != nil {
+		return x.ApReq
+	}
+	return nil
+}
+
+type ChallengeReply struct {
+	state       protoimpl.MessageState `protogen:"open.v1"`
+	Principal   string                 `protobuf:"bytes,1,opt,name=principal,proto3" json:"principal,omitempty"`
+	CircuitId   string                 `protobuf:"bytes,2,opt,name=circuit_id,json=circuitId,proto3" json:"circuit_id,omitempty"`
+	Challenge   []byte                 `protobuf:"bytes,3,opt,name=challenge,proto3" json:"challenge,omitempty"`
+	ExpiresUnix int64                  `protobuf:"varint,4,opt,name=expires_unix,json=expiresUnix,proto3" json:"expires_unix,omitempty"`
+	// salt of the principal's password commitment.
+	Salt []byte `protobuf:"bytes,5,opt,name=salt,proto3" json:"salt,omitempty"`
+	// kvno of that commitment, which a password change names; 0 for the
+	// anonymous principal.
+	Kvno          int32 `protobuf:"varint,6,opt,name=kvno,proto3" json:"kvno,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ChallengeReply) Reset() {
+	*x = ChallengeReply{}
+	mi := &file_kdc_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ChallengeReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ChallengeReply) ProtoMessage() {}
+
+func (x *ChallengeReply) ProtoReflect() protoreflect.Message {
+	mi := &file_kdc_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ChallengeReply.ProtoReflect.Descriptor instead.
+func (*ChallengeReply) Descriptor() ([]byte, []int) {
+	return file_kdc_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *ChallengeReply) GetPrincipal() string {
+	if x != nil {
+		return x.Principal
+	}
+	return ""
+}
+
+func (x *ChallengeReply) GetCircuitId() string {
+	if x != nil {
+		return x.CircuitId
+	}
+	return ""
+}
+
+func (x *ChallengeReply) GetChallenge() []byte {
+	if x != nil {
+		return x.Challenge
+	}
+	return nil
+}
+
+func (x *ChallengeReply) GetExpiresUnix() int64 {
+	if x != nil {
+		return x.ExpiresUnix
+	}
+	return 0
+}
+
+func (x *ChallengeReply) GetSalt() []byte {
+	if x != nil {
+		return x.Salt
+	}
+	return nil
+}
+
+func (x *ChallengeReply) GetKvno() int32 {
+	if x != nil {
+		return x.Kvno
+	}
+	return 0
+}
+
+type ProofRequest struct {
+	state     protoimpl.MessageState `protogen:"open.v1"`
+	Principal string                 `protobuf:"bytes,1,opt,name=principal,proto3" json:"principal,omitempty"`
+	// challenge is the proof's public challenge input.
+	Challenge     []byte `protobuf:"bytes,2,opt,name=challenge,proto3" json:"challenge,omitempty"`
+	Proof         []byte `protobuf:"bytes,3,opt,name=proof,proto3" json:"proof,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProofRequest) Reset() {
+	*x = ProofRequest{}
+	mi := &file_kdc_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProofRequest) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProofRequest) ProtoMessage() {}
+
+func (x *ProofRequest) ProtoReflect() protoreflect.Message {
+	mi := &file_kdc_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProofRequest.ProtoReflect.Descriptor instead.
+func (*ProofRequest) Descriptor() ([]byte, []int) {
+	return file_kdc_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *ProofRequest) GetPrincipal() string {
+	if x != nil {
+		return x.Principal
+	}
+	return ""
+}
+
+func (x *ProofRequest) GetChallenge() []byte {
+	if x != nil {
+		return x.Challenge
+	}
+	return nil
+}
+
+func (x *ProofRequest) GetProof() []byte {
+	if x != nil {
+		return x.Proof
+	}
+	return nil
+}
+
+type ProofReply struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Valid         bool                   `protobuf:"varint,1,opt,name=valid,proto3" json:"valid,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *ProofReply) Reset() {
+	*x = ProofReply{}
+	mi := &file_kdc_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ProofReply) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ProofReply) ProtoMessage() {}
+
+func (x *ProofReply) ProtoReflect() protoreflect.Message {
+	mi := &file_kdc_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ProofReply.ProtoReflect.Descriptor instead.
+func (*ProofReply) Descriptor() ([]byte, []int) {
+	return file_kdc_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *ProofReply) GetValid() bool {
+	if x != nil {
+		return x.Valid
+	}
+	return false
+}
+
+type KerberosMessage struct {
+	state         protoimpl.MessageState `protogen:"open.v1"`
+	Der           []byte                 `protobuf:"bytes,1,opt,name=der,proto3" json:"der,omitempty"`
+	unknownFields protoimpl.UnknownFields
+	sizeCache     protoimpl.SizeCache
+}
+
+func (x *KerberosMessage) Reset() {
+	*x = KerberosMessage{}
+	mi := &file_kdc_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *KerberosMessage) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*KerberosMessage) ProtoMessage() {}
+
+func (x *KerberosMessage) ProtoReflect() protoreflect.Message {
+	mi := &file_kdc_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use KerberosMessage.ProtoReflect.Descriptor instead.
+func (*KerberosMessage) Descriptor() ([]byte, []int) {
+	return file_kdc_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *KerberosMessage) GetDer() []byte {
+	if x != nil {
+		return x.Der
+	}
+	return nil
+}
+
+var File_kdc_proto protoreflect.FileDescriptor
+
+const file_kdc_proto_rawDesc = "" +
+	"\n" +
+	"\tkdc.proto\x12\rzkkerb.kdc.v1\"\x13\n" +
+	"\x11GetCircuitRequest\"\xda\x01\n" +
+	"\aCircuit\x12\x1d\n" +
+	"\n" +
+	"circuit_id\x18\x01 \x01(\tR\tcircuitId\x12\x18\n" +
+	"\abackend\x18\x02 \x01(\tR\abackend\x12\x14\n" +
+	"\x05curve\x18\x03 \x01(\tR\x05curve\x12#\n" +
+	"\rpublic_inputs\x18\x04 \x03(\tR\fpublicInputs\x12!\n" +
+	"\fcircuit_hash\x18\x05 \x01(\tR\vcircuitHash\x12\x1b\n" +
+	"\tpk_sha256\x18\x06 \x01(\tR\bpkSha256\x12\x1b\n" +
+	"\tvk_sha256\x18\a \x01(\tR\bvkSha256\"\x16\n" +
+	"\x14GetProvingKeyRequest\"m\n" +
+	"\bKeyChunk\x12\x12\n" +
+	"\x04data\x18\x01 \x01(\fR\x04data\x12\x16\n" +
+	"\x06offset\x18\x02 \x01(\x03R\x06offset\x12\x1d\n" +
+	"\n" +
+	"total_size\x18\x03 \x01(\x03R\ttotalSize\x12\x16\n" +
+	"\x06sha256\x18\x04 \x01(\tR\x06sha256\"G\n" +
+	"\x10ChallengeRequest\x12\x1c\n" +
+	"\tprincipal\x18\x01 \x01(\tR\tprincipal\x12\x15\n" +
+	"\x06ap_req\x18\x02 \x01(\fR\x05apReq\"\xb6\x01\n" +
+	"\x0eChallengeReply\x12\x1c\n" +
+	"\tprincipal\x18\x01 \x01(\tR\tprincipal\x12\x1d\n" +
+	"\n" +
+	"circuit_id\x18\x02 \x01(\tR\tcircuitId\x12\x1c\n" +
+	"\tchallenge\x18\x03 \x01(\fR\tchallenge\x12!\n" +
+	"\fexpires_unix\x18\x04 \x01(\x03R\vexpiresUnix\x12\x12\n" +
+	"\x04salt\x18\x05 \x01(\fR\x04salt\x12\x12\n" +
+	"\x04kvno\x18\x06 \x01(\x05R\x04kvno\"`\n" +
+	"\fProofRequest\x12\x1c\n" +
+	"\tprincipal\x18\x01 \x01(\tR\tprincipal\x12\x1c\n" +
+	"\tchallenge\x18\x02 \x01(\fR\tchallenge\x12\x14\n" +
+	"\x05proof\x18\x03 \x01(\fR\x05proof\"\"\n" +
+	"\n" +
+	"ProofReply\x12\x14\n" +
+	"\x05valid\x18\x01 \x01(\bR\x05valid\"#\n" +
+	"\x0fKerberosMessage\x12\x10\n" +
+	"\x03der\x18\x01 \x01(\fR\x03der2\xbf\x03\n" +
+	"\x03KDC\x12F\n" +
+	"\n" +
+	"GetCircuit\x12 .zkkerb.kdc.v1.GetCircuitRequest\x1a\x16.zkkerb.kdc.v1.Circuit\x12O\n" +
+	"\rGetProvingKey\x12#.zkkerb.kdc.v1.GetProvingKeyRequest\x1a\x17.zkkerb.kdc.v1.KeyChunk0\x01\x12K\n" +
+	"\tChallenge\x12\x1f.zkkerb.kdc.v1.ChallengeRequest\x1a\x1d.zkkerb.kdc.v1.ChallengeReply\x12E\n" +
+	"\vSubmitProof\x12\x1b.zkkerb.kdc.v1.ProofRequest\x1a\x19.zkkerb.kdc.v1.ProofReply\x12D\n" +
+	"\x02AS\x12\x1e.zkkerb.kdc.v1.KerberosMessage\x1a\x1e.zkkerb.kdc.v1.KerberosMessage\x12E\n" +
+	"\x03TGS\x12\x1e.zkkerb.kdc.v1.KerberosMessage\x1a\x1e.zkkerb.kdc.v1.KerberosMessageB,Z*github.com/evanhong7384/ZK-Kerb/kdc/kdcrpcb\x06proto3"
+
+var (
+	file_kdc_proto_rawDescOnce sync.Once
+	file_kdc_proto_rawDescData []byte
+)
+
+func file_kdc_proto_rawDescGZIP() []byte {
+	file_kdc_proto_rawDescOnce.Do(func() {
+		file_kdc_proto_rawDescData = protoimpl.X.CompressGZIP(unsafe.Slice(unsafe.StringData(file_kdc_proto_rawDesc), len(file_kdc_proto_rawDesc)))
+	})
+	return file_kdc_proto_rawDescData
+}
+
+var file_kdc_proto_msgTypes = make([]protoimpl.MessageInfo, 9)
+var file_kdc_proto_goTypes = []any{
+	(*GetCircuitRequest)(nil),    // 0: zkkerb.kdc.v1.GetCircuitRequest
+	(*Circuit)(nil),              // 1: zkkerb.kdc.v1.Circuit
+	(*GetProvingKeyRequest)(nil), // 2: zkkerb.kdc.v1.GetProvingKeyRequest
+	(*KeyChunk)(nil),             // 3: zkkerb.kdc.v1.KeyChunk
+	(*ChallengeRequest)(nil),     // 4: zkkerb.kdc.v1.ChallengeRequest
+	(*ChallengeReply)(nil),       // 5: zkkerb.kdc.v1.ChallengeReply
+	(*ProofRequest)(nil),         // 6: zkkerb.kdc.v1.ProofRequest
+	(*ProofReply)(nil),           // 7: zkkerb.kdc.v1.ProofReply
+	(*KerberosMessage)(nil),      // 8: zkkerb.kdc.v1.KerberosMessage
+}
+var file_kdc_proto_depIdxs = []int32{
+	0, // 0: zkkerb.kdc.v1.KDC.GetCircuit:input_type -> zkkerb.kdc.v1.GetCircuitRequest
+	2, // 1: zkkerb.kdc.v1.KDC.GetProvingKey:input_type -> zkkerb.kdc.v1.GetProvingKeyRequest
+	4, // 2: zkkerb.kdc.v1.KDC.Challenge:input_type -> zkkerb.kdc.v1.ChallengeRequest
+	6, // 3: zkkerb.kdc.v1.KDC.SubmitProof:input_type -> zkkerb.kdc.v1.ProofRequest
+	8, // 4: zkkerb.kdc.v1.KDC.AS:input_type -> zkkerb.kdc.v1.KerberosMessage
+	8, // 5: zkkerb.kdc.v1.KDC.TGS:input_type -> zkkerb.kdc.v1.KerberosMessage
+	1, // 6: zkkerb.kdc.v1.KDC.GetCircuit:output_type -> zkkerb.kdc.v1.Circuit
+	3, // 7: zkkerb.kdc.v1.KDC.GetProvingKey:output_type -> zkkerb.kdc.v1.KeyChunk
+	5, // 8: zkkerb.kdc.v1.KDC.Challenge:output_type -> zkkerb.kdc.v1.ChallengeReply
+	7, // 9: zkkerb.kdc.v1.KDC.SubmitProof:output_type -> zkkerb.kdc.v1.ProofReply
+	8, // 10: zkkerb.kdc.v1.KDC.AS:output_type -> zkkerb.kdc.v1.KerberosMessage
+	8, // 11: zkkerb.kdc.v1.KDC.TGS:output_type -> zkkerb.kdc.v1.KerberosMessage
+	6, // [6:12] is the sub-list for method output_type
+	0, // [0:6] is the sub-list for method input_type
+	0, // [0:0] is the sub-list for extension type_name
+	0, // [0:0] is the sub-list for extension extendee
+	0, // [0:0] is the sub-list for field type_name
+}
+
+func init() { file_kdc_proto_init() }
+func file_kdc_proto_init() {
+	if File_kdc_proto != nil {
+		return
+	}
+	type x struct{}
+	out := protoimpl.TypeBuilder{
+		File: protoimpl.DescBuilder{
+			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
+			RawDescriptor: unsafe.Slice(unsafe.StringData(file_kdc_proto_rawDesc), len(file_kdc_proto_rawDesc)),
+			NumEnums:      0,
+			NumMessages:   9,
+			NumExtensions: 0,
+			NumServices:   1,
+		},
+		GoTypes:           file_kdc_proto_goTypes,
+		DependencyIndexes: file_kdc_proto_depIdxs,
+		MessageInfos:      file_kdc_proto_msgTypes,
+	}.Build()
+	File_kdc_proto = out.File
+	file_kdc_proto_goTypes = nil
+	file_kdc_proto_depIdxs = nil
+}
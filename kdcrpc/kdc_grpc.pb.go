@@ -0,0 +1,338 @@
+// gRPC interface to the ZK-Kerb KDC. It runs on the same core as the
+// Kerberos TCP/UDP listeners and the HTTPS API.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: kdc.proto
+
+package kdcrpc
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	KDC_GetCircuit_FullMethodName    = "/zkkerb.kdc.v1.KDC/GetCircuit"
+	KDC_GetProvingKey_FullMethodName = "/zkkerb.kdc.v1.KDC/GetProvingKey"
+	KDC_Challenge_FullMethodName     = "/zkkerb.kdc.v1.KDC/Challenge"
+	KDC_SubmitProof_FullMethodName   = "/zkkerb.kdc.v1.KDC/SubmitProof"
+	KDC_AS_FullMethodName            = "/zkkerb.kdc.v1.KDC/AS"
+	KDC_TGS_FullMethodName           = "/zkkerb.kdc.v1.KDC/TGS"
+)
+
+// KDCClient is the client API for KDC service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type KDCClient interface {
+	// GetCircuit describes the circuit logins prove against.
+	GetCircuit(ctx context.Context, in *GetCircuitRequest, opts ...grpc.CallOption) (*Circuit, error)
+	// GetProvingKey streams the Groth16 proving key in chunks.
+	GetProvingKey(ctx context.Context, in *GetProvingKeyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[KeyChunk], error)
+	// Challenge issues a single-use challenge for a principal, who
+	// authenticates with an AP-REQ.
+	Challenge(ctx context.Context, in *ChallengeRequest, opts ...grpc.CallOption) (*ChallengeReply, error)
+	// SubmitProof checks a proof of knowledge for a principal over a live
+	// challenge from Challenge; each challenge is accepted once.
+	SubmitProof(ctx context.Context, in *ProofRequest, opts ...grpc.CallOption) (*ProofReply, error)
+	// AS runs an AS exchange: der is an AS-REQ, the reply an AS-REP or
+	// KRB-ERROR.
+	AS(ctx context.Context, in *KerberosMessage, opts ...grpc.CallOption) (*KerberosMessage, error)
+	// TGS runs a TGS exchange: der is a TGS-REQ, the reply a TGS-REP or
+	// KRB-ERROR.
+	TGS(ctx context.Context, in *KerberosMessage, opts ...grpc.CallOption) (*KerberosMessage, error)
+}
+
+type kDCClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewKDCClient(cc grpc.ClientConnInterface) KDCClient {
+	return &kDCClient{cc}
+}
+
+func (c *kDCClient) GetCircuit(ctx context.Context, in *GetCircuitRequest, opts ...grpc.CallOption) (*Circuit, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Circuit)
+	err := c.cc.Invoke(ctx, KDC_GetCircuit_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDCClient) GetProvingKey(ctx context.Context, in *GetProvingKeyRequest, opts ...grpc.CallOption) (grpc.ServerStreamingClient[KeyChunk], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &KDC_ServiceDesc.Streams[0], KDC_GetProvingKey_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[GetProvingKeyRequest, KeyChunk]{ClientStream: stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type KDC_GetProvingKeyClient = grpc.ServerStreamingClient[KeyChunk]
+
+func (c *kDCClient) Challenge(ctx context.Context, in *ChallengeRequest, opts ...grpc.CallOption) (*ChallengeReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ChallengeReply)
+	err := c.cc.Invoke(ctx, KDC_Challenge_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDCClient) SubmitProof(ctx context.Context, in *ProofRequest, opts ...grpc.CallOption) (*ProofReply, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ProofReply)
+	err := c.cc.Invoke(ctx, KDC_SubmitProof_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDCClient) AS(ctx context.Context, in *KerberosMessage, opts ...grpc.CallOption) (*KerberosMessage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KerberosMessage)
+	err := c.cc.Invoke(ctx, KDC_AS_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *kDCClient) TGS(ctx context.Context, in *KerberosMessage, opts ...grpc.CallOption) (*KerberosMessage, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(KerberosMessage)
+	err := c.cc.Invoke(ctx, KDC_TGS_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// KDCServer is the server API for KDC service.
+// All implementations must embed UnimplementedKDCServer
+// for forward compatibility.
+type KDCServer interface {
+	// GetCircuit describes the circuit logins prove against.
+	GetCircuit(context.Context, *GetCircuitRequest) (*Circuit, error)
+	// GetProvingKey streams the Groth16 proving key in chunks.
+	GetProvingKey(*GetProvingKeyRequest, grpc.ServerStreamingServer[KeyChunk]) error
+	// Challenge issues a single-use challenge for a principal, who
+	// authenticates with an AP-REQ.
+	Challenge(context.Context, *ChallengeRequest) (*ChallengeReply, error)
+	// SubmitProof checks a proof of knowledge for a principal over a live
+	// challenge from Challenge; each challenge is accepted once.
+	SubmitProof(context.Context, *ProofRequest) (*ProofReply, error)
+	// AS runs an AS exchange: der is an AS-REQ, the reply an AS-REP or
+	// KRB-ERROR.
+	AS(context.Context, *KerberosMessage) (*KerberosMessage, error)
+	// TGS runs a TGS exchange: der is a TGS-REQ, the reply a TGS-REP or
+	// KRB-ERROR.
+	TGS(context.Context, *KerberosMessage) (*KerberosMessage, error)
+	mustEmbedUnimplementedKDCServer()
+}
+
+// UnimplementedKDCServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedKDCServer struct{}
+
+func (UnimplementedKDCServer) GetCircuit(context.Context, *GetCircuitRequest) (*Circuit, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetCircuit not implemented")
+}
+func (UnimplementedKDCServer) GetProvingKey(*GetProvingKeyRequest, grpc.ServerStreamingServer[KeyChunk]) error {
+	return status.Errorf(codes.Unimplemented, "method GetProvingKey not implemented")
+}
+func (UnimplementedKDCServer) Challenge(context.Context, *ChallengeRequest) (*ChallengeReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Challenge not implemented")
+}
+func (UnimplementedKDCServer) SubmitProof(context.Context, *ProofRequest) (*ProofReply, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SubmitProof not implemented")
+}
+func (UnimplementedKDCServer) AS(context.Context, *KerberosMessage) (*KerberosMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method AS not implemented")
+}
+func (UnimplementedKDCServer) TGS(context.Context, *KerberosMessage) (*KerberosMessage, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method TGS not implemented")
+}
+func (UnimplementedKDCServer) mustEmbedUnimplementedKDCServer() {}
+func (UnimplementedKDCServer) testEmbeddedByValue()             {}
+
+// UnsafeKDCServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to KDCServer will
+// result in compilation errors.
+type UnsafeKDCServer interface {
+	mustEmbedUnimplementedKDCServer()
+}
+
+func RegisterKDCServer(s grpc.ServiceRegistrar, srv KDCServer) {
+	// If the following call pancis, it indicates UnimplementedKDCServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&KDC_ServiceDesc, srv)
+}
+
+func _KDC_GetCircuit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetCircuitRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDCServer).GetCircuit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KDC_GetCircuit_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDCServer).GetCircuit(ctx, req.(*GetCircuitRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDC_GetProvingKey_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(GetProvingKeyRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(KDCServer).GetProvingKey(m, &grpc.GenericServerStream[GetProvingKeyRequest, KeyChunk]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type KDC_GetProvingKeyServer = grpc.ServerStreamingServer[KeyChunk]
+
+func _KDC_Challenge_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ChallengeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDCServer).Challenge(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KDC_Challenge_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDCServer).Challenge(ctx, req.(*ChallengeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDC_SubmitProof_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ProofRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDCServer).SubmitProof(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KDC_SubmitProof_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDCServer).SubmitProof(ctx, req.(*ProofRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDC_AS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KerberosMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDCServer).AS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KDC_AS_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDCServer).AS(ctx, req.(*KerberosMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _KDC_TGS_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(KerberosMessage)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(KDCServer).TGS(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: KDC_TGS_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(KDCServer).TGS(ctx, req.(*KerberosMessage))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// KDC_ServiceDesc is the grpc.ServiceDesc for KDC service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var KDC_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "zkkerb.kdc.v1.KDC",
+	HandlerType: (*KDCServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "GetCircuit",
+			Handler:    _KDC_GetCircuit_Handler,
+		},
+		{
+			MethodName: "Challenge",
+			Handler:    _KDC_Challenge_Handler,
+		},
+		{
+			MethodName: "SubmitProof",
+			Handler:    _KDC_SubmitProof_Handler,
+		},
+		{
+			MethodName: "AS",
+			Handler:    _KDC_AS_Handler,
+		},
+		{
+			MethodName: "TGS",
+			Handler:    _KDC_TGS_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "GetProvingKey",
+			Handler:       _KDC_GetProvingKey_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "kdc.proto",
+}
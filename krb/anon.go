@@ -0,0 +1,53 @@
+package krb
+
+import "encoding/asn1"
+
+// Anonymous is the client name of anonymous tickets (RFC 8062). A client
+// logs in as Anonymous by proving it is some member of a group, and its
+// tickets carry an AD-ZK-GROUP naming the group instead of a user.
+const Anonymous = "WELLKNOWN/ANONYMOUS"
+
+// ADZKGroup is the authorization data type of AD-ZK-GROUP. Like PAZK, it is
+// not registered; negative ad-types are for local use.
+const ADZKGroup = -1600
+
+// ZKGroupAuth says the client proved membership of Group:
+//
+//	AD-ZK-GROUP ::= SEQUENCE {
+//	    group       [0] UTF8String,
+//	    nullifier   [1] OCTET STRING   -- from the membership proof
+//	}
+//
+// The nullifier is unique to the login, so services can tell sessions
+// apart, and ban one, without learning who is behind it.
+type ZKGroupAuth struct {
+	Group     string `asn1:"utf8,explicit,tag:0"`
+	Nullifier []byte `asn1:"explicit,tag:1"`
+}
+
+// NewAuthData encodes v as authorization data of type t.
+func NewAuthData(t int, v any) (AuthData, error) {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return AuthData{}, err
+	}
+	return AuthData{Type: t, Data: b}, nil
+}
+
+// ParseAuthData decodes authorization data into v.
+func ParseAuthData(ad AuthData, v any) error {
+	if rest, err := asn1.Unmarshal(ad.Data, v); err != nil || len(rest) > 0 {
+		return NewError(ErrGeneric, "malformed authorization data")
+	}
+	return nil
+}
+
+// FindAuthData returns the first authorization data of type t, if any.
+func FindAuthData(ads []AuthData, t int) (AuthData, bool) {
+	for _, ad := range ads {
+		if ad.Type == t {
+			return ad, true
+		}
+	}
+	return AuthData{}, false
+}
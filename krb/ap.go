@@ -0,0 +1,253 @@
+package krb
+
+import (
+	crypto_rand "crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+)
+
+// ErrMutualAuth is returned by ClientHandshake when the service's AP-REP
+// does not prove it could read the ticket.
+var ErrMutualAuth = errors.New("krb: mutual authentication failed")
+
+// Context is what each side knows after a successful AP exchange.
+type Context struct {
+	Client     string
+	Server     string
+	SessionKey []byte
+	// Subkey protects this connection's traffic, as the subkey of RFC
+	// 4120: the service's from the AP-REP, or the client's from the
+	// authenticator if there was no AP-REP. Unlike SessionKey, it is
+	// fresh for every AP exchange, so connections made with one ticket
+	// never share keys.
+	Subkey []byte
+	// Authenticator is the one the client sent; its SeqNumber is the
+	// client's initial sequence number.
+	Authenticator Authenticator
+	// Ticket is only set on the service side.
+	Ticket *EncTicketPart
+}
+
+// NewAPReq builds an AP-REQ for cred with a fresh authenticator.
+func NewAPReq(cred *Credential, mutual bool) (*APReq, Authenticator, error) {
+	return newAPReq(cred, mutual, UsageAPReqAuth)
+}
+
+func newAPReq(cred *Credential, mutual bool, usage int) (*APReq, Authenticator, error) {
+	seq, err := randomSeq()
+	if err != nil {
+		return nil, Authenticator{}, err
+	}
+	subkey, err := NewKey()
+	if err != nil {
+		return nil, Authenticator{}, err
+	}
+	auth := Authenticator{
+		CName:     cred.Client,
+		CTime:     time.Now().UTC(),
+		SeqNumber: seq,
+		Subkey:    subkey,
+	}
+	encAuth, err := Seal(cred.SessionKey, 0, usage, auth)
+	if err != nil {
+		return nil, Authenticator{}, err
+	}
+	return &APReq{
+		MutualRequired: mutual,
+		Ticket:         cred.Ticket,
+		Authenticator:  encAuth,
+	}, auth, nil
+}
+
+// VerifyAPReq checks an AP-REQ against the service's keytab and records its
+// authenticator in rc so it is only ever accepted once.
+func VerifyAPReq(req *APReq, kt Keytab, rc replay.Cache) (*Context, error) {
+	return verifyAPReq(req, kt, rc, UsageAPReqAuth)
+}
+
+// VerifyTGSReq checks the TGT and authenticator carried in a TGS-REQ.
+func VerifyTGSReq(req *TGSReq, kt Keytab, rc replay.Cache) (*Context, error) {
+	if req.APReq.Ticket.SName != TGS {
+		return nil, NewError(ErrBadMatch, "TGS-REQ must carry a krbtgt ticket")
+	}
+	return verifyAPReq(&req.APReq, kt, rc, UsageTGSReqAuth)
+}
+
+func verifyAPReq(req *APReq, kt Keytab, rc replay.Cache, usage int) (*Context, error) {
+	key, err := kt.Lookup(req.Ticket.SName)
+	if err != nil {
+		return nil, err
+	}
+	var tkt EncTicketPart
+	if err := Open(key.Key, UsageASRepTicket, req.Ticket.EncPart, &tkt); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if now.After(tkt.EndTime) {
+		return nil, NewError(ErrTicketExpired, "ticket expired")
+	}
+
+	var auth Authenticator
+	if err := Open(tkt.SessionKey, usage, req.Authenticator, &auth); err != nil {
+		return nil, err
+	}
+	if auth.CName != tkt.CName {
+		return nil, NewError(ErrBadMatch, "authenticator and ticket name different clients")
+	}
+	if skew := now.Sub(auth.CTime); skew > MaxSkew || skew < -MaxSkew {
+		return nil, NewError(ErrSkew, "clock skew too great")
+	}
+	if len(auth.Subkey) != KeySize {
+		return nil, NewError(ErrBadIntegrity, "authenticator has no subkey")
+	}
+
+	authHash := sha256.Sum256(req.Authenticator.Cipher)
+	err = rc.Check(replay.Key{
+		Principal: auth.CName,
+		Timestamp: auth.CTime,
+		Nonce:     hex.EncodeToString(authHash[:]),
+	})
+	if errors.Is(err, replay.ErrReplay) {
+		return nil, NewError(ErrRepeat, "request is a replay")
+	}
+	if errors.Is(err, replay.ErrExpired) {
+		return nil, NewError(ErrSkew, "clock skew too great")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Context{
+		Client:        tkt.CName,
+		Server:        req.Ticket.SName,
+		SessionKey:    tkt.SessionKey,
+		Subkey:        auth.Subkey,
+		Authenticator: auth,
+		Ticket:        &tkt,
+	}, nil
+}
+
+// NewAPRep answers an accepted AP-REQ, echoing the authenticator time,
+// and switches ctx to a fresh subkey of the service's, sent along.
+func NewAPRep(ctx *Context) (*APRep, error) {
+	subkey, err := NewKey()
+	if err != nil {
+		return nil, err
+	}
+	enc, err := Seal(ctx.SessionKey, 0, UsageAPRepEncPart, EncAPRepPart{
+		CTime:     ctx.Authenticator.CTime,
+		SeqNumber: ctx.Authenticator.SeqNumber,
+		Subkey:    subkey,
+	})
+	if err != nil {
+		return nil, err
+	}
+	ctx.Subkey = subkey
+	return &APRep{EncPart: enc}, nil
+}
+
+// VerifyAPRep checks that rep answers the authenticator auth, and returns
+// the service's subkey.
+func VerifyAPRep(rep *APRep, sessionKey []byte, auth Authenticator) ([]byte, error) {
+	var part EncAPRepPart
+	if err := Open(sessionKey, UsageAPRepEncPart, rep.EncPart, &part); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrMutualAuth, err)
+	}
+	if !part.CTime.Equal(auth.CTime) || part.SeqNumber != auth.SeqNumber {
+		return nil, fmt.Errorf("%w: AP-REP does not match authenticator", ErrMutualAuth)
+	}
+	if len(part.Subkey) != KeySize {
+		return nil, fmt.Errorf("%w: AP-REP has no subkey", ErrMutualAuth)
+	}
+	return part.Subkey, nil
+}
+
+// ClientHandshake runs the client side of a mutually authenticated AP
+// exchange over rw. It fails unless the service returns a valid AP-REP.
+func ClientHandshake(rw io.ReadWriter, cred *Credential) (*Context, error) {
+	req, auth, err := NewAPReq(cred, true)
+	if err != nil {
+		return nil, err
+	}
+	if err := WriteMessage(rw, &Message{APReq: req}); err != nil {
+		return nil, fmt.Errorf("krb: sending AP-REQ: %w", err)
+	}
+	m, err := ReadMessage(rw)
+	if err != nil {
+		return nil, fmt.Errorf("krb: reading AP-REP: %w", err)
+	}
+	if m.KRBError != nil {
+		return nil, m.KRBError
+	}
+	if m.APRep == nil {
+		return nil, fmt.Errorf("%w: expected AP-REP", ErrMutualAuth)
+	}
+	subkey, err := VerifyAPRep(m.APRep, cred.SessionKey, auth)
+	if err != nil {
+		return nil, err
+	}
+	return &Context{
+		Client:        cred.Client,
+		Server:        cred.Server,
+		SessionKey:    cred.SessionKey,
+		Subkey:        subkey,
+		Authenticator: auth,
+	}, nil
+}
+
+// ServerHandshake runs the service side of an AP exchange over rw. If
+// authorize is not nil, it decides whether to admit the authenticated
+// client before any AP-REP is sent; an error it returns that isn't a
+// KRBError is sent as KDC_ERR_POLICY. Failures are reported to the client
+// as a KRB-ERROR before being returned.
+func ServerHandshake(rw io.ReadWriter, kt Keytab, rc replay.Cache, authorize func(*Context) error) (*Context, error) {
+	m, err := ReadMessage(rw)
+	if err != nil {
+		return nil, fmt.Errorf("krb: reading AP-REQ: %w", err)
+	}
+	if m.APReq == nil {
+		err := NewError(ErrGeneric, "expected AP-REQ")
+		WriteError(rw, err)
+		return nil, err
+	}
+	ctx, err := VerifyAPReq(m.APReq, kt, rc)
+	if err != nil {
+		WriteError(rw, err)
+		return nil, err
+	}
+	if authorize != nil {
+		if err := authorize(ctx); err != nil {
+			if _, ok := err.(*KRBError); !ok {
+				err = NewError(ErrPolicy, err.Error())
+			}
+			WriteError(rw, err)
+			return nil, err
+		}
+	}
+	if m.APReq.MutualRequired {
+		rep, err := NewAPRep(ctx)
+		if err != nil {
+			WriteError(rw, err)
+			return nil, err
+		}
+		if err := WriteMessage(rw, &Message{APRep: rep}); err != nil {
+			return nil, fmt.Errorf("krb: sending AP-REP: %w", err)
+		}
+	}
+	return ctx, nil
+}
+
+func randomSeq() (uint32, error) {
+	var b [4]byte
+	if _, err := crypto_rand.Read(b[:]); err != nil {
+		return 0, fmt.Errorf("krb: generating sequence number: %w", err)
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
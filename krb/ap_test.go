@@ -0,0 +1,220 @@
+package krb
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+)
+
+// issue returns a keytab for serv and a credential for alice to it, as
+// the KDC would issue them.
+func issue(t *testing.T) (Keytab, *Credential) {
+	t.Helper()
+	kt := Keytab{}
+	if _, err := kt.Ensure("serv"); err != nil {
+		t.Fatal(err)
+	}
+	sessionKey, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now().UTC()
+	enc, err := Seal(kt["serv"].Key, kt["serv"].KVNO, UsageASRepTicket, EncTicketPart{
+		SessionKey: sessionKey,
+		CName:      "alice",
+		AuthTime:   now,
+		EndTime:    now.Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return kt, &Credential{
+		Client:     "alice",
+		Server:     "serv",
+		Ticket:     Ticket{SName: "serv", EncPart: enc},
+		SessionKey: sessionKey,
+		AuthTime:   now,
+		EndTime:    now.Add(time.Hour),
+	}
+}
+
+// code returns the KRB-ERROR code of err, or 0 if it isn't one.
+func code(err error) int {
+	var ke *KRBError
+	if errors.As(err, &ke) {
+		return ke.Code
+	}
+	return 0
+}
+
+// handshake runs an AP exchange for cred over a pipe and returns what
+// each side got.
+func handshake(t *testing.T, kt Keytab, cred *Credential, rc replay.Cache, authorize func(*Context) error) (client, server *Context, clientErr, serverErr error) {
+	t.Helper()
+	c, s := net.Pipe()
+	defer c.Close()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		defer s.Close()
+		server, serverErr = ServerHandshake(s, kt, rc, authorize)
+	}()
+	client, clientErr = ClientHandshake(c, cred)
+	<-done
+	return
+}
+
+func TestAPExchange(t *testing.T) {
+	kt, cred := issue(t)
+	client, server, err, serr := handshake(t, kt, cred, replay.NewMemoryCache(0), nil)
+	if err != nil || serr != nil {
+		t.Fatalf("client: %v, server: %v", err, serr)
+	}
+	if server.Client != "alice" || server.Server != "serv" || client.Server != "serv" {
+		t.Errorf("got %s to %s, client thinks %s", server.Client, server.Server, client.Server)
+	}
+	if !bytes.Equal(client.Subkey, server.Subkey) {
+		t.Error("client and server ended up with different subkeys")
+	}
+	if bytes.Equal(server.Subkey, server.Authenticator.Subkey) || bytes.Equal(server.Subkey, cred.SessionKey) {
+		t.Error("connection not switched to the service's fresh subkey")
+	}
+	if client.Authenticator.SeqNumber != server.Authenticator.SeqNumber {
+		t.Error("sides disagree on the initial sequence number")
+	}
+}
+
+func TestAPReqReplay(t *testing.T) {
+	kt, cred := issue(t)
+	rc := replay.NewMemoryCache(0)
+	req, _, err := NewAPReq(cred, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAPReq(req, kt, rc); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := VerifyAPReq(req, kt, rc); code(err) != ErrRepeat {
+		t.Errorf("replayed AP-REQ: got %v, want error %d", err, ErrRepeat)
+	}
+}
+
+func TestAPReqRejected(t *testing.T) {
+	kt, cred := issue(t)
+	other, _ := issue(t)
+	for _, tt := range []struct {
+		name   string
+		modify func(req *APReq)
+		want   int
+	}{
+		{"tampered authenticator", func(req *APReq) {
+			req.Authenticator.Cipher = flip(req.Authenticator.Cipher, len(req.Authenticator.Cipher)-1)
+		}, ErrBadIntegrity},
+		{"tampered ticket", func(req *APReq) {
+			req.Ticket.EncPart.Cipher = flip(req.Ticket.EncPart.Cipher, 20)
+		}, ErrBadIntegrity},
+		{"authenticator under another key", func(req *APReq) {
+			req.Authenticator = sealAuth(t, other["serv"].Key, Authenticator{CName: "alice", CTime: time.Now()})
+		}, ErrBadIntegrity},
+		{"authenticator for someone else", func(req *APReq) {
+			req.Authenticator = sealAuth(t, cred.SessionKey, Authenticator{CName: "mallory", CTime: time.Now()})
+		}, ErrBadMatch},
+		{"stale authenticator", func(req *APReq) {
+			req.Authenticator = sealAuth(t, cred.SessionKey, Authenticator{CName: "alice", CTime: time.Now().Add(-MaxSkew - time.Minute)})
+		}, ErrSkew},
+		{"authenticator from the future", func(req *APReq) {
+			req.Authenticator = sealAuth(t, cred.SessionKey, Authenticator{CName: "alice", CTime: time.Now().Add(MaxSkew + time.Minute)})
+		}, ErrSkew},
+		{"unknown service", func(req *APReq) {
+			req.Ticket.SName = "nobody"
+		}, ErrSPrincipalUnknown},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, _, err := NewAPReq(cred, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(req)
+			if _, err := VerifyAPReq(req, kt, replay.NewMemoryCache(0)); code(err) != tt.want {
+				t.Errorf("got %v, want error %d", err, tt.want)
+			}
+		})
+	}
+}
+
+// flip returns a copy of b with a bit of b[i] flipped.
+func flip(b []byte, i int) []byte {
+	b = bytes.Clone(b)
+	b[i] ^= 1
+	return b
+}
+
+// sealAuth seals auth, with a fresh subkey, as an AP-REQ authenticator
+// under key.
+func sealAuth(t *testing.T, key []byte, auth Authenticator) EncryptedData {
+	t.Helper()
+	var err error
+	if auth.Subkey, err = NewKey(); err != nil {
+		t.Fatal(err)
+	}
+	enc, err := Seal(key, 0, UsageAPReqAuth, auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return enc
+}
+
+func TestAPRepRejected(t *testing.T) {
+	_, cred := issue(t)
+	_, auth, err := NewAPReq(cred, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrongKey, err := NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		name string
+		key  []byte
+		part EncAPRepPart
+	}{
+		{"sealed under the wrong key", wrongKey, EncAPRepPart{CTime: auth.CTime, SeqNumber: auth.SeqNumber, Subkey: wrongKey}},
+		{"answering another authenticator", cred.SessionKey, EncAPRepPart{CTime: auth.CTime.Add(time.Second), SeqNumber: auth.SeqNumber, Subkey: wrongKey}},
+		{"with another sequence number", cred.SessionKey, EncAPRepPart{CTime: auth.CTime, SeqNumber: auth.SeqNumber + 1, Subkey: wrongKey}},
+		{"without a subkey", cred.SessionKey, EncAPRepPart{CTime: auth.CTime, SeqNumber: auth.SeqNumber, Subkey: wrongKey[:16]}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, err := Seal(tt.key, 0, UsageAPRepEncPart, tt.part)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := VerifyAPRep(&APRep{EncPart: enc}, cred.SessionKey, auth); !errors.Is(err, ErrMutualAuth) {
+				t.Errorf("got %v, want %v", err, ErrMutualAuth)
+			}
+		})
+	}
+}
+
+func TestServerHandshakeRejects(t *testing.T) {
+	kt, cred := issue(t)
+
+	// a client the service won't admit, or a tampered ticket, gets a
+	// KRB-ERROR in place of the AP-REP
+	_, _, err, serr := handshake(t, kt, cred, replay.NewMemoryCache(0), func(ctx *Context) error {
+		return errors.New("not on the list")
+	})
+	if code(err) != ErrPolicy || code(serr) != ErrPolicy {
+		t.Errorf("refused client: client got %v, server %v; want error %d", err, serr, ErrPolicy)
+	}
+
+	cred.Ticket.EncPart.Cipher = flip(cred.Ticket.EncPart.Cipher, 20)
+	_, _, err, serr = handshake(t, kt, cred, replay.NewMemoryCache(0), nil)
+	if code(err) != ErrBadIntegrity || code(serr) != ErrBadIntegrity {
+		t.Errorf("tampered ticket: client got %v, server %v; want error %d", err, serr, ErrBadIntegrity)
+	}
+}
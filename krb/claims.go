@@ -0,0 +1,68 @@
+package krb
+
+// PAZKAttr is the padata type of PA-ZK-ATTR, which a client sends next to
+// PA-ZK to prove claims about attributes in a KDC-signed credential. Its
+// proof takes the same challenge input as the PA-ZK proof, so it is good
+// for that one exchange only.
+const PAZKAttr = 1601
+
+// ADZKClaims is the authorization data type of AD-ZK-CLAIMS, the claims a
+// client proved when it logged in.
+const ADZKClaims = -1601
+
+// Claim operators.
+const (
+	ClaimEq = 1 // attribute == value
+	ClaimGE = 2 // attribute >= value, numerically
+	ClaimLE = 3 // attribute <= value, numerically
+)
+
+// Claim is a statement about one attribute:
+//
+//	Claim ::= SEQUENCE {
+//	    attribute   [0] UTF8String,
+//	    op          [1] INTEGER,   -- ClaimEq, ClaimGE or ClaimLE
+//	    value       [2] UTF8String
+//	}
+type Claim struct {
+	Attribute string `asn1:"utf8,explicit,tag:0"`
+	Op        int    `asn1:"explicit,tag:1"`
+	Value     string `asn1:"utf8,explicit,tag:2"`
+}
+
+func (c Claim) String() string {
+	op := map[int]string{ClaimEq: "=", ClaimGE: ">=", ClaimLE: "<="}[c.Op]
+	if op == "" {
+		op = "?"
+	}
+	return c.Attribute + op + c.Value
+}
+
+// PAZKAttrReq proves claims in zero knowledge:
+//
+//	PA-ZK-ATTR ::= SEQUENCE {
+//	    circuit-id  [0] UTF8String,
+//	    claims      [1] SEQUENCE OF Claim,
+//	    proof       [2] OCTET STRING
+//	}
+type PAZKAttrReq struct {
+	CircuitID string  `asn1:"utf8,explicit,tag:0"`
+	Claims    []Claim `asn1:"explicit,tag:1"`
+	Proof     []byte  `asn1:"explicit,tag:2"`
+}
+
+// ZKClaims is the content of AD-ZK-CLAIMS:
+//
+//	AD-ZK-CLAIMS ::= SEQUENCE {
+//	    claims      [0] SEQUENCE OF Claim
+//	}
+type ZKClaims struct {
+	Claims []Claim `asn1:"explicit,tag:0"`
+}
+
+// NewPAZKAttr encodes req as PA-ZK-ATTR padata.
+func NewPAZKAttr(req PAZKAttrReq) (PAData, error) {
+	pa, err := NewPAZK(req)
+	pa.Type = PAZKAttr
+	return pa, err
+}
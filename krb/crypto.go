@@ -0,0 +1,88 @@
+package krb
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	crypto_rand "crypto/rand"
+	"encoding/binary"
+	"fmt"
+)
+
+// KeySize is the length of every long-term and session key (AES-256).
+const KeySize = 32
+
+// Key usage numbers, as in RFC 4120 section 7.5.1. They are bound into
+// every ciphertext so that one message can't be passed off as another.
+const (
+	UsageASReqPAEncTS  = 1
+	UsageASRepTicket   = 2
+	UsageASRepEncPart  = 3
+	UsageTGSReqAuth    = 7
+	UsageTGSRepEncPart = 8
+	UsageAPReqAuth     = 11
+	UsageAPRepEncPart  = 12
+)
+
+// EncryptedData is a ciphertext together with the version of the key that
+// produced it.
+type EncryptedData struct {
+	KVNO   int
+	Cipher []byte
+}
+
+// NewKey returns a fresh random key.
+func NewKey() ([]byte, error) {
+	k := make([]byte, KeySize)
+	if _, err := crypto_rand.Read(k); err != nil {
+		return nil, fmt.Errorf("krb: generating key: %w", err)
+	}
+	return k, nil
+}
+
+func usageAD(usage int) []byte {
+	var ad [4]byte
+	binary.BigEndian.PutUint32(ad[:], uint32(usage))
+	return ad[:]
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("krb: bad key: %w", err)
+	}
+	return cipher.NewGCM(block)
+}
+
+// Encrypt seals plaintext under key with AES-256-GCM, binding the key usage.
+func Encrypt(key []byte, kvno, usage int, plaintext []byte) (EncryptedData, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return EncryptedData{}, err
+	}
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := crypto_rand.Read(nonce); err != nil {
+		return EncryptedData{}, fmt.Errorf("krb: generating nonce: %w", err)
+	}
+	return EncryptedData{
+		KVNO:   kvno,
+		Cipher: aead.Seal(nonce, nonce, plaintext, usageAD(usage)),
+	}, nil
+}
+
+// Decrypt opens ed under key, failing with KRB_AP_ERR_BAD_INTEGRITY if the
+// ciphertext was modified or sealed for a different usage.
+func Decrypt(key []byte, usage int, ed EncryptedData) ([]byte, error) {
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(ed.Cipher) < aead.NonceSize() {
+		return nil, NewError(ErrBadIntegrity, "ciphertext too short")
+	}
+	nonce, ct := ed.Cipher[:aead.NonceSize()], ed.Cipher[aead.NonceSize():]
+	pt, err := aead.Open(nil, nonce, ct, usageAD(usage))
+	if err != nil {
+		return nil, NewError(ErrBadIntegrity, "decrypt integrity check failed")
+	}
+	return pt, nil
+}
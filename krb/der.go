@@ -0,0 +1,473 @@
+package krb
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Messages go on the wire in the RFC 4120 ASN.1 DER encoding, so standard
+// Kerberos tooling (wireshark, MIT/Heimdal decoders) can parse them. The
+// encrypted parts stay opaque to those tools: they carry our own etype.
+
+// Realm is the single realm served by the KDC.
+const Realm = "ZK-KERB"
+
+// ETypeAES256GCM identifies our AES-256-GCM encryption. It is not an
+// IANA-registered etype; negative values are reserved for local use.
+const ETypeAES256GCM = -128
+
+const pvno = 5
+
+// Message types, as in RFC 4120 section 7.5.7.
+const (
+	msgTypeASReq    = 10
+	msgTypeASRep    = 11
+	msgTypeTGSReq   = 12
+	msgTypeTGSRep   = 13
+	msgTypeAPReq    = 14
+	msgTypeAPRep    = 15
+	msgTypeKRBError = 30
+	appTagTicket    = 1
+)
+
+// Principal name types, as in RFC 4120 section 6.2.
+const (
+	nameTypePrincipal = 1
+	nameTypeSrvInst   = 2
+)
+
+// PATGSReq carries the AP-REQ of a TGS-REQ in its padata.
+const PATGSReq = 1
+
+// The ASN.1 shapes below follow RFC 4120 section 5 field for field.
+
+type derPrincipalName struct {
+	NameType   int32           `asn1:"explicit,tag:0"`
+	NameString []asn1.RawValue `asn1:"explicit,tag:1"`
+}
+
+type derEncryptedData struct {
+	EType  int32  `asn1:"explicit,tag:0"`
+	KVNO   int    `asn1:"optional,explicit,tag:1"`
+	Cipher []byte `asn1:"explicit,tag:2"`
+}
+
+type derTicket struct {
+	TktVNO  int              `asn1:"explicit,tag:0"`
+	Realm   asn1.RawValue    `asn1:"explicit,tag:1"`
+	SName   derPrincipalName `asn1:"explicit,tag:2"`
+	EncPart derEncryptedData `asn1:"explicit,tag:3"`
+}
+
+type derPAData struct {
+	Type  int32  `asn1:"explicit,tag:1"`
+	Value []byte `asn1:"explicit,tag:2"`
+}
+
+type derKDCReqBody struct {
+	KDCOptions asn1.BitString   `asn1:"explicit,tag:0"`
+	CName      derPrincipalName `asn1:"optional,explicit,tag:1"`
+	Realm      asn1.RawValue    `asn1:"explicit,tag:2"`
+	SName      derPrincipalName `asn1:"optional,explicit,tag:3"`
+	Till       time.Time        `asn1:"generalized,explicit,tag:5"`
+	Nonce      int64            `asn1:"explicit,tag:7"`
+	EType      []int32          `asn1:"explicit,tag:8"`
+}
+
+type derKDCReq struct {
+	PVNO    int           `asn1:"explicit,tag:1"`
+	MsgType int           `asn1:"explicit,tag:2"`
+	PAData  []derPAData   `asn1:"optional,explicit,tag:3"`
+	ReqBody derKDCReqBody `asn1:"explicit,tag:4"`
+}
+
+type derKDCRep struct {
+	PVNO    int              `asn1:"explicit,tag:0"`
+	MsgType int              `asn1:"explicit,tag:1"`
+	PAData  []derPAData      `asn1:"optional,explicit,tag:2"`
+	CRealm  asn1.RawValue    `asn1:"explicit,tag:3"`
+	CName   derPrincipalName `asn1:"explicit,tag:4"`
+	Ticket  asn1.RawValue    `asn1:"explicit,tag:5"`
+	EncPart derEncryptedData `asn1:"explicit,tag:6"`
+}
+
+type derAPReq struct {
+	PVNO          int              `asn1:"explicit,tag:0"`
+	MsgType       int              `asn1:"explicit,tag:1"`
+	APOptions     asn1.BitString   `asn1:"explicit,tag:2"`
+	Ticket        asn1.RawValue    `asn1:"explicit,tag:3"`
+	Authenticator derEncryptedData `asn1:"explicit,tag:4"`
+}
+
+type derAPRep struct {
+	PVNO    int              `asn1:"explicit,tag:0"`
+	MsgType int              `asn1:"explicit,tag:1"`
+	EncPart derEncryptedData `asn1:"explicit,tag:2"`
+}
+
+type derKRBError struct {
+	PVNO      int              `asn1:"explicit,tag:0"`
+	MsgType   int              `asn1:"explicit,tag:1"`
+	STime     time.Time        `asn1:"generalized,explicit,tag:4"`
+	SUSec     int              `asn1:"explicit,tag:5"`
+	ErrorCode int32            `asn1:"explicit,tag:6"`
+	Realm     asn1.RawValue    `asn1:"explicit,tag:9"`
+	SName     derPrincipalName `asn1:"explicit,tag:10"`
+	EText     asn1.RawValue    `asn1:"optional,explicit,tag:11"`
+	EData     []byte           `asn1:"optional,explicit,tag:12"`
+}
+
+// apOptionMutualRequired is bit 2 of APOptions.
+const apOptionMutualRequired = 2
+
+// kerberosString encodes s as a GeneralString, which encoding/asn1 can
+// decode but not produce on its own.
+func kerberosString(s string) asn1.RawValue {
+	return asn1.RawValue{Class: asn1.ClassUniversal, Tag: asn1.TagGeneralString, Bytes: []byte(s)}
+}
+
+// explicit wraps an encoding in an explicit context tag. encoding/asn1
+// ignores field tags when marshaling a RawValue, so RawValue fields are
+// filled with the tag already applied. Unmarshaling checks the tag but
+// leaves it in place: the inner encoding is in the field's Bytes.
+func explicit(tag int, v asn1.RawValue) asn1.RawValue {
+	inner, _ := asn1.Marshal(v)
+	full, _ := asn1.Marshal(asn1.RawValue{Class: asn1.ClassContextSpecific, Tag: tag, IsCompound: true, Bytes: inner})
+	return asn1.RawValue{FullBytes: full}
+}
+
+// unwrap returns the inner value of an explicitly tagged RawValue field.
+func unwrap(raw asn1.RawValue) (asn1.RawValue, error) {
+	var inner asn1.RawValue
+	if _, err := asn1.Unmarshal(raw.Bytes, &inner); err != nil {
+		return inner, NewError(ErrGeneric, "malformed DER: "+err.Error())
+	}
+	return inner, nil
+}
+
+func principalName(name string) derPrincipalName {
+	pn := derPrincipalName{NameType: nameTypePrincipal}
+	parts := strings.Split(name, "/")
+	if name == TGS {
+		pn.NameType = nameTypeSrvInst
+		parts = []string{TGS, Realm}
+	}
+	for _, p := range parts {
+		pn.NameString = append(pn.NameString, kerberosString(p))
+	}
+	return pn
+}
+
+func (pn derPrincipalName) String() string {
+	parts := make([]string, len(pn.NameString))
+	for i, p := range pn.NameString {
+		parts[i] = string(p.Bytes)
+	}
+	if len(parts) == 2 && parts[0] == TGS {
+		return TGS
+	}
+	return strings.Join(parts, "/")
+}
+
+func encryptedData(ed EncryptedData) derEncryptedData {
+	return derEncryptedData{EType: ETypeAES256GCM, KVNO: ed.KVNO, Cipher: ed.Cipher}
+}
+
+func (ed derEncryptedData) decode() (EncryptedData, error) {
+	if ed.EType != ETypeAES256GCM {
+		return EncryptedData{}, NewError(ErrGeneric, fmt.Sprintf("unsupported etype %d", ed.EType))
+	}
+	return EncryptedData{KVNO: ed.KVNO, Cipher: ed.Cipher}, nil
+}
+
+func paData(pas []PAData) []derPAData {
+	var out []derPAData
+	for _, pa := range pas {
+		out = append(out, derPAData{Type: int32(pa.Type), Value: pa.Value})
+	}
+	return out
+}
+
+func fromPAData(pas []derPAData) []PAData {
+	var out []PAData
+	for _, pa := range pas {
+		out = append(out, PAData{Type: int(pa.Type), Value: pa.Value})
+	}
+	return out
+}
+
+// marshalApp DER-encodes v wrapped in [APPLICATION tag].
+func marshalApp(tag int, v any) ([]byte, error) {
+	inner, err := asn1.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("krb: DER encoding: %w", err)
+	}
+	return asn1.Marshal(asn1.RawValue{Class: asn1.ClassApplication, Tag: tag, IsCompound: true, Bytes: inner})
+}
+
+// unmarshalApp decodes b, which must be [APPLICATION tag], into v.
+func unmarshalApp(b []byte, tag int, v any) error {
+	var raw asn1.RawValue
+	rest, err := asn1.Unmarshal(b, &raw)
+	if err != nil {
+		return NewError(ErrGeneric, "malformed DER: "+err.Error())
+	}
+	if len(rest) > 0 || raw.Class != asn1.ClassApplication || raw.Tag != tag {
+		return NewError(ErrGeneric, fmt.Sprintf("expected [APPLICATION %d]", tag))
+	}
+	if _, err := asn1.Unmarshal(raw.Bytes, v); err != nil {
+		return NewError(ErrGeneric, "malformed DER: "+err.Error())
+	}
+	return nil
+}
+
+// marshalTicket encodes t for a field with explicit tag.
+func marshalTicket(tag int, t Ticket) (asn1.RawValue, error) {
+	b, err := marshalApp(appTagTicket, derTicket{
+		TktVNO:  pvno,
+		Realm:   explicit(1, kerberosString(Realm)),
+		SName:   principalName(t.SName),
+		EncPart: encryptedData(t.EncPart),
+	})
+	if err != nil {
+		return asn1.RawValue{}, err
+	}
+	return explicit(tag, asn1.RawValue{FullBytes: b}), nil
+}
+
+// unmarshalTicket decodes an explicitly tagged Ticket field.
+func unmarshalTicket(raw asn1.RawValue) (Ticket, error) {
+	var dt derTicket
+	if err := unmarshalApp(raw.Bytes, appTagTicket, &dt); err != nil {
+		return Ticket{}, err
+	}
+	enc, err := dt.EncPart.decode()
+	return Ticket{SName: dt.SName.String(), EncPart: enc}, err
+}
+
+func marshalAPReq(req *APReq) ([]byte, error) {
+	tkt, err := marshalTicket(3, req.Ticket)
+	if err != nil {
+		return nil, err
+	}
+	opts := asn1.BitString{Bytes: make([]byte, 4), BitLength: 32}
+	if req.MutualRequired {
+		opts.Bytes[0] |= 0x80 >> apOptionMutualRequired
+	}
+	return marshalApp(msgTypeAPReq, derAPReq{
+		PVNO:          pvno,
+		MsgType:       msgTypeAPReq,
+		APOptions:     opts,
+		Ticket:        tkt,
+		Authenticator: encryptedData(req.Authenticator),
+	})
+}
+
+func unmarshalAPReq(b []byte) (*APReq, error) {
+	var d derAPReq
+	if err := unmarshalApp(b, msgTypeAPReq, &d); err != nil {
+		return nil, err
+	}
+	tkt, err := unmarshalTicket(d.Ticket)
+	if err != nil {
+		return nil, err
+	}
+	auth, err := d.Authenticator.decode()
+	if err != nil {
+		return nil, err
+	}
+	return &APReq{
+		MutualRequired: d.APOptions.At(apOptionMutualRequired) == 1,
+		Ticket:         tkt,
+		Authenticator:  auth,
+	}, nil
+}
+
+func kdcReqBody(cname, sname string, till time.Time, nonce uint32) derKDCReqBody {
+	body := derKDCReqBody{
+		KDCOptions: asn1.BitString{Bytes: make([]byte, 4), BitLength: 32},
+		Realm:      explicit(2, kerberosString(Realm)),
+		SName:      principalName(sname),
+		Till:       till.UTC(),
+		Nonce:      int64(nonce),
+		EType:      []int32{ETypeAES256GCM},
+	}
+	if cname != "" {
+		body.CName = principalName(cname)
+	}
+	return body
+}
+
+func marshalKDCRep(msgType int, cname string, tkt Ticket, enc EncryptedData, pas []PAData) ([]byte, error) {
+	t, err := marshalTicket(5, tkt)
+	if err != nil {
+		return nil, err
+	}
+	return marshalApp(msgType, derKDCRep{
+		PVNO:    pvno,
+		MsgType: msgType,
+		PAData:  paData(pas),
+		CRealm:  explicit(3, kerberosString(Realm)),
+		CName:   principalName(cname),
+		Ticket:  t,
+		EncPart: encryptedData(enc),
+	})
+}
+
+func unmarshalKDCRep(b []byte, msgType int) (*derKDCRep, Ticket, EncryptedData, error) {
+	var d derKDCRep
+	if err := unmarshalApp(b, msgType, &d); err != nil {
+		return nil, Ticket{}, EncryptedData{}, err
+	}
+	tkt, err := unmarshalTicket(d.Ticket)
+	if err != nil {
+		return nil, Ticket{}, EncryptedData{}, err
+	}
+	enc, err := d.EncPart.decode()
+	return &d, tkt, enc, err
+}
+
+// Marshal encodes m in RFC 4120 DER.
+func Marshal(m *Message) ([]byte, error) {
+	switch {
+	case m.ASReq != nil:
+		r := m.ASReq
+		return marshalApp(msgTypeASReq, derKDCReq{
+			PVNO:    pvno,
+			MsgType: msgTypeASReq,
+			PAData:  paData(r.PAData),
+			ReqBody: kdcReqBody(r.CName, r.SName, r.Till, r.Nonce),
+		})
+	case m.TGSReq != nil:
+		r := m.TGSReq
+		apReq, err := marshalAPReq(&r.APReq)
+		if err != nil {
+			return nil, err
+		}
+		return marshalApp(msgTypeTGSReq, derKDCReq{
+			PVNO:    pvno,
+			MsgType: msgTypeTGSReq,
+			PAData:  []derPAData{{Type: PATGSReq, Value: apReq}},
+			ReqBody: kdcReqBody("", r.SName, r.Till, r.Nonce),
+		})
+	case m.ASRep != nil:
+		r := m.ASRep
+		return marshalKDCRep(msgTypeASRep, r.CName, r.Ticket, r.EncPart, r.PAData)
+	case m.TGSRep != nil:
+		r := m.TGSRep
+		return marshalKDCRep(msgTypeTGSRep, r.CName, r.Ticket, r.EncPart, nil)
+	case m.APReq != nil:
+		return marshalAPReq(m.APReq)
+	case m.APRep != nil:
+		return marshalApp(msgTypeAPRep, derAPRep{
+			PVNO:    pvno,
+			MsgType: msgTypeAPRep,
+			EncPart: encryptedData(m.APRep.EncPart),
+		})
+	case m.KRBError != nil:
+		e := m.KRBError
+		now := time.Now().UTC()
+		d := derKRBError{
+			PVNO:      pvno,
+			MsgType:   msgTypeKRBError,
+			STime:     now.Truncate(time.Second),
+			SUSec:     now.Nanosecond() / 1000,
+			ErrorCode: int32(e.Code),
+			Realm:     explicit(9, kerberosString(Realm)),
+			SName:     principalName(TGS),
+			EData:     e.Data,
+		}
+		if e.Text != "" {
+			d.EText = explicit(11, kerberosString(e.Text))
+		}
+		return marshalApp(msgTypeKRBError, d)
+	}
+	return nil, fmt.Errorf("krb: empty message")
+}
+
+// Unmarshal decodes a DER-encoded Kerberos message.
+func Unmarshal(b []byte) (*Message, error) {
+	if len(b) == 0 {
+		return nil, NewError(ErrGeneric, "empty message")
+	}
+	// the identifier octet of [APPLICATION n] is 0x60|n for n < 31
+	switch int(b[0] &^ 0x60) {
+	case msgTypeASReq, msgTypeTGSReq:
+		var d derKDCReq
+		tag := int(b[0] &^ 0x60)
+		if err := unmarshalApp(b, tag, &d); err != nil {
+			return nil, err
+		}
+		body := d.ReqBody
+		if tag == msgTypeASReq {
+			return &Message{ASReq: &ASReq{
+				CName:  body.CName.String(),
+				SName:  body.SName.String(),
+				Till:   body.Till,
+				Nonce:  uint32(body.Nonce),
+				PAData: fromPAData(d.PAData),
+			}}, nil
+		}
+		for _, pa := range d.PAData {
+			if pa.Type != PATGSReq {
+				continue
+			}
+			apReq, err := unmarshalAPReq(pa.Value)
+			if err != nil {
+				return nil, err
+			}
+			return &Message{TGSReq: &TGSReq{
+				APReq: *apReq,
+				SName: body.SName.String(),
+				Till:  body.Till,
+				Nonce: uint32(body.Nonce),
+			}}, nil
+		}
+		return nil, NewError(ErrGeneric, "TGS-REQ without PA-TGS-REQ")
+	case msgTypeASRep:
+		d, tkt, enc, err := unmarshalKDCRep(b, msgTypeASRep)
+		if err != nil {
+			return nil, err
+		}
+		return &Message{ASRep: &ASRep{CName: d.CName.String(), Ticket: tkt, EncPart: enc, PAData: fromPAData(d.PAData)}}, nil
+	case msgTypeTGSRep:
+		d, tkt, enc, err := unmarshalKDCRep(b, msgTypeTGSRep)
+		if err != nil {
+			return nil, err
+		}
+		return &Message{TGSRep: &TGSRep{CName: d.CName.String(), Ticket: tkt, EncPart: enc}}, nil
+	case msgTypeAPReq:
+		r, err := unmarshalAPReq(b)
+		if err != nil {
+			return nil, err
+		}
+		return &Message{APReq: r}, nil
+	case msgTypeAPRep:
+		var d derAPRep
+		if err := unmarshalApp(b, msgTypeAPRep, &d); err != nil {
+			return nil, err
+		}
+		enc, err := d.EncPart.decode()
+		if err != nil {
+			return nil, err
+		}
+		return &Message{APRep: &APRep{EncPart: enc}}, nil
+	case msgTypeKRBError:
+		var d derKRBError
+		if err := unmarshalApp(b, msgTypeKRBError, &d); err != nil {
+			return nil, err
+		}
+		ke := &KRBError{Code: int(d.ErrorCode), Data: d.EData}
+		if len(d.EText.Bytes) > 0 {
+			text, err := unwrap(d.EText)
+			if err != nil {
+				return nil, err
+			}
+			ke.Text = string(text.Bytes)
+		}
+		return &Message{KRBError: ke}, nil
+	}
+	return nil, NewError(ErrGeneric, fmt.Sprintf("unknown message tag 0x%02x", b[0]))
+}
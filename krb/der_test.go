@@ -0,0 +1,153 @@
+package krb
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// testMessages has one message of each kind, with the optional fields
+// both set and not.
+func testMessages() map[string]*Message {
+	till := time.Date(2026, 10, 18, 12, 30, 0, 0, time.UTC)
+	enc := func(kvno int, s string) EncryptedData { return EncryptedData{KVNO: kvno, Cipher: []byte(s)} }
+	tkt := Ticket{SName: "serv", EncPart: enc(3, "ticket")}
+	apReq := APReq{MutualRequired: true, Ticket: Ticket{SName: TGS, EncPart: enc(1, "tgt")}, Authenticator: enc(0, "auth")}
+	return map[string]*Message{
+		"AS-REQ": {ASReq: &ASReq{CName: "alice", SName: TGS, Till: till, Nonce: 0xfffffffe}},
+		"AS-REQ with padata": {ASReq: &ASReq{CName: "alice", SName: "host/serv", Till: till, Nonce: 1, PAData: []PAData{
+			{Type: PAEncTimestamp, Value: []byte{1, 2, 3}},
+			{Type: 150, Value: []byte("zk")},
+		}}},
+		"TGS-REQ":            {TGSReq: &TGSReq{APReq: apReq, SName: "serv", Till: till, Nonce: 7}},
+		"AS-REP":             {ASRep: &ASRep{CName: "alice", Ticket: tkt, EncPart: enc(0, "reply")}},
+		"AS-REP with padata": {ASRep: &ASRep{CName: "alice", Ticket: tkt, EncPart: enc(0, "reply"), PAData: []PAData{{Type: 151, Value: []byte("dh")}}}},
+		"TGS-REP":            {TGSRep: &TGSRep{CName: "alice", Ticket: tkt, EncPart: enc(0, "reply")}},
+		"AP-REQ":             {APReq: &APReq{Ticket: tkt, Authenticator: enc(0, "auth")}},
+		"mutual AP-REQ":      {APReq: &APReq{MutualRequired: true, Ticket: tkt, Authenticator: enc(0, "auth")}},
+		"AP-REP":             {APRep: &APRep{EncPart: enc(0, "rep")}},
+		"KRB-ERROR":          {KRBError: &KRBError{Code: ErrPreauthRequired, Text: "preauth required", Data: []byte("challenge")}},
+		"bare KRB-ERROR":     {KRBError: &KRBError{Code: ErrGeneric}},
+	}
+}
+
+func TestMarshalRoundTrip(t *testing.T) {
+	for name, m := range testMessages() {
+		t.Run(name, func(t *testing.T) {
+			der, err := Marshal(m)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := Unmarshal(der)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, m) {
+				t.Errorf("got %+v, want %+v", got, m)
+			}
+		})
+	}
+}
+
+func TestMarshalEmpty(t *testing.T) {
+	if _, err := Marshal(&Message{}); err == nil {
+		t.Error("encoded a message with nothing in it")
+	}
+}
+
+// withLength returns der with its outer length set to n, in long form.
+func withLength(der []byte, n uint32) []byte {
+	body := der[2:]
+	if der[1]&0x80 != 0 {
+		body = der[2+int(der[1]&0x7f):]
+	}
+	out := []byte{der[0], 0x84, 0, 0, 0, 0}
+	binary.BigEndian.PutUint32(out[2:], n)
+	return append(out, body...)
+}
+
+func TestUnmarshalMalformed(t *testing.T) {
+	msgs := testMessages()
+	der := map[string][]byte{}
+	for name, m := range msgs {
+		b, err := Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der[name] = b
+	}
+	apRep, err := Marshal(&Message{APRep: &APRep{EncPart: EncryptedData{Cipher: []byte("rep")}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherEType := bytes.Replace(apRep, []byte{0x02, 0x01, 0x80}, []byte{0x02, 0x01, 0x12}, 1)
+	if bytes.Equal(otherEType, apRep) {
+		t.Fatal("etype not found in AP-REP")
+	}
+	tgsReq, err := Marshal(msgs["TGS-REQ"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	noTGSPA := bytes.Replace(tgsReq, []byte{0xa1, 0x03, 0x02, 0x01, PATGSReq}, []byte{0xa1, 0x03, 0x02, 0x01, 9}, 1)
+
+	for _, tt := range []struct {
+		name string
+		der  []byte
+	}{
+		{"empty", nil},
+		{"unknown tag", []byte{0x7f, 0x00}},
+		{"not application class", append([]byte{0x30}, apRep[1:]...)},
+		{"body of another message", append([]byte{0x60 | msgTypeASReq}, apRep[1:]...)},
+		{"trailing bytes", append(bytes.Clone(apRep), 0)},
+		{"length past the end", withLength(apRep, uint32(len(apRep))-1)},
+		{"oversized length", withLength(apRep, 0xffffffff)},
+		{"length short of the end", withLength(apRep, uint32(len(apRep))-3)},
+		{"unknown etype", otherEType},
+		{"TGS-REQ without its AP-REQ", noTGSPA},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			if m, err := Unmarshal(tt.der); code(err) != ErrGeneric {
+				t.Errorf("got %+v, %v; want error %d", m, err, ErrGeneric)
+			}
+		})
+	}
+
+	// every message cut short anywhere fails, and doesn't panic
+	for name, b := range der {
+		for n := range len(b) {
+			if m, err := Unmarshal(b[:n]); code(err) != ErrGeneric {
+				t.Errorf("%s cut to %d of %d bytes: got %+v, %v", name, n, len(b), m, err)
+			}
+		}
+	}
+}
+
+func TestReadFrame(t *testing.T) {
+	der, err := Marshal(&Message{KRBError: &KRBError{Code: ErrGeneric, Text: "x"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := WriteFrame(&buf, der); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+	if got, err := ReadFrame(bytes.NewReader(frame)); err != nil || !bytes.Equal(got, der) {
+		t.Errorf("got %x, %v", got, err)
+	}
+
+	for n := range len(frame) {
+		if _, err := ReadFrame(bytes.NewReader(frame[:n])); !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Errorf("frame cut to %d bytes: got %v", n, err)
+		}
+	}
+
+	huge := binary.BigEndian.AppendUint32(nil, MaxMessageSize+1)
+	if _, err := ReadFrame(bytes.NewReader(append(huge, der...))); err == nil {
+		t.Error("read a frame over MaxMessageSize")
+	}
+}
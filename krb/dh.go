@@ -0,0 +1,42 @@
+package krb
+
+import (
+	crypto_rand "crypto/rand"
+	"crypto/sha256"
+	"math/big"
+)
+
+// DH group used to agree the AS reply key in PA-ZK (RFC 3526 group 5).
+var (
+	dhPrime, _ = new(big.Int).SetString("FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1"+
+		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD"+
+		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245"+
+		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED"+
+		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D"+
+		"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F"+
+		"83655D23DCA3AD961C62F356208552BB9ED529077096966D"+
+		"670C354E4ABC9804F1746C08CA237327FFFFFFFFFFFFFFFF", 16)
+	dhGenerator = big.NewInt(2)
+)
+
+// NewDHKey returns a fresh private exponent and the matching public value.
+func NewDHKey() (priv *big.Int, pub []byte, err error) {
+	priv, err = crypto_rand.Int(crypto_rand.Reader, dhPrime)
+	if err != nil {
+		return nil, nil, err
+	}
+	return priv, new(big.Int).Exp(dhGenerator, priv, dhPrime).Bytes(), nil
+}
+
+// DHReplyKey derives the reply key from our private exponent and the
+// peer's public value.
+func DHReplyKey(priv *big.Int, peerPub []byte) ([]byte, error) {
+	y := new(big.Int).SetBytes(peerPub)
+	// reject 0, 1 and p-1, which would force a predictable secret
+	if y.Cmp(big.NewInt(1)) <= 0 || y.Cmp(new(big.Int).Sub(dhPrime, big.NewInt(1))) >= 0 {
+		return nil, NewError(ErrPreauthFailed, "bad DH public value")
+	}
+	shared := new(big.Int).Exp(y, priv, dhPrime)
+	key := sha256.Sum256(shared.Bytes())
+	return key[:], nil
+}
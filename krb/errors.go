@@ -0,0 +1,40 @@
+package krb
+
+import "fmt"
+
+// Error codes, as in RFC 4120 section 7.5.9.
+const (
+	ErrCPrincipalUnknown = 6
+	ErrSPrincipalUnknown = 7
+	ErrPolicy            = 12
+	ErrClientRevoked     = 18
+	ErrTGTRevoked        = 20
+	ErrPreauthFailed     = 24
+	ErrPreauthRequired   = 25
+	ErrTicketExpired     = 32
+	ErrRepeat            = 34
+	ErrBadMatch          = 36
+	ErrSkew              = 37
+	ErrModified          = 41
+	ErrBadIntegrity      = 31
+	ErrResponseTooBig    = 52
+	ErrGeneric           = 60
+)
+
+// KRBError is sent in place of a reply when a request fails.
+type KRBError struct {
+	Code int
+	Text string
+	// Data is the error's e-data, e.g. hints on which pre-authentication
+	// the KDC wants.
+	Data []byte
+}
+
+// NewError returns a KRBError with the given code and text.
+func NewError(code int, text string) *KRBError {
+	return &KRBError{Code: code, Text: text}
+}
+
+func (e *KRBError) Error() string {
+	return fmt.Sprintf("krb error %d: %s", e.Code, e.Text)
+}
@@ -0,0 +1,352 @@
+package krb
+
+import (
+	crypto_rand "crypto/rand"
+	"encoding/asn1"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"net"
+	"net/http"
+	"time"
+)
+
+// udpRetries are the timeouts for successive UDP attempts; retransmitting
+// is safe because the KDC answers a repeated request from its lookaside
+// cache.
+var udpRetries = []time.Duration{time.Second, 2 * time.Second, 4 * time.Second}
+
+// KDCConn is a connection to the KDC. Any number of AS and TGS exchanges
+// can run on it.
+type KDCConn struct {
+	addr      string // host:port, or the URL of a KDC proxy
+	preferUDP bool
+	proxy     *http.Client // set when talking to a KDC proxy
+	conn      net.Conn     // TCP, dialled lazily when UDP is preferred
+}
+
+// DialKDC connects to the KDC at addr over TCP.
+func DialKDC(addr string) (*KDCConn, error) {
+	k := &KDCConn{addr: addr}
+	if err := k.dialTCP(); err != nil {
+		return nil, err
+	}
+	return k, nil
+}
+
+// DialKDCUDP returns a KDC connection that sends each request over UDP
+// first, and retries it over TCP when the reply is too big for a datagram.
+func DialKDCUDP(addr string) (*KDCConn, error) {
+	if _, err := net.ResolveUDPAddr("udp", addr); err != nil {
+		return nil, fmt.Errorf("krb: bad KDC address: %w", err)
+	}
+	return &KDCConn{addr: addr, preferUDP: true}, nil
+}
+
+func (k *KDCConn) dialTCP() error {
+	conn, err := net.DialTimeout("tcp", k.addr, 5*time.Second)
+	if err != nil {
+		return fmt.Errorf("krb: cannot connect to KDC: %w", err)
+	}
+	k.conn = conn
+	return nil
+}
+
+// Close closes the connection to the KDC.
+func (k *KDCConn) Close() error {
+	if k.conn == nil {
+		return nil
+	}
+	return k.conn.Close()
+}
+
+// AS requests a ticket for sname, pre-authenticating with PA-ENC-TIMESTAMP
+// under the client's long-term key, which is also the reply key.
+func (k *KDCConn) AS(cname, sname string, key KeytabEntry) (*Credential, error) {
+	nonce, err := NewNonce()
+	if err != nil {
+		return nil, err
+	}
+	pa, err := NewPAEncTimestamp(key)
+	if err != nil {
+		return nil, err
+	}
+	req := &ASReq{CName: cname, SName: sname, Nonce: nonce, PAData: []PAData{pa}}
+	m, err := k.roundTrip(&Message{ASReq: req})
+	if err != nil {
+		return nil, err
+	}
+	if m.ASRep == nil {
+		return nil, fmt.Errorf("krb: expected AS-REP")
+	}
+	return DecryptASRep(m.ASRep, key.Key, nonce)
+}
+
+// Prover answers a PA-ZK challenge with a proof whose public challenge
+// input is binding (see ZKBinding).
+type Prover func(ch *PAZKChallenge, binding []byte) ([]byte, error)
+
+// ASZK requests a ticket for sname, pre-authenticating with a
+// zero-knowledge proof: it asks for the KDC's challenge, has prove answer
+// it, and derives the reply key from the DH exchange carried alongside.
+func (k *KDCConn) ASZK(cname, sname string, prove Prover) (*Credential, error) {
+	return k.ASZKClaims(cname, sname, prove, nil)
+}
+
+// ClaimProver proves claims about the client's attributes over the same
+// challenge binding as the login proof, returning PA-ZK-ATTR padata.
+type ClaimProver func(ch *PAZKChallenge, binding []byte) (PAData, error)
+
+// ASZKClaims is ASZK, also proving claims that the ticket is to carry as
+// AD-ZK-CLAIMS. A nil claims proves none.
+func (k *KDCConn) ASZKClaims(cname, sname string, prove Prover, claims ClaimProver) (*Credential, error) {
+	return k.asZK(cname, sname, func(ch *PAZKChallenge, binding []byte) (PAZKReq, []PAData, error) {
+		proof, err := prove(ch, binding)
+		if err != nil || claims == nil {
+			return PAZKReq{Proof: proof}, nil, err
+		}
+		pa, err := claims(ch, binding)
+		return PAZKReq{Proof: proof}, []PAData{pa}, err
+	})
+}
+
+// GroupProver answers a PA-ZK challenge as some member of a group, without
+// saying which; it returns the proof and the nullifier it commits to.
+type GroupProver func(ch *PAZKChallenge, binding []byte) (proof, nullifier []byte, err error)
+
+// ASZKAnonymous requests an anonymous ticket for sname, pre-authenticating
+// with proof of membership of group. The ticket names Anonymous as the
+// client and carries the group in its authorization data.
+func (k *KDCConn) ASZKAnonymous(group, sname string, prove GroupProver) (*Credential, error) {
+	return k.asZK(Anonymous, sname, func(ch *PAZKChallenge, binding []byte) (PAZKReq, []PAData, error) {
+		proof, nullifier, err := prove(ch, binding)
+		return PAZKReq{Proof: proof, Group: group, Nullifier: nullifier}, nil, err
+	})
+}
+
+// asZK runs the PA-ZK exchange; answer fills in the proof-specific fields
+// of the PA-ZK-REQ and returns any padata to send along with it.
+func (k *KDCConn) asZK(cname, sname string, answer func(*PAZKChallenge, []byte) (PAZKReq, []PAData, error)) (*Credential, error) {
+	nonce, err := NewNonce()
+	if err != nil {
+		return nil, err
+	}
+	req := &ASReq{CName: cname, SName: sname, Nonce: nonce}
+
+	// first attempt carries no padata and fetches the challenge
+	ch, err := k.challenge(req)
+	if err != nil {
+		return nil, err
+	}
+
+	priv, pub, err := NewDHKey()
+	if err != nil {
+		return nil, err
+	}
+	z, extra, err := answer(ch, ZKBinding(ch.Challenge, pub))
+	if err != nil {
+		return nil, fmt.Errorf("krb: proving: %w", err)
+	}
+	z.CircuitID, z.Challenge, z.DHPublic = ch.CircuitID, ch.Challenge, pub
+	pa, err := NewPAZK(z)
+	if err != nil {
+		return nil, err
+	}
+	req.PAData = append([]PAData{pa}, extra...)
+	return k.asZKReply(req, priv)
+}
+
+// challenge sends req, which carries no padata, and returns the PA-ZK
+// challenge the KDC answers it with.
+func (k *KDCConn) challenge(req *ASReq) (*PAZKChallenge, error) {
+	_, err := k.roundTrip(&Message{ASReq: req})
+	ke, ok := err.(*KRBError)
+	if !ok || ke.Code != ErrPreauthRequired {
+		if err == nil {
+			err = fmt.Errorf("krb: KDC issued a ticket without pre-authentication")
+		}
+		return nil, err
+	}
+	return ChallengeFromError(ke)
+}
+
+// asZKReply sends req, which answers a PA-ZK challenge with the DH key
+// priv, and decrypts the AS-REP.
+func (k *KDCConn) asZKReply(req *ASReq, priv *big.Int) (*Credential, error) {
+	m, err := k.roundTrip(&Message{ASReq: req})
+	if err != nil {
+		return nil, err
+	}
+	if m.ASRep == nil {
+		return nil, fmt.Errorf("krb: expected AS-REP")
+	}
+	repPA, ok := FindPAData(m.ASRep.PAData, PAZK)
+	if !ok {
+		return nil, NewError(ErrPreauthFailed, "AS-REP carries no PA-ZK")
+	}
+	var rep PAZKRep
+	if err := ParsePAZK(repPA, &rep); err != nil {
+		return nil, err
+	}
+	replyKey, err := DHReplyKey(priv, rep.DHPublic)
+	if err != nil {
+		return nil, err
+	}
+	return DecryptASRep(m.ASRep, replyKey, req.Nonce)
+}
+
+// ChallengeFromError extracts the PA-ZK challenge from a PREAUTH_REQUIRED
+// error.
+func ChallengeFromError(ke *KRBError) (*PAZKChallenge, error) {
+	pas, err := UnmarshalMethodData(ke.Data)
+	if err != nil {
+		return nil, err
+	}
+	pa, ok := FindPAData(pas, PAZK)
+	if !ok {
+		return nil, NewError(ErrPreauthFailed, "KDC did not offer PA-ZK")
+	}
+	var ch PAZKChallenge
+	if err := ParsePAZK(pa, &ch); err != nil {
+		return nil, err
+	}
+	return &ch, nil
+}
+
+// TGS uses tgt to request a ticket for sname.
+func (k *KDCConn) TGS(tgt *Credential, sname string) (*Credential, error) {
+	nonce, err := NewNonce()
+	if err != nil {
+		return nil, err
+	}
+	apReq, _, err := newAPReq(tgt, false, UsageTGSReqAuth)
+	if err != nil {
+		return nil, err
+	}
+	m, err := k.roundTrip(&Message{TGSReq: &TGSReq{APReq: *apReq, SName: sname, Nonce: nonce}})
+	if err != nil {
+		return nil, err
+	}
+	if m.TGSRep == nil {
+		return nil, fmt.Errorf("krb: expected TGS-REP")
+	}
+	return DecryptTGSRep(m.TGSRep, tgt, nonce)
+}
+
+func (k *KDCConn) roundTrip(req *Message) (*Message, error) {
+	der, err := Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+
+	var m *Message
+	if k.proxy != nil {
+		if m, err = k.exchangeProxy(der); err != nil {
+			return nil, err
+		}
+		return reply(m)
+	}
+	if k.preferUDP {
+		if m, err = k.exchangeUDP(der); err != nil {
+			return nil, err
+		}
+		if m.KRBError == nil || m.KRBError.Code != ErrResponseTooBig {
+			return reply(m)
+		}
+	}
+
+	if k.conn == nil {
+		if err := k.dialTCP(); err != nil {
+			return nil, err
+		}
+	}
+	if err := WriteFrame(k.conn, der); err != nil {
+		return nil, fmt.Errorf("krb: sending request: %w", err)
+	}
+	if m, err = ReadMessage(k.conn); err != nil {
+		return nil, fmt.Errorf("krb: reading reply: %w", err)
+	}
+	return reply(m)
+}
+
+// exchangeUDP sends der as a single datagram, retransmitting until a reply
+// arrives. Each exchange uses its own socket, so a late reply to an earlier
+// retransmission can't be mistaken for the answer to a later request.
+func (k *KDCConn) exchangeUDP(der []byte) (*Message, error) {
+	if len(der) > MaxDatagram {
+		return nil, fmt.Errorf("krb: request of %d bytes is too big for UDP", len(der))
+	}
+	conn, err := net.Dial("udp", k.addr)
+	if err != nil {
+		return nil, fmt.Errorf("krb: cannot reach KDC: %w", err)
+	}
+	defer conn.Close()
+
+	buf := make([]byte, MaxDatagram)
+	for _, timeout := range udpRetries {
+		if _, err := conn.Write(der); err != nil {
+			return nil, fmt.Errorf("krb: sending request: %w", err)
+		}
+		conn.SetReadDeadline(time.Now().Add(timeout))
+		n, err := conn.Read(buf)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("krb: reading reply: %w", err)
+		}
+		return Unmarshal(buf[:n])
+	}
+	return nil, fmt.Errorf("krb: no reply from KDC at %s", k.addr)
+}
+
+// reply turns a KRB-ERROR reply into an error.
+func reply(m *Message) (*Message, error) {
+	if m.KRBError != nil {
+		return nil, m.KRBError
+	}
+	return m, nil
+}
+
+// NewPAEncTimestamp seals the current time under key.
+func NewPAEncTimestamp(key KeytabEntry) (PAData, error) {
+	enc, err := Seal(key.Key, key.KVNO, UsageASReqPAEncTS, PAEncTSEnc{Timestamp: time.Now().UTC()})
+	if err != nil {
+		return PAData{}, err
+	}
+	value, err := asn1.Marshal(encryptedData(enc))
+	if err != nil {
+		return PAData{}, err
+	}
+	return PAData{Type: PAEncTimestamp, Value: value}, nil
+}
+
+// VerifyPAEncTimestamp checks a PA-ENC-TIMESTAMP against the client's key
+// and returns the timestamp it carries.
+func VerifyPAEncTimestamp(pa PAData, key KeytabEntry) (time.Time, error) {
+	var d derEncryptedData
+	if _, err := asn1.Unmarshal(pa.Value, &d); err != nil {
+		return time.Time{}, NewError(ErrPreauthFailed, "malformed PA-ENC-TIMESTAMP")
+	}
+	enc, err := d.decode()
+	if err != nil {
+		return time.Time{}, err
+	}
+	var ts PAEncTSEnc
+	if err := Open(key.Key, UsageASReqPAEncTS, enc, &ts); err != nil {
+		return time.Time{}, NewError(ErrPreauthFailed, "PA-ENC-TIMESTAMP does not decrypt")
+	}
+	if skew := time.Since(ts.Timestamp); skew > MaxSkew || skew < -MaxSkew {
+		return time.Time{}, NewError(ErrSkew, "clock skew too great")
+	}
+	return ts.Timestamp, nil
+}
+
+// NewNonce returns a random request nonce.
+func NewNonce() (uint32, error) {
+	var b [4]byte
+	if _, err := crypto_rand.Read(b[:]); err != nil {
+		return 0, fmt.Errorf("krb: generating nonce: %w", err)
+	}
+	return binary.BigEndian.Uint32(b[:]), nil
+}
@@ -0,0 +1,70 @@
+package krb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// KeytabEntry is a principal's long-term key.
+type KeytabEntry struct {
+	KVNO int    `json:"kvno"`
+	Key  []byte `json:"key"`
+}
+
+// Keytab maps principal names to their long-term keys.
+type Keytab map[string]KeytabEntry
+
+// LoadKeytab reads a keytab from a JSON file. A missing file yields an
+// empty keytab.
+func LoadKeytab(path string) (Keytab, error) {
+	b, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Keytab{}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("krb: reading keytab: %w", err)
+	}
+	kt := Keytab{}
+	if err := json.Unmarshal(b, &kt); err != nil {
+		return nil, fmt.Errorf("krb: parsing keytab %s: %w", path, err)
+	}
+	return kt, nil
+}
+
+// Save writes the keytab to path, readable only by its owner.
+func (kt Keytab) Save(path string) error {
+	b, err := json.MarshalIndent(kt, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, b, 0o600)
+}
+
+// Ensure adds a fresh random key for each principal that has none and
+// reports whether anything was added.
+func (kt Keytab) Ensure(principals ...string) (bool, error) {
+	added := false
+	for _, p := range principals {
+		if _, ok := kt[p]; ok {
+			continue
+		}
+		k, err := NewKey()
+		if err != nil {
+			return added, err
+		}
+		kt[p] = KeytabEntry{KVNO: 1, Key: k}
+		added = true
+	}
+	return added, nil
+}
+
+// Lookup returns the key for principal, or KDC_ERR_S_PRINCIPAL_UNKNOWN.
+func (kt Keytab) Lookup(principal string) (KeytabEntry, error) {
+	e, ok := kt[principal]
+	if !ok {
+		return KeytabEntry{}, NewError(ErrSPrincipalUnknown, "no key for "+principal)
+	}
+	return e, nil
+}
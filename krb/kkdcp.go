@@ -0,0 +1,98 @@
+package krb
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// KDC proxy (MS-KKDCP): Kerberos messages POSTed over HTTPS, for clients
+// that can only reach the KDC through a web proxy or firewall.
+const (
+	// ProxyPath is where the KDC serves the proxy.
+	ProxyPath = "/KdcProxy"
+	// ProxyContentType is the media type of proxy requests and replies.
+	ProxyContentType = "application/kerberos"
+)
+
+// proxyMessage is KDC-PROXY-MESSAGE (MS-KKDCP section 2.2.2):
+//
+//	KDC-PROXY-MESSAGE ::= SEQUENCE {
+//	    kerb-message    [0] OCTET STRING,   -- as sent over TCP, length prefix included
+//	    target-domain   [1] KERB-REALM OPTIONAL,
+//	    dclocator-hint  [2] INTEGER OPTIONAL
+//	}
+type proxyMessage struct {
+	KerbMessage   []byte        `asn1:"explicit,tag:0"`
+	TargetDomain  asn1.RawValue `asn1:"optional,explicit,tag:1"`
+	DCLocatorHint int           `asn1:"optional,explicit,tag:2"`
+}
+
+// MarshalProxyMessage wraps an encoded Kerberos message for the proxy.
+func MarshalProxyMessage(der []byte, realm string) ([]byte, error) {
+	var framed bytes.Buffer
+	if err := WriteFrame(&framed, der); err != nil {
+		return nil, err
+	}
+	pm := proxyMessage{KerbMessage: framed.Bytes()}
+	if realm != "" {
+		pm.TargetDomain = explicit(1, kerberosString(realm))
+	}
+	return asn1.Marshal(pm)
+}
+
+// UnmarshalProxyMessage returns the Kerberos message and target realm
+// carried in a KDC-PROXY-MESSAGE.
+func UnmarshalProxyMessage(b []byte) (der []byte, realm string, err error) {
+	var pm proxyMessage
+	if rest, err := asn1.Unmarshal(b, &pm); err != nil || len(rest) > 0 {
+		return nil, "", NewError(ErrGeneric, "malformed KDC-PROXY-MESSAGE")
+	}
+	if len(pm.TargetDomain.Bytes) > 0 {
+		inner, err := unwrap(pm.TargetDomain)
+		if err != nil {
+			return nil, "", err
+		}
+		realm = string(inner.Bytes)
+	}
+	r := bytes.NewReader(pm.KerbMessage)
+	if der, err = ReadFrame(r); err != nil || r.Len() > 0 {
+		return nil, "", NewError(ErrGeneric, "malformed kerb-message")
+	}
+	return der, realm, nil
+}
+
+// DialKDCProxy returns a KDC connection that sends each request to the KDC
+// proxy at url. A nil client means http.DefaultClient.
+func DialKDCProxy(url string, client *http.Client) (*KDCConn, error) {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	return &KDCConn{addr: url, proxy: client}, nil
+}
+
+func (k *KDCConn) exchangeProxy(der []byte) (*Message, error) {
+	body, err := MarshalProxyMessage(der, Realm)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := k.proxy.Post(k.addr, ProxyContentType, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("krb: cannot reach KDC proxy: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("krb: KDC proxy: %s", resp.Status)
+	}
+	b, err := io.ReadAll(io.LimitReader(resp.Body, MaxMessageSize+64))
+	if err != nil {
+		return nil, fmt.Errorf("krb: reading reply: %w", err)
+	}
+	reply, _, err := UnmarshalProxyMessage(b)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(reply)
+}
@@ -0,0 +1,220 @@
+// Package krb holds the Kerberos-style messages exchanged between the
+// client, the KDC and services, and the crypto that protects them.
+package krb
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+	"time"
+)
+
+// TGS is the principal name of the ticket-granting service.
+const TGS = "krbtgt"
+
+// MaxSkew is the largest clock difference tolerated between peers.
+const MaxSkew = 5 * time.Minute
+
+// Ticket is presented by a client to a service. Only the service (and the
+// KDC) can read EncPart.
+type Ticket struct {
+	SName   string
+	EncPart EncryptedData // EncTicketPart under the service key
+}
+
+// EncTicketPart is the secret part of a Ticket.
+type EncTicketPart struct {
+	SessionKey []byte
+	CName      string
+	AuthTime   time.Time
+	EndTime    time.Time
+	// AuthorizationData says what the client may do, on top of who it is.
+	// The KDC copies it from a TGT into the tickets issued with it.
+	AuthorizationData []AuthData
+}
+
+// AuthData is one element of a ticket's authorization data.
+type AuthData struct {
+	Type int
+	Data []byte
+}
+
+// Pre-authentication data types, as in RFC 4120 section 7.5.2.
+const (
+	PAEncTimestamp = 2
+)
+
+// PAData carries pre-authentication data in a request.
+type PAData struct {
+	Type  int
+	Value []byte
+}
+
+// PAEncTSEnc is sealed under the client's long-term key to prove it holds
+// the key (PA-ENC-TIMESTAMP).
+type PAEncTSEnc struct {
+	Timestamp time.Time
+}
+
+// ASReq asks the KDC for a ticket to SName on behalf of CName.
+type ASReq struct {
+	CName  string
+	SName  string
+	Till   time.Time
+	Nonce  uint32
+	PAData []PAData
+}
+
+// TGSReq asks the KDC for a ticket to SName using a TGT, which is carried
+// in the AP-REQ.
+type TGSReq struct {
+	APReq APReq
+	SName string
+	Till  time.Time
+	Nonce uint32
+}
+
+// TGSRep answers a TGSReq. EncPart is sealed under the TGT session key.
+type TGSRep struct {
+	CName   string
+	Ticket  Ticket
+	EncPart EncryptedData // EncKDCRepPart
+}
+
+// ASRep answers an ASReq. EncPart is sealed under the client's reply key.
+type ASRep struct {
+	CName   string
+	Ticket  Ticket
+	EncPart EncryptedData // EncKDCRepPart
+	PAData  []PAData
+}
+
+// EncKDCRepPart tells the client the session key that is inside the ticket.
+type EncKDCRepPart struct {
+	SessionKey []byte
+	Nonce      uint32
+	SName      string
+	AuthTime   time.Time
+	EndTime    time.Time
+}
+
+// APReq authenticates a client to a service.
+type APReq struct {
+	MutualRequired bool
+	Ticket         Ticket
+	Authenticator  EncryptedData // Authenticator under the session key
+}
+
+// Authenticator proves the client holds the ticket's session key right now.
+// Subkey is a fresh key of the client's for this AP exchange alone.
+type Authenticator struct {
+	CName     string
+	CTime     time.Time
+	SeqNumber uint32
+	Subkey    []byte
+}
+
+// APRep proves to the client that the service could read its ticket.
+type APRep struct {
+	EncPart EncryptedData // EncAPRepPart under the session key
+}
+
+// EncAPRepPart echoes the authenticator timestamp back to the client, with
+// the service's fresh subkey for the connection.
+type EncAPRepPart struct {
+	CTime     time.Time
+	SeqNumber uint32
+	Subkey    []byte
+}
+
+// Message is the unit sent on the wire. Exactly one field is set.
+type Message struct {
+	ASReq    *ASReq
+	ASRep    *ASRep
+	TGSReq   *TGSReq
+	TGSRep   *TGSRep
+	APReq    *APReq
+	APRep    *APRep
+	KRBError *KRBError
+}
+
+// Credential is a ticket together with the session key needed to use it.
+type Credential struct {
+	Client     string
+	Server     string
+	Ticket     Ticket
+	SessionKey []byte
+	AuthTime   time.Time
+	EndTime    time.Time
+}
+
+func encodeGob(v any) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(v); err != nil {
+		return nil, fmt.Errorf("krb: encoding %T: %w", v, err)
+	}
+	return buf.Bytes(), nil
+}
+
+func decodeGob(b []byte, v any) error {
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(v); err != nil {
+		return NewError(ErrGeneric, fmt.Sprintf("decoding %T: %v", v, err))
+	}
+	return nil
+}
+
+// Seal gob-encodes v and encrypts it under key.
+func Seal(key []byte, kvno, usage int, v any) (EncryptedData, error) {
+	b, err := encodeGob(v)
+	if err != nil {
+		return EncryptedData{}, err
+	}
+	return Encrypt(key, kvno, usage, b)
+}
+
+// Open decrypts ed under key and gob-decodes it into v.
+func Open(key []byte, usage int, ed EncryptedData, v any) error {
+	pt, err := Decrypt(key, usage, ed)
+	if err != nil {
+		return err
+	}
+	return decodeGob(pt, v)
+}
+
+// DecryptASRep opens an AS reply with the client's reply key and checks it
+// answers the request carrying nonce.
+func DecryptASRep(rep *ASRep, replyKey []byte, nonce uint32) (*Credential, error) {
+	return decryptKDCRep(rep.CName, rep.Ticket, rep.EncPart, replyKey, UsageASRepEncPart, nonce)
+}
+
+// DecryptTGSRep opens a TGS reply with the TGT session key and checks it
+// answers the request carrying nonce.
+func DecryptTGSRep(rep *TGSRep, tgt *Credential, nonce uint32) (*Credential, error) {
+	return decryptKDCRep(rep.CName, rep.Ticket, rep.EncPart, tgt.SessionKey, UsageTGSRepEncPart, nonce)
+}
+
+func decryptKDCRep(cname string, tkt Ticket, enc EncryptedData, key []byte, usage int, nonce uint32) (*Credential, error) {
+	var part EncKDCRepPart
+	if err := Open(key, usage, enc, &part); err != nil {
+		return nil, err
+	}
+	if part.Nonce != nonce {
+		return nil, NewError(ErrModified, "reply nonce does not match request")
+	}
+	if part.SName != tkt.SName {
+		return nil, NewError(ErrModified, "reply service does not match ticket")
+	}
+	return &Credential{
+		Client:     cname,
+		Server:     part.SName,
+		Ticket:     tkt,
+		SessionKey: part.SessionKey,
+		AuthTime:   part.AuthTime,
+		EndTime:    part.EndTime,
+	}, nil
+}
+
+// Valid reports whether the credential can still be used at t.
+func (c *Credential) Valid(t time.Time) bool {
+	return c != nil && t.Before(c.EndTime)
+}
@@ -0,0 +1,117 @@
+package krb
+
+import (
+	"crypto/sha256"
+	"encoding/asn1"
+	"time"
+)
+
+// PAZK is the padata type of the zero-knowledge pre-authentication
+// mechanism. It is not IANA-registered. Like PKINIT, the same exchange also
+// agrees the AS reply key, by Diffie-Hellman, since a ZK client has no
+// long-term key the KDC knows.
+//
+// The exchange is:
+//
+//	C -> KDC  AS-REQ (no padata)
+//	KDC -> C  KRB-ERROR PREAUTH_REQUIRED, e-data METHOD-DATA { PA-ZK: PA-ZK-CHALLENGE }
+//	C -> KDC  AS-REQ, padata PA-ZK: PA-ZK-REQ
+//	KDC -> C  AS-REP, padata PA-ZK: PA-ZK-REP, enc-part under the DH reply key
+const PAZK = 1600
+
+// PAZKChallenge is sent by the KDC in the e-data of PREAUTH_REQUIRED:
+//
+//	PA-ZK-CHALLENGE ::= SEQUENCE {
+//	    circuit-id  [0] UTF8String,
+//	    challenge   [1] OCTET STRING,
+//	    expires     [2] GeneralizedTime,
+//	    salt        [3] OCTET STRING OPTIONAL  -- of the principal's commitment
+//	}
+type PAZKChallenge struct {
+	CircuitID string    `asn1:"utf8,explicit,tag:0"`
+	Challenge []byte    `asn1:"explicit,tag:1"`
+	Expires   time.Time `asn1:"generalized,explicit,tag:2"`
+	Salt      []byte    `asn1:"optional,explicit,tag:3"`
+}
+
+// PAZKReq is the client's answer to a challenge:
+//
+//	PA-ZK-REQ ::= SEQUENCE {
+//	    circuit-id  [0] UTF8String,
+//	    challenge   [1] OCTET STRING,   -- echoed from PA-ZK-CHALLENGE
+//	    dh-public   [2] OCTET STRING,
+//	    proof       [3] OCTET STRING,   -- gnark Groth16 proof encoding
+//	    group       [4] UTF8String OPTIONAL,   -- anonymous group login
+//	    nullifier   [5] OCTET STRING OPTIONAL  -- ditto
+//	}
+//
+// The proof's public challenge input is ZKBinding(challenge, dh-public), so
+// the proof can't be lifted onto another challenge or DH key.
+type PAZKReq struct {
+	CircuitID string `asn1:"utf8,explicit,tag:0"`
+	Challenge []byte `asn1:"explicit,tag:1"`
+	DHPublic  []byte `asn1:"explicit,tag:2"`
+	Proof     []byte `asn1:"explicit,tag:3"`
+	Group     string `asn1:"optional,utf8,explicit,tag:4"`
+	Nullifier []byte `asn1:"optional,explicit,tag:5"`
+}
+
+// PAZKRep carries the KDC's half of the DH exchange in the AS-REP:
+//
+//	PA-ZK-REP ::= SEQUENCE {
+//	    dh-public   [0] OCTET STRING
+//	}
+type PAZKRep struct {
+	DHPublic []byte `asn1:"explicit,tag:0"`
+}
+
+// ZKBinding returns the value a PA-ZK proof takes as its challenge input.
+// Callers reduce it into the circuit's scalar field.
+func ZKBinding(challenge, dhPublic []byte) []byte {
+	h := sha256.New()
+	h.Write(challenge)
+	h.Write(dhPublic)
+	return h.Sum(nil)
+}
+
+// NewPAZK encodes v (a PA-ZK-CHALLENGE, -REQ or -REP) as PA-ZK padata.
+func NewPAZK(v any) (PAData, error) {
+	b, err := asn1.Marshal(v)
+	if err != nil {
+		return PAData{}, err
+	}
+	return PAData{Type: PAZK, Value: b}, nil
+}
+
+// ParsePAZK decodes PA-ZK padata into v.
+func ParsePAZK(pa PAData, v any) error {
+	if rest, err := asn1.Unmarshal(pa.Value, v); err != nil || len(rest) > 0 {
+		return NewError(ErrPreauthFailed, "malformed PA-ZK")
+	}
+	return nil
+}
+
+// FindPAData returns the first padata of type t, if any.
+func FindPAData(pas []PAData, t int) (PAData, bool) {
+	for _, pa := range pas {
+		if pa.Type == t {
+			return pa, true
+		}
+	}
+	return PAData{}, false
+}
+
+// MarshalMethodData encodes pas as METHOD-DATA (SEQUENCE OF PA-DATA), the
+// e-data of PREAUTH_REQUIRED.
+func MarshalMethodData(pas []PAData) ([]byte, error) {
+	return asn1.Marshal(paData(pas))
+}
+
+// UnmarshalMethodData decodes the METHOD-DATA in a KRB-ERROR's e-data.
+func UnmarshalMethodData(b []byte) ([]PAData, error) {
+	var pas []derPAData
+	if _, err := asn1.Unmarshal(b, &pas); err != nil {
+		return nil, NewError(ErrGeneric, "malformed METHOD-DATA")
+	}
+	return fromPAData(pas), nil
+}
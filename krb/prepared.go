@@ -0,0 +1,58 @@
+package krb
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+)
+
+// PreparedZK is a PA-ZK answer made before the login it is for: a proof
+// over a long-lived challenge the KDC issued in advance, and the DH key it
+// is bound to. Until the challenge expires it logs its principal in once,
+// so keep it like a credential cache.
+type PreparedZK struct {
+	CircuitID string    `json:"circuit_id"`
+	Challenge []byte    `json:"challenge"`
+	Expires   time.Time `json:"expires"`
+	DHPrivate []byte    `json:"dh_private"`
+	DHPublic  []byte    `json:"dh_public"`
+	Proof     []byte    `json:"proof"`
+}
+
+// PrepareZK has prove answer ch now, for ASZKPrepared to send later.
+func PrepareZK(ch *PAZKChallenge, prove Prover) (*PreparedZK, error) {
+	priv, pub, err := NewDHKey()
+	if err != nil {
+		return nil, err
+	}
+	proof, err := prove(ch, ZKBinding(ch.Challenge, pub))
+	if err != nil {
+		return nil, fmt.Errorf("krb: proving: %w", err)
+	}
+	return &PreparedZK{
+		CircuitID: ch.CircuitID,
+		Challenge: ch.Challenge,
+		Expires:   ch.Expires,
+		DHPrivate: priv.Bytes(),
+		DHPublic:  pub,
+		Proof:     proof,
+	}, nil
+}
+
+// ASZKPrepared is ASZK answering with p instead of proving: it skips the
+// round trip for a challenge, sending p's answer in the first AS-REQ.
+func (k *KDCConn) ASZKPrepared(cname, sname string, p *PreparedZK) (*Credential, error) {
+	if time.Now().After(p.Expires) {
+		return nil, fmt.Errorf("krb: prepared proof expired at %s", p.Expires.Format(time.RFC3339))
+	}
+	nonce, err := NewNonce()
+	if err != nil {
+		return nil, err
+	}
+	pa, err := NewPAZK(PAZKReq{CircuitID: p.CircuitID, Challenge: p.Challenge, DHPublic: p.DHPublic, Proof: p.Proof})
+	if err != nil {
+		return nil, err
+	}
+	req := &ASReq{CName: cname, SName: sname, Nonce: nonce, PAData: []PAData{pa}}
+	return k.asZKReply(req, new(big.Int).SetBytes(p.DHPrivate))
+}
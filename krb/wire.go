@@ -0,0 +1,71 @@
+package krb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// MaxMessageSize bounds a single framed message.
+const MaxMessageSize = 1 << 20
+
+// MaxDatagram is the largest message that fits in one UDP datagram. Over
+// UDP a message is sent bare, without the length prefix (RFC 4120 section
+// 7.2.1).
+const MaxDatagram = 65507
+
+// WriteMessage writes m to w DER-encoded with a 4-byte big-endian length
+// prefix, as for Kerberos over TCP (RFC 4120 section 7.2.2). The prefix
+// keeps each message self-delimiting, so a connection can carry other
+// traffic once the exchange is over.
+func WriteMessage(w io.Writer, m *Message) error {
+	der, err := Marshal(m)
+	if err != nil {
+		return err
+	}
+	return WriteFrame(w, der)
+}
+
+// ReadMessage reads one message written by WriteMessage.
+func ReadMessage(r io.Reader) (*Message, error) {
+	body, err := ReadFrame(r)
+	if err != nil {
+		return nil, err
+	}
+	return Unmarshal(body)
+}
+
+// WriteFrame writes an already encoded message with its length prefix.
+func WriteFrame(w io.Writer, der []byte) error {
+	b := make([]byte, 4, 4+len(der))
+	binary.BigEndian.PutUint32(b, uint32(len(der)))
+	_, err := w.Write(append(b, der...))
+	return err
+}
+
+// ReadFrame reads one length-prefixed message without decoding it.
+func ReadFrame(r io.Reader) ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(r, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n > MaxMessageSize {
+		return nil, fmt.Errorf("krb: message of %d bytes exceeds limit", n)
+	}
+	body := make([]byte, n)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	return body, nil
+}
+
+// WriteError sends a KRBError built from err. Errors that are not already
+// KRBErrors are reported as KRB_ERR_GENERIC.
+func WriteError(w io.Writer, err error) error {
+	ke, ok := err.(*KRBError)
+	if !ok {
+		ke = NewError(ErrGeneric, err.Error())
+	}
+	return WriteMessage(w, &Message{KRBError: ke})
+}
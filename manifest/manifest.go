@@ -0,0 +1,145 @@
+// Package manifest describes the proving and verifying keys the KDC
+// publishes, signed so that a client can trust a key it got from a mirror
+// or cache as much as one it got from the KDC itself.
+package manifest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+var (
+	ErrSignature = errors.New("manifest: bad signature")
+	ErrExpired   = errors.New("manifest: outside its validity period")
+	ErrMismatch  = errors.New("manifest: key does not match manifest")
+)
+
+// Manifest pins down one key bundle. Hashes are hex SHA-256 of the
+// serialized constraint system and keys.
+type Manifest struct {
+	CircuitID   string    `json:"circuit_id"`
+	CircuitHash string    `json:"circuit_hash"`
+	PKHash      string    `json:"pk_hash"`
+	VKHash      string    `json:"vk_hash"`
+	Backend     string    `json:"backend"`
+	Curve       string    `json:"curve"`
+	NotBefore   time.Time `json:"not_before"`
+	NotAfter    time.Time `json:"not_after"`
+}
+
+// Signed is a manifest as published: the exact JSON bytes that were
+// signed, and the signature over them.
+type Signed struct {
+	Manifest  []byte `json:"manifest"`
+	Signature []byte `json:"signature"`
+}
+
+// Hash returns the hex SHA-256 of b, as used in a Manifest.
+func Hash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
+// Sign encodes and signs m.
+func Sign(key ed25519.PrivateKey, m *Manifest) (*Signed, error) {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return nil, err
+	}
+	return &Signed{Manifest: b, Signature: ed25519.Sign(key, b)}, nil
+}
+
+// Verify checks the signature with the pinned key and that the manifest
+// is valid at now, and returns it.
+func (s *Signed) Verify(key ed25519.PublicKey, now time.Time) (*Manifest, error) {
+	if !ed25519.Verify(key, s.Manifest, s.Signature) {
+		return nil, ErrSignature
+	}
+	var m Manifest
+	if err := json.Unmarshal(s.Manifest, &m); err != nil {
+		return nil, fmt.Errorf("manifest: %w", err)
+	}
+	if now.Before(m.NotBefore) || now.After(m.NotAfter) {
+		return nil, ErrExpired
+	}
+	return &m, nil
+}
+
+// CheckPK reports whether pk is the proving key the manifest names.
+func (m *Manifest) CheckPK(pk []byte) error {
+	if Hash(pk) != m.PKHash {
+		return fmt.Errorf("%w: proving key hash %s", ErrMismatch, Hash(pk))
+	}
+	return nil
+}
+
+// CheckVK reports whether vk is the verifying key the manifest names.
+func (m *Manifest) CheckVK(vk []byte) error {
+	if Hash(vk) != m.VKHash {
+		return fmt.Errorf("%w: verifying key hash %s", ErrMismatch, Hash(vk))
+	}
+	return nil
+}
+
+// CheckCircuit reports whether the serialized constraint system cs is the
+// one the manifest names.
+func (m *Manifest) CheckCircuit(cs []byte) error {
+	if Hash(cs) != m.CircuitHash {
+		return fmt.Errorf("%w: circuit hash %s", ErrMismatch, Hash(cs))
+	}
+	return nil
+}
+
+// LoadOrCreateKey reads the signing key in path, creating it (and its
+// public half in path+".pub") if it does not exist yet.
+func LoadOrCreateKey(path string) (ed25519.PrivateKey, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		seed, err := hex.DecodeString(strings.TrimSpace(string(b)))
+		if err != nil || len(seed) != ed25519.SeedSize {
+			return nil, fmt.Errorf("manifest: %s is not a signing key", path)
+		}
+		return ed25519.NewKeyFromSeed(seed), nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path, []byte(hex.EncodeToString(key.Seed())+"\n"), 0o600); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(path+".pub", []byte(hex.EncodeToString(pub)+"\n"), 0o644); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// ParsePublicKey decodes a hex public key, as written to the ".pub" file.
+func ParsePublicKey(s string) (ed25519.PublicKey, error) {
+	b, err := hex.DecodeString(strings.TrimSpace(s))
+	if err != nil || len(b) != ed25519.PublicKeySize {
+		return nil, errors.New("manifest: not a hex ed25519 public key")
+	}
+	return ed25519.PublicKey(b), nil
+}
+
+// LoadPublicKey reads a hex public key from path.
+func LoadPublicKey(path string) (ed25519.PublicKey, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParsePublicKey(string(b))
+}
@@ -0,0 +1,109 @@
+// Package merkle builds the fixed-depth MiMC Merkle trees that group
+// membership is proved against. Leaves and nodes are elements of the
+// deployment curve's scalar field, 32 bytes big-endian; a node is
+// MiMC(left, right) and unused leaves are zero.
+package merkle
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/consensys/gnark-crypto/ecc"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/curves"
+)
+
+var errNotElement = errors.New("merkle: node is not a field element")
+
+// Tree is a complete binary tree over up to 2^depth leaves.
+type Tree struct {
+	// levels[0] are the leaves, levels[depth] holds the root.
+	levels [][][]byte
+}
+
+// New builds a tree of the given depth over leaves, hashing over curve's
+// scalar field.
+func New(curve ecc.ID, depth int, leaves [][]byte) (*Tree, error) {
+	if depth < 1 || depth > 32 {
+		return nil, fmt.Errorf("merkle: bad depth %d", depth)
+	}
+	if len(leaves) > 1<<depth {
+		return nil, fmt.Errorf("merkle: %d leaves don't fit a tree of depth %d", len(leaves), depth)
+	}
+	level := make([][]byte, 1<<depth)
+	zero := make([]byte, curves.ElementSize)
+	for i := range level {
+		level[i] = zero
+		if i < len(leaves) {
+			if len(leaves[i]) != curves.ElementSize {
+				return nil, fmt.Errorf("merkle: leaf %d is %d bytes", i, len(leaves[i]))
+			}
+			level[i] = leaves[i]
+		}
+	}
+
+	t := &Tree{levels: [][][]byte{level}}
+	for len(level) > 1 {
+		next := make([][]byte, len(level)/2)
+		for i := range next {
+			h, err := Hash(curve, level[2*i], level[2*i+1])
+			if err != nil {
+				return nil, err
+			}
+			next[i] = h
+		}
+		t.levels = append(t.levels, next)
+		level = next
+	}
+	return t, nil
+}
+
+// Depth returns the number of levels below the root.
+func (t *Tree) Depth() int { return len(t.levels) - 1 }
+
+// Root returns the root of the tree.
+func (t *Tree) Root() []byte { return t.levels[len(t.levels)-1][0] }
+
+// Path returns the siblings of leaf i, from the leaves up.
+func (t *Tree) Path(i int) ([][]byte, error) {
+	if i < 0 || i >= len(t.levels[0]) {
+		return nil, fmt.Errorf("merkle: no leaf %d", i)
+	}
+	path := make([][]byte, t.Depth())
+	for d := range path {
+		path[d] = t.levels[d][i^1]
+		i >>= 1
+	}
+	return path, nil
+}
+
+// Verify reports whether path proves leaf is at index i under root.
+func Verify(curve ecc.ID, root, leaf []byte, i int, path [][]byte) (bool, error) {
+	node := leaf
+	for _, sib := range path {
+		var err error
+		if i&1 == 0 {
+			node, err = Hash(curve, node, sib)
+		} else {
+			node, err = Hash(curve, sib, node)
+		}
+		if err != nil {
+			return false, err
+		}
+		i >>= 1
+	}
+	return i == 0 && bytes.Equal(node, root), nil
+}
+
+// Hash returns the node over left and right.
+func Hash(curve ecc.ID, left, right []byte) ([]byte, error) {
+	h := curves.MiMC(curve)
+	if _, err := h.Write(left); err != nil {
+		return nil, errNotElement
+	}
+	if _, err := h.Write(right); err != nil {
+		return nil, errNotElement
+	}
+	return h.Sum(nil), nil
+}
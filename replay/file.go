@@ -0,0 +1,143 @@
+package replay
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// record is the on-disk form of an entry, one JSON object per line.
+type record struct {
+	Principal string `json:"p"`
+	UnixNano  int64  `json:"t"`
+	Nonce     string `json:"n"`
+}
+
+// FileCache is a Cache backed by an append-only log so that it survives
+// restarts. Expired entries are dropped whenever the log is compacted,
+// which happens on open and once the log grows well past the live set.
+type FileCache struct {
+	*MemoryCache
+	path    string
+	f       *os.File
+	written int
+}
+
+// OpenFileCache loads (or creates) the cache at path.
+func OpenFileCache(path string, window time.Duration) (*FileCache, error) {
+	c := &FileCache{MemoryCache: NewMemoryCache(window), path: path}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	if err := c.compact(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *FileCache) load() error {
+	f, err := os.Open(c.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("replay: open %s: %w", c.path, err)
+	}
+	defer f.Close()
+
+	now := c.now()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		var r record
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			// a torn final write after a crash; everything before it is good
+			continue
+		}
+		if c.live(r.UnixNano, now) {
+			c.seen[entry{r.Principal, r.Nonce}] = r.UnixNano
+		}
+	}
+	return sc.Err()
+}
+
+// compact rewrites the log with only the live entries and reopens it for append.
+func (c *FileCache) compact() error {
+	now := c.now()
+	tmp := c.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return fmt.Errorf("replay: compact: %w", err)
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for e, ts := range c.seen {
+		if !c.live(ts, now) {
+			delete(c.seen, e)
+			continue
+		}
+		if err := enc.Encode(record{e.principal, ts, e.nonce}); err != nil {
+			f.Close()
+			return fmt.Errorf("replay: compact: %w", err)
+		}
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return fmt.Errorf("replay: compact: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("replay: compact: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("replay: compact: %w", err)
+	}
+	if err := os.Rename(tmp, c.path); err != nil {
+		return fmt.Errorf("replay: compact: %w", err)
+	}
+
+	if c.f != nil {
+		c.f.Close()
+	}
+	c.f, err = os.OpenFile(c.path, os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return fmt.Errorf("replay: reopen %s: %w", c.path, err)
+	}
+	c.written = len(c.seen)
+	return nil
+}
+
+// Check implements Cache. A key is only reported as accepted once it has
+// been synced to disk.
+func (c *FileCache) Check(k Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ts := k.entry(), k.Timestamp.UnixNano()
+	if err := c.check(e, ts); err != nil {
+		return err
+	}
+	line, _ := json.Marshal(record{e.principal, ts, e.nonce})
+	if _, err := c.f.Write(append(line, '\n')); err != nil {
+		delete(c.seen, e)
+		return fmt.Errorf("replay: append: %w", err)
+	}
+	if err := c.f.Sync(); err != nil {
+		delete(c.seen, e)
+		return fmt.Errorf("replay: sync: %w", err)
+	}
+	c.written++
+	if c.written > 2*len(c.seen)+1024 {
+		return c.compact()
+	}
+	return nil
+}
+
+// Close implements Cache.
+func (c *FileCache) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.f.Close()
+}
@@ -0,0 +1,131 @@
+// Package replay implements replay caches for authenticators and proofs.
+//
+// A cache remembers every (principal, nonce) pair it has accepted until the
+// accompanying timestamp falls out of its window. Anything presented a second
+// time inside the window is rejected, and anything whose timestamp is already
+// outside the window is rejected outright because the cache could not vouch
+// for it after eviction.
+package replay
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// DefaultWindow matches the usual Kerberos clock skew allowance.
+const DefaultWindow = 5 * time.Minute
+
+var (
+	// ErrReplay is returned when a key has already been seen.
+	ErrReplay = errors.New("replay: request already seen")
+	// ErrExpired is returned when a key's timestamp falls outside the window.
+	ErrExpired = errors.New("replay: timestamp outside replay window")
+)
+
+// Key identifies a single authenticator or proof.
+type Key struct {
+	Principal string
+	// Timestamp is when the authenticator or proof was created (or, when it
+	// carries no time of its own, received). It bounds how long the key is kept.
+	Timestamp time.Time
+	// Nonce distinguishes requests from the same principal: an authenticator
+	// nonce, or a hash of the proof or authenticator ciphertext.
+	Nonce string
+}
+
+// Cache records keys and reports replays.
+type Cache interface {
+	// Check records k, returning ErrReplay if it was already recorded
+	// and ErrExpired if it is too old (or too far in the future) to track.
+	Check(k Key) error
+	Close() error
+}
+
+type entry struct {
+	principal string
+	nonce     string
+}
+
+func (k Key) entry() entry {
+	return entry{k.Principal, k.Nonce}
+}
+
+// MemoryCache is an in-memory Cache. It is safe for concurrent use.
+type MemoryCache struct {
+	window time.Duration
+	now    func() time.Time
+
+	mu        sync.Mutex
+	seen      map[entry]int64 // entry -> timestamp in unix nanoseconds
+	lastSweep time.Time
+}
+
+// NewMemoryCache returns an empty cache that remembers keys for window.
+func NewMemoryCache(window time.Duration) *MemoryCache {
+	if window <= 0 {
+		window = DefaultWindow
+	}
+	return &MemoryCache{
+		window: window,
+		now:    time.Now,
+		seen:   make(map[entry]int64),
+	}
+}
+
+// Check implements Cache.
+func (c *MemoryCache) Check(k Key) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.check(k.entry(), k.Timestamp.UnixNano())
+}
+
+func (c *MemoryCache) check(e entry, ts int64) error {
+	now := c.now()
+	if !c.live(ts, now) {
+		return ErrExpired
+	}
+	c.sweep(now)
+	if _, ok := c.seen[e]; ok {
+		return ErrReplay
+	}
+	c.seen[e] = ts
+	return nil
+}
+
+// live reports whether ts is within the window around now.
+func (c *MemoryCache) live(ts int64, now time.Time) bool {
+	t := time.Unix(0, ts)
+	return t.After(now.Add(-c.window)) && t.Before(now.Add(c.window))
+}
+
+// sweep drops expired entries, at most once per second.
+func (c *MemoryCache) sweep(now time.Time) {
+	if now.Sub(c.lastSweep) < time.Second {
+		return
+	}
+	c.lastSweep = now
+	for e, ts := range c.seen {
+		if !c.live(ts, now) {
+			delete(c.seen, e)
+		}
+	}
+}
+
+// Len returns the number of keys currently remembered.
+func (c *MemoryCache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.seen)
+}
+
+// Close implements Cache.
+func (c *MemoryCache) Close() error { return nil }
+
+// Open returns a FileCache at path, or a MemoryCache when path is empty.
+func Open(path string, window time.Duration) (Cache, error) {
+	if path == "" {
+		return NewMemoryCache(window), nil
+	}
+	return OpenFileCache(path, window)
+}
@@ -0,0 +1,120 @@
+package replay
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestReplay(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		path string
+	}{
+		{"memory", ""},
+		{"file", filepath.Join(t.TempDir(), "replay")},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := Open(tt.path, DefaultWindow)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer c.Close()
+
+			k := Key{Principal: "alice", Timestamp: time.Now(), Nonce: "1"}
+			if err := c.Check(k); err != nil {
+				t.Fatalf("first use: %v", err)
+			}
+			if err := c.Check(k); !errors.Is(err, ErrReplay) {
+				t.Errorf("replay: got %v, want %v", err, ErrReplay)
+			}
+			// the same nonce from someone else, or a new nonce, is not a replay
+			for _, k := range []Key{
+				{Principal: "bob", Timestamp: time.Now(), Nonce: "1"},
+				{Principal: "alice", Timestamp: time.Now(), Nonce: "2"},
+			} {
+				if err := c.Check(k); err != nil {
+					t.Errorf("%+v: %v", k, err)
+				}
+			}
+		})
+	}
+}
+
+func TestExpired(t *testing.T) {
+	c := NewMemoryCache(time.Minute)
+	for _, ts := range []time.Time{
+		time.Now().Add(-2 * time.Minute),
+		time.Now().Add(2 * time.Minute),
+	} {
+		if err := c.Check(Key{Principal: "alice", Timestamp: ts, Nonce: "1"}); !errors.Is(err, ErrExpired) {
+			t.Errorf("timestamp %s: got %v, want %v", ts, err, ErrExpired)
+		}
+	}
+	if n := c.Len(); n != 0 {
+		t.Errorf("remembered %d expired keys", n)
+	}
+}
+
+func TestMemoryCacheForgetsOutsideWindow(t *testing.T) {
+	c := NewMemoryCache(time.Minute)
+	now := time.Now()
+	c.now = func() time.Time { return now }
+	k := Key{Principal: "alice", Timestamp: now, Nonce: "1"}
+	if err := c.Check(k); err != nil {
+		t.Fatal(err)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if err := c.Check(Key{Principal: "bob", Timestamp: now, Nonce: "1"}); err != nil {
+		t.Fatal(err)
+	}
+	if n := c.Len(); n != 1 {
+		t.Errorf("%d keys remembered after the window, want 1", n)
+	}
+	if err := c.Check(k); !errors.Is(err, ErrExpired) {
+		t.Errorf("old key: got %v, want %v", err, ErrExpired)
+	}
+}
+
+func TestFileCachePersists(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "replay")
+	k := Key{Principal: "alice", Timestamp: time.Now(), Nonce: "1"}
+
+	c, err := OpenFileCache(path, DefaultWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Check(k); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// a crash mid-write leaves a torn last line, and entries from long ago
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, _ := json.Marshal(record{"bob", time.Now().Add(-time.Hour).UnixNano(), "1"})
+	if _, err := f.WriteString(string(line) + "\n" + `{"p":"carol","t":`); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	c, err = OpenFileCache(path, DefaultWindow)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if err := c.Check(k); !errors.Is(err, ErrReplay) {
+		t.Errorf("replay after reopen: got %v, want %v", err, ErrReplay)
+	}
+	if n := c.Len(); n != 1 {
+		t.Errorf("%d keys after reopen, want 1", n)
+	}
+}
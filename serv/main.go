@@ -1,101 +1,79 @@
 package main
 
 import (
-	"bytes"
-	"context"
-	crypto_rand "crypto/rand"
-	"crypto/sha256"
-	"encoding/base64"
-	"encoding/gob"
-	"encoding/json"
+	"bufio"
+	"flag"
 	"fmt"
 	"log"
-	"math/big"
-	math_rand "math/rand"
 	"net"
-	"net/http"
 	"os"
-	"time"
+	"slices"
+	"strings"
 
-	"github.com/consensys/gnark-crypto/ecc"
-	"github.com/consensys/gnark/backend/groth16"
-	"github.com/consensys/gnark/frontend"
-	"github.com/consensys/gnark/frontend/cs/r1cs"
+	"github.com/evanhong7384/ZK-Kerb/kdc/attrs"
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+	"github.com/evanhong7384/ZK-Kerb/kdc/session"
 )
 
-type Circuit struct {
-	X frontend.Variable `gnark:"x"`       // x  --> secret visibility (default)
-	Y frontend.Variable `gnark:",public"` // Y  --> public visibility
-}
+var (
+	listenAddr = flag.String("listen", ":8090", "address to accept clients on")
+	keytabPath = flag.String("keytab", "kdc.keytab", "keytab holding this service's key")
+	principal  = flag.String("principal", "serv", "service principal name")
+	rcachePath = flag.String("rcache", "", "replay cache file (in-memory if empty)")
+	modeFlag   = flag.String("mode", "priv", "session protection: priv or safe")
+	anonGroups = flag.String("anon-groups", "", "comma-separated groups whose members may connect anonymously")
+	requireAD  = flag.String("require", "", "claims clients must have proved at login, e.g. \"role=admin,clearance>=3\"")
+)
 
-func (c *Circuit) Define(api frontend.API) error {
-	//x^4+- 10246*x^3 + 36745188*x^2 - 53772937114*x + 26415943377211 == 0
-    x2 := api.Mul(c.X, c.X)      
-    x3 := api.Mul(x2, c.X)       
-    x4 := api.Mul(x3, c.X)       
-
-    neg10246, _    := new(big.Int).SetString("-10246", 10)
-    pos36745188, _ := new(big.Int).SetString("36745188", 10)
-    neg53772937114, _ := new(big.Int).SetString("-53772937114", 10)
-    pos26415943377211, _ := new(big.Int).SetString("26415943377211", 10)
-
-    t3 := api.Mul(x3, neg10246)           
-    t2 := api.Mul(x2, pos36745188)       
-    t1 := api.Mul(c.X, neg53772937114)    
-    c0 := pos26415943377211               
-
-    acc := api.Add(x4, t3)
-    acc = api.Add(acc, t2)
-    acc = api.Add(acc, t1)
-    acc = api.Add(acc, c0)
-
-    api.AssertIsEqual(acc, c.Y)
-    return nil
-}
+var keytab krb.Keytab
+var replayCache replay.Cache
+var sessionMode session.Mode
+var required []krb.Claim
 
-var verifyingKey groth16.VerifyingKey
-var provingKey groth16.ProvingKey
-var authenticated bool = false
-var expectedY int = 0 // global public y 
+func main() {
+	flag.Parse()
 
-// Same p and g (must match client)
-var (
-	pHex = "FFFFFFFFFFFFFFFFC90FDAA22168C234C4C6628B80DC1CD1" +
-		"29024E088A67CC74020BBEA63B139B22514A08798E3404DD" +
-		"EF9519B3CD3A431B302B0A6DF25F14374FE1356D6D51C245" +
-		"E485B576625E7EC6F44C42E9A637ED6B0BFF5CB6F406B7ED" +
-		"EE386BFB5A899FA5AE9F24117C4B1FE649286651ECE45B3D" +
-		"C2007CB8A163BF0598DA48361C55D39A69163FA8FD24CF5F" +
-		"83655D23DCA3AD961C62F356208552BB9ED529077096966D" +
-		"670C354E4ABC9804F1746C08CA237327FFFFFFFFFFFFFFFF"
-	g = big.NewInt(2)
-)
+	var err error
+	sessionMode, err = session.ParseMode(*modeFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
 
-const tgt_aes_key = "fe86ed5edd0cfbefc32f904747c30bb20de64010b6c62a97a70e2e021abdbee0"
+	if *requireAD != "" {
+		if required, err = attrs.ParseClaims(*requireAD); err != nil {
+			log.Fatalf("-require: %v", err)
+		}
+	}
 
-type Ticket struct {
-	session_key int
-	// username string
-	// address string
-	service_name string
-	// lifespan int
-	// timestamp int
-}
+	kt, err := krb.LoadKeytab(*keytabPath)
+	if err != nil {
+		log.Fatalf("keytab: %v", err)
+	}
+	entry, err := kt.Lookup(*principal)
+	if err != nil {
+		log.Fatalf("keytab: %v", err)
+	}
+	// only keep our own key
+	keytab = krb.Keytab{*principal: entry}
+
+	replayCache, err = replay.Open(*rcachePath, replay.DefaultWindow)
+	if err != nil {
+		log.Fatalf("replay cache: %v", err)
+	}
+	defer replayCache.Close()
 
-func main() {
-	ZKKDC()
 	startServer()
 }
 
 func startServer() {
-	// Server (listening on a port)
-	math_rand.Seed(time.Now().UnixNano())
-	listener, err := net.Listen("tcp", ":8080")
+	listener, err := net.Listen("tcp", *listenAddr)
 	if err != nil {
 		fmt.Println(err)
 		os.Exit(1)
 	}
 	defer listener.Close()
+	log.Printf("%s listening on %s", *principal, *listenAddr)
 
 	for {
 		conn, err := listener.Accept()
@@ -105,147 +83,91 @@ func startServer() {
 		}
 
 		go handleConnection(conn) // Handle each connection in a goroutine
-
 	}
 }
 
 func handleConnection(conn net.Conn) {
 	defer conn.Close()
 
-	// key exchange
-	var clientPub big.Int
-	decoder := gob.NewDecoder(conn)
-	err := decoder.Decode(&clientPub)
+	// AP exchange; replies with AP-REP so the client knows it's really us,
+	// but only once we know we'll serve it, and with a KRB-ERROR otherwise
+	ctx, err := krb.ServerHandshake(conn, keytab, replayCache, admit)
 	if err != nil {
-		fmt.Println("Error receiving client public key:", err)
+		fmt.Println("Rejected AP-REQ:", err)
 		return
 	}
+	who, _ := clientName(ctx)
+	fmt.Printf("Authenticated %s (ticket valid until %s)\n", who, ctx.Ticket.EndTime)
 
-	p, _ := new(big.Int).SetString(pHex, 16)
-	kdcPrivate, _ := crypto_rand.Int(crypto_rand.Reader, p)
-	kdcPublic := new(big.Int).Exp(g, kdcPrivate, p)
-
-	encoder := gob.NewEncoder(conn)
-	err = encoder.Encode(kdcPublic)
+	sc, err := session.Server(conn, ctx, sessionMode)
 	if err != nil {
-		fmt.Println("Error sending KDC public key:", err)
+		fmt.Println("Error starting session:", err)
 		return
 	}
-
-	sharedSecret := new(big.Int).Exp(&clientPub, kdcPrivate, p)
-	mock_password := sha256.Sum256(sharedSecret.Bytes())
-	fmt.Printf("Shared secret (session key) calculated: %x\n", mock_password)
-
-	return
-}
-
-func ZKKDC() {
-
-	proofOK := make(chan struct{})
-	mux := http.NewServeMux()
-
-	// ——— compile + trusted setup ———
-	var circuit Circuit
-	cs, err := frontend.Compile(
-		ecc.BN254.ScalarField(),
-		r1cs.NewBuilder,
-		&circuit,
-	)
-	if err != nil {
-		log.Fatalf("compile error: %v", err)
-	}
-	pk, vk, err := groth16.Setup(cs)
-	if err != nil {
-		log.Fatalf("setup error: %v", err)
-	}
-	provingKey = pk
-	verifyingKey = vk
-	log.Printf("🔑 Setup complete; server listening on :8081")
-
-	// 2) expose proving key
-	http.HandleFunc("/pk", func(w http.ResponseWriter, r *http.Request) {
-		var buf bytes.Buffer
-		if _, err := provingKey.WriteTo(&buf); err != nil {
-			http.Error(w, "failed to serialize PK", http.StatusInternalServerError)
-			return
-		}
-		pkB64 := base64.StdEncoding.EncodeToString(buf.Bytes())
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(map[string]string{"pk": pkB64})
-	})
-
-	// ——— expose verifying key ———
-	http.HandleFunc("/vk", func(w http.ResponseWriter, r *http.Request) {
-		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(verifyingKey)
-	})
-
-	// ——— proof‐verification endpoint ———
-	http.HandleFunc("/prove", func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			ProofB64 string `json:"proof"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "bad request", http.StatusBadRequest)
-			return
-		}
-
-		// 2) Base64 → []byte
-		proofBytes, err := base64.StdEncoding.DecodeString(req.ProofB64)
-		if err != nil {
-			http.Error(w, "invalid proof encoding", http.StatusBadRequest)
-			return
-		}
-
-		// 3) Allocate an empty Proof of the right curve type
-		proof := groth16.NewProof(ecc.BN254)
-
-		buf := bytes.NewBuffer(proofBytes)
-		if _, err := proof.ReadFrom(buf); err != nil {
-			http.Error(w, "invalid proof format", http.StatusBadRequest)
-			return
-		}
-		// build a public witness with just Y
-		assignment := Circuit{Y: expectedY}
-		pubWit, err := frontend.NewWitness(
-			&assignment,
-			ecc.BN254.ScalarField(),
-			frontend.PublicOnly(),
-		)
+	reader := bufio.NewReader(sc)
+	for {
+		message, err := reader.ReadString('\n')
 		if err != nil {
-			http.Error(w, "internal error", http.StatusInternalServerError)
+			fmt.Println("Error reading from session:", err)
 			return
 		}
-		// verify
-		if err := groth16.Verify(proof, verifyingKey, pubWit); err != nil {
-			http.Error(w, "forbidden", http.StatusForbidden)
+		fmt.Printf("Received from %s: %s", who, message)
+		if _, err := fmt.Fprintf(sc, "echo: %s", message); err != nil {
+			fmt.Println("Error writing to session:", err)
 			return
 		}
-		select {
-		case <-proofOK:
-		default:
-			close(proofOK)
-		}
-		w.WriteHeader(http.StatusOK)
-		fmt.Fprintf(w, "OK")
-
-	})
-
-	srv := &http.Server{
-		Addr:    ":8081",
-		Handler: mux,
 	}
+}
 
-	go func() {
-		log.Fatal(http.ListenAndServe(":8081", nil))
-	}()
-	<-proofOK
+// admit decides whether to serve the client of ctx: anonymous clients
+// must be members of one of -anon-groups, and every client must have
+// proved the -require claims.
+func admit(ctx *krb.Context) error {
+	who, err := clientName(ctx)
+	if err != nil {
+		return err
+	}
+	if err := checkClaims(ctx); err != nil {
+		return fmt.Errorf("%s: %w", who, err)
+	}
+	return nil
+}
 
-	// 6) gracefully shut down the HTTP server
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancel()
-	if err := srv.Shutdown(ctx); err != nil {
-		log.Fatalf("HTTP shutdown error: %v", err)
+// clientName describes the client of ctx. Anonymous clients are only
+// admitted as members of one of -anon-groups, and are known by the group
+// and the nullifier of their login.
+func clientName(ctx *krb.Context) (string, error) {
+	if ctx.Client != krb.Anonymous {
+		return ctx.Client, nil
+	}
+	ad, ok := krb.FindAuthData(ctx.Ticket.AuthorizationData, krb.ADZKGroup)
+	if !ok {
+		return "", fmt.Errorf("anonymous ticket carries no group")
 	}
+	var g krb.ZKGroupAuth
+	if err := krb.ParseAuthData(ad, &g); err != nil {
+		return "", err
+	}
+	if *anonGroups == "" || !slices.Contains(strings.Split(*anonGroups, ","), g.Group) {
+		return "", fmt.Errorf("anonymous members of %s are not admitted", g.Group)
+	}
+	return fmt.Sprintf("anonymous member of %s (session %x)", g.Group, g.Nullifier[:min(8, len(g.Nullifier))]), nil
+}
 
+// checkClaims checks that the client of ctx proved every -require claim
+// when it logged in.
+func checkClaims(ctx *krb.Context) error {
+	var proved krb.ZKClaims
+	if ad, ok := krb.FindAuthData(ctx.Ticket.AuthorizationData, krb.ADZKClaims); ok {
+		if err := krb.ParseAuthData(ad, &proved); err != nil {
+			return err
+		}
+		fmt.Printf("Client proved %v\n", proved.Claims)
+	}
+	for _, want := range required {
+		if !attrs.Satisfies(proved.Claims, want) {
+			return fmt.Errorf("claim %s not proved", want)
+		}
+	}
+	return nil
 }
@@ -0,0 +1,272 @@
+// Command peer is one node of the servers-comm-test demo. Every peer is a
+// Kerberos service: it gets tickets for the others from the KDC, mutually
+// authenticates on connect, and exchanges lines over a protected session.
+//
+// Run one per principal, e.g.
+//
+//	peer -name server1
+//	peer -name server2 -to server1
+//
+// then type "server2: hello" (or just "hello" to send to -to).
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+	"github.com/evanhong7384/ZK-Kerb/kdc/session"
+)
+
+var (
+	name         = flag.String("name", "", "this peer's principal name (required)")
+	listenAddr   = flag.String("listen", "", "address to listen on (default: our registry entry)")
+	defaultPeer  = flag.String("to", "", "peer to send to when a line has no \"name:\" prefix")
+	registryPath = flag.String("registry", "peers.conf", "service registry file")
+	kdcAddr      = flag.String("kdc", ":8080", "KDC address")
+	keytabPath   = flag.String("keytab", "kdc.keytab", "keytab holding this peer's key")
+	modeFlag     = flag.String("mode", "priv", "session protection: priv or safe")
+)
+
+// Peer is one node: a Kerberos service that also holds tickets for the
+// other peers in its registry.
+type Peer struct {
+	Name     string
+	KDC      string // KDC address
+	Registry Registry
+	Keytab   krb.Keytab // holds at least Name's key
+	Mode     session.Mode
+	// Received is called with each line another peer sends us.
+	Received func(from, msg string)
+
+	replayCache replay.Cache
+
+	// creds caches our tickets for other peers, refreshed when they expire.
+	credMu sync.Mutex
+	tgt    *krb.Credential
+	creds  map[string]*krb.Credential
+}
+
+// NewPeer returns the peer called name, which logs in to the KDC at
+// kdcAddr with its key from kt.
+func NewPeer(name, kdcAddr string, registry Registry, kt krb.Keytab, mode session.Mode) (*Peer, error) {
+	entry, err := kt.Lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	return &Peer{
+		Name:        name,
+		KDC:         kdcAddr,
+		Registry:    registry,
+		Keytab:      krb.Keytab{name: entry},
+		Mode:        mode,
+		Received:    func(from, msg string) {},
+		replayCache: replay.NewMemoryCache(replay.DefaultWindow),
+		creds:       map[string]*krb.Credential{},
+	}, nil
+}
+
+func main() {
+	flag.Parse()
+	if *name == "" {
+		log.Fatal("-name is required")
+	}
+
+	registry, err := LoadRegistry(*registryPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *listenAddr == "" {
+		if *listenAddr, err = registry.Lookup(*name); err != nil {
+			log.Fatalf("no -listen given and %v", err)
+		}
+	}
+	mode, err := session.ParseMode(*modeFlag)
+	if err != nil {
+		log.Fatal(err)
+	}
+	kt, err := krb.LoadKeytab(*keytabPath)
+	if err != nil {
+		log.Fatalf("keytab: %v", err)
+	}
+	p, err := NewPeer(*name, *kdcAddr, registry, kt, mode)
+	if err != nil {
+		log.Fatalf("keytab: %v", err)
+	}
+	p.Received = func(from, msg string) {
+		fmt.Printf("\n -------\n")
+		fmt.Printf("Received from %s: %s", from, msg) // print message received
+		fmt.Printf(" -------\n")
+		prompt()
+	}
+
+	listener, err := net.Listen("tcp", *listenAddr)
+	if err != nil {
+		log.Fatalf("listen on %s: %v", *listenAddr, err)
+	}
+	go p.Serve(listener)
+
+	// Request user input for message to send
+	reader := bufio.NewReader(os.Stdin)
+	for {
+		prompt()
+		line, err := reader.ReadString('\n') // Read the entire line, including spaces
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Fatalf("reading input: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+
+		to, msg := *defaultPeer, line
+		if i := strings.Index(line, ":"); i > 0 {
+			if _, ok := registry[line[:i]]; ok {
+				to, msg = line[:i], strings.TrimSpace(line[i+1:])
+			}
+		}
+		if to == "" {
+			fmt.Println("No peer given; prefix the message with one of:", strings.Join(registry.Names(), ", "))
+			continue
+		}
+
+		go func() {
+			if err := p.Send(to, msg); err != nil {
+				fmt.Printf("\nError sending to %s: %v\n", to, err)
+				prompt()
+			}
+		}()
+	}
+}
+
+func prompt() {
+	if *defaultPeer != "" {
+		fmt.Printf("Send message to %s: ", *defaultPeer)
+	} else {
+		fmt.Printf("Send message (peer: text): ")
+	}
+}
+
+// getCred returns a valid ticket for peer, logging in to the KDC with our
+// keytab when our TGT is missing or stale.
+func (p *Peer) getCred(peer string) (*krb.Credential, error) {
+	p.credMu.Lock()
+	defer p.credMu.Unlock()
+
+	soon := time.Now().Add(time.Minute)
+	if c := p.creds[peer]; c.Valid(soon) {
+		return c, nil
+	}
+
+	kdc, err := krb.DialKDC(p.KDC)
+	if err != nil {
+		return nil, err
+	}
+	defer kdc.Close()
+	if !p.tgt.Valid(soon) {
+		if p.tgt, err = kdc.AS(p.Name, krb.TGS, p.Keytab[p.Name]); err != nil {
+			return nil, fmt.Errorf("getting TGT: %w", err)
+		}
+	}
+	c, err := kdc.TGS(p.tgt, peer)
+	if err != nil {
+		return nil, fmt.Errorf("getting ticket for %s: %w", peer, err)
+	}
+	p.creds[peer] = c
+	return c, nil
+}
+
+// Serve accepts connections from other peers on listener until it is
+// closed.
+func (p *Peer) Serve(listener net.Listener) {
+	defer listener.Close()
+	log.Printf("%s listening on %s", p.Name, listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			log.Printf("accept: %v", err)
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		go p.handleConnection(conn) // Handle each connection in a goroutine
+	}
+}
+
+func (p *Peer) handleConnection(conn net.Conn) {
+	defer conn.Close()
+
+	ctx, err := krb.ServerHandshake(conn, p.Keytab, p.replayCache, func(ctx *krb.Context) error {
+		if _, ok := p.Registry[ctx.Client]; !ok {
+			return fmt.Errorf("unregistered principal %s", ctx.Client)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("rejected connection from %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	sc, err := session.Server(conn, ctx, p.Mode)
+	if err != nil {
+		log.Printf("session with %s: %v", ctx.Client, err)
+		return
+	}
+
+	reader := bufio.NewReader(sc)
+	for {
+		message, err := reader.ReadString('\n') // Read until newline
+		if err == io.EOF {
+			return
+		}
+		if err != nil {
+			log.Printf("reading from %s: %v", ctx.Client, err)
+			return
+		}
+		p.Received(ctx.Client, message)
+	}
+}
+
+// Send delivers one line to the named peer.
+func (p *Peer) Send(peer, msg string) error {
+	addr, err := p.Registry.Lookup(peer)
+	if err != nil {
+		return err
+	}
+	cred, err := p.getCred(peer)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	ctx, err := krb.ClientHandshake(conn, cred)
+	if err != nil {
+		return fmt.Errorf("authenticating %s: %w", peer, err)
+	}
+	sc, err := session.Client(conn, ctx, p.Mode)
+	if err != nil {
+		return err
+	}
+	_, err = sc.Write([]byte(msg + "\n"))
+	return err
+}
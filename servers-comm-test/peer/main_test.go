@@ -0,0 +1,238 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+	"github.com/evanhong7384/ZK-Kerb/kdc/replay"
+	"github.com/evanhong7384/ZK-Kerb/kdc/session"
+)
+
+// startKDC serves the AS and TGS exchanges peers use, for the principals
+// in kt, on a loopback port. Like the real KDC it wants PA-ENC-TIMESTAMP
+// from services and answers over TCP, one framed message at a time; it
+// has none of its user logins, limits or lookaside cache.
+func startKDC(t *testing.T, kt krb.Keytab) string {
+	t.Helper()
+	if _, err := kt.Ensure(krb.TGS); err != nil {
+		t.Fatal(err)
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+	rc := replay.NewMemoryCache(replay.DefaultWindow)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				for {
+					m, err := krb.ReadMessage(conn)
+					if err != nil {
+						return
+					}
+					reply, err := kdcReply(m, kt, rc)
+					if err != nil {
+						krb.WriteError(conn, err)
+						continue
+					}
+					krb.WriteMessage(conn, reply)
+				}
+			}()
+		}
+	}()
+	return l.Addr().String()
+}
+
+// kdcReply answers an AS-REQ or TGS-REQ.
+func kdcReply(m *krb.Message, kt krb.Keytab, rc replay.Cache) (*krb.Message, error) {
+	switch {
+	case m.ASReq != nil:
+		req := m.ASReq
+		key, err := kt.Lookup(req.CName)
+		if err != nil {
+			return nil, krb.NewError(krb.ErrCPrincipalUnknown, req.CName)
+		}
+		pa, ok := krb.FindPAData(req.PAData, krb.PAEncTimestamp)
+		if !ok {
+			return nil, krb.NewError(krb.ErrPreauthRequired, "PA-ENC-TIMESTAMP required")
+		}
+		if _, err := krb.VerifyPAEncTimestamp(pa, key); err != nil {
+			return nil, err
+		}
+		tkt, enc, err := issue(kt, req.CName, req.SName, req.Nonce, key.Key, krb.UsageASRepEncPart)
+		if err != nil {
+			return nil, err
+		}
+		return &krb.Message{ASRep: &krb.ASRep{CName: req.CName, Ticket: tkt, EncPart: enc}}, nil
+	case m.TGSReq != nil:
+		req := m.TGSReq
+		tgt, err := krb.VerifyTGSReq(req, kt, rc)
+		if err != nil {
+			return nil, err
+		}
+		tkt, enc, err := issue(kt, tgt.Client, req.SName, req.Nonce, tgt.SessionKey, krb.UsageTGSRepEncPart)
+		if err != nil {
+			return nil, err
+		}
+		return &krb.Message{TGSRep: &krb.TGSRep{CName: tgt.Client, Ticket: tkt, EncPart: enc}}, nil
+	}
+	return nil, krb.NewError(krb.ErrGeneric, "expected AS-REQ or TGS-REQ")
+}
+
+// issue makes a ticket for cname to sname, and the reply part telling
+// cname its session key, sealed under replyKey.
+func issue(kt krb.Keytab, cname, sname string, nonce uint32, replyKey []byte, usage int) (krb.Ticket, krb.EncryptedData, error) {
+	svc, err := kt.Lookup(sname)
+	if err != nil {
+		return krb.Ticket{}, krb.EncryptedData{}, err
+	}
+	sessionKey, err := krb.NewKey()
+	if err != nil {
+		return krb.Ticket{}, krb.EncryptedData{}, err
+	}
+	now := time.Now().UTC()
+	end := now.Add(time.Hour)
+	tkt, err := krb.Seal(svc.Key, svc.KVNO, krb.UsageASRepTicket, krb.EncTicketPart{
+		SessionKey: sessionKey,
+		CName:      cname,
+		AuthTime:   now,
+		EndTime:    end,
+	})
+	if err != nil {
+		return krb.Ticket{}, krb.EncryptedData{}, err
+	}
+	enc, err := krb.Seal(replyKey, 0, usage, krb.EncKDCRepPart{
+		SessionKey: sessionKey,
+		Nonce:      nonce,
+		SName:      sname,
+		AuthTime:   now,
+		EndTime:    end,
+	})
+	return krb.Ticket{SName: sname, EncPart: tkt}, enc, err
+}
+
+// message is a line one peer got from another.
+type message struct{ from, text string }
+
+// startPeers starts a peer for each name, all registered with each other
+// and known to a KDC at kdcAddr, and returns them with the lines they get.
+func startPeers(t *testing.T, kdcAddr string, kt krb.Keytab, mode session.Mode, names ...string) (map[string]*Peer, chan message) {
+	t.Helper()
+	registry := Registry{}
+	listeners := map[string]net.Listener{}
+	for _, name := range names {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { l.Close() })
+		registry[name], listeners[name] = l.Addr().String(), l
+	}
+	received := make(chan message, 10)
+	peers := map[string]*Peer{}
+	for _, name := range names {
+		p, err := NewPeer(name, kdcAddr, registry, kt, mode)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.Received = func(from, msg string) { received <- message{from, msg} }
+		peers[name] = p
+		go p.Serve(listeners[name])
+	}
+	return peers, received
+}
+
+// next waits for the next line a peer gets.
+func next(t *testing.T, received chan message) message {
+	t.Helper()
+	select {
+	case m := <-received:
+		return m
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message delivered")
+		return message{}
+	}
+}
+
+func TestPeersExchangeMessages(t *testing.T) {
+	for _, mode := range []session.Mode{session.Priv, session.Safe} {
+		t.Run(mode.String(), func(t *testing.T) {
+			kt := krb.Keytab{}
+			if _, err := kt.Ensure("server1", "server2"); err != nil {
+				t.Fatal(err)
+			}
+			peers, received := startPeers(t, startKDC(t, kt), kt, mode, "server1", "server2")
+
+			// server2 logs in, gets a ticket for server1 and authenticates to it
+			if err := peers["server2"].Send("server1", "hello"); err != nil {
+				t.Fatal(err)
+			}
+			if m := next(t, received); m != (message{"server2", "hello\n"}) {
+				t.Errorf("server1 got %+v", m)
+			}
+			if peers["server2"].tgt == nil || peers["server2"].creds["server1"] == nil {
+				t.Error("server2 kept no tickets")
+			}
+
+			// and back, over a new AP exchange with a ticket of server1's
+			if err := peers["server1"].Send("server2", "hi"); err != nil {
+				t.Fatal(err)
+			}
+			if m := next(t, received); m != (message{"server1", "hi\n"}) {
+				t.Errorf("server2 got %+v", m)
+			}
+
+			// a second message reuses the ticket, with a fresh authenticator
+			cred := peers["server2"].creds["server1"]
+			if err := peers["server2"].Send("server1", "again"); err != nil {
+				t.Fatal(err)
+			}
+			if m := next(t, received); m.text != "again\n" {
+				t.Errorf("server1 got %+v", m)
+			}
+			if peers["server2"].creds["server1"] != cred {
+				t.Error("ticket fetched again while still valid")
+			}
+		})
+	}
+}
+
+func TestPeerRefusesUnregistered(t *testing.T) {
+	kt := krb.Keytab{}
+	if _, err := kt.Ensure("server1", "server2", "intruder"); err != nil {
+		t.Fatal(err)
+	}
+	kdcAddr := startKDC(t, kt)
+	peers, received := startPeers(t, kdcAddr, kt, session.Priv, "server1", "server2")
+
+	// the KDC knows the intruder, but server1's registry doesn't
+	intruder, err := NewPeer("intruder", kdcAddr, peers["server1"].Registry, kt, session.Priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = intruder.Send("server1", "let me in")
+	var ke *krb.KRBError
+	if !errors.As(err, &ke) || ke.Code != krb.ErrPolicy {
+		t.Errorf("got %v, want krb error %d", err, krb.ErrPolicy)
+	}
+	select {
+	case m := <-received:
+		t.Errorf("delivered %+v", m)
+	default:
+	}
+
+	// nor is anything sent to a peer missing from the registry
+	if err := peers["server1"].Send("nobody", "hi"); err == nil || !strings.Contains(err.Error(), "unknown peer") {
+		t.Errorf("sending to an unregistered peer: %v", err)
+	}
+}
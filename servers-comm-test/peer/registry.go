@@ -0,0 +1,69 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Registry maps peer principal names to the addresses they listen on.
+//
+// The file has one peer per line, "name address", for example
+//
+//	# name     address
+//	server1    localhost:9081
+//	server2    localhost:9082
+//
+// Blank lines and lines starting with '#' are ignored.
+type Registry map[string]string
+
+// LoadRegistry reads a registry file.
+func LoadRegistry(path string) (Registry, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("registry: %w", err)
+	}
+	defer f.Close()
+
+	reg := Registry{}
+	sc := bufio.NewScanner(f)
+	for lineno := 1; sc.Scan(); lineno++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("registry: %s:%d: want \"name address\", got %q", path, lineno, line)
+		}
+		if _, dup := reg[fields[0]]; dup {
+			return nil, fmt.Errorf("registry: %s:%d: duplicate peer %q", path, lineno, fields[0])
+		}
+		reg[fields[0]] = fields[1]
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("registry: %w", err)
+	}
+	return reg, nil
+}
+
+// Lookup returns the address of the named peer.
+func (r Registry) Lookup(name string) (string, error) {
+	addr, ok := r[name]
+	if !ok {
+		return "", fmt.Errorf("unknown peer %q (known: %s)", name, strings.Join(r.Names(), ", "))
+	}
+	return addr, nil
+}
+
+// Names returns the registered peer names in order.
+func (r Registry) Names() []string {
+	names := make([]string, 0, len(r))
+	for n := range r {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
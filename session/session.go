@@ -0,0 +1,254 @@
+// Package session protects application traffic once a client and service
+// share a Kerberos session key. It plays the role of KRB-PRIV and KRB-SAFE:
+// every record carries a sequence number and is either encrypted and
+// authenticated (Priv) or only authenticated (Safe).
+//
+// A *Conn wraps a net.Conn and is itself a net.Conn, so handlers that read
+// and write a plain connection work unchanged on top of it.
+package session
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hkdf"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// Mode selects how records are protected.
+type Mode int
+
+const (
+	// Priv encrypts and authenticates every record (AES-256-GCM).
+	Priv Mode = iota
+	// Safe authenticates every record but sends it in the clear (HMAC-SHA256).
+	Safe
+)
+
+func (m Mode) String() string {
+	switch m {
+	case Priv:
+		return "priv"
+	case Safe:
+		return "safe"
+	}
+	return fmt.Sprintf("Mode(%d)", int(m))
+}
+
+// ParseMode parses "priv" or "safe".
+func ParseMode(s string) (Mode, error) {
+	switch s {
+	case "priv":
+		return Priv, nil
+	case "safe":
+		return Safe, nil
+	}
+	return 0, fmt.Errorf("session: unknown mode %q", s)
+}
+
+// MaxRecord is the largest plaintext carried in one record.
+const MaxRecord = 16 << 10
+
+var (
+	// ErrIntegrity is returned when a record fails authentication.
+	ErrIntegrity = errors.New("session: record failed integrity check")
+	// ErrSequence is returned when a record arrives out of order, twice, or not at all.
+	ErrSequence = errors.New("session: unexpected sequence number")
+)
+
+// direction protects traffic flowing one way.
+type direction struct {
+	seq  uint64
+	aead cipher.AEAD // Priv
+	mac  []byte      // Safe
+}
+
+// Conn is a net.Conn whose traffic is protected with a session key.
+type Conn struct {
+	net.Conn
+	mode Mode
+
+	rmu  sync.Mutex
+	in   direction
+	rbuf []byte
+	rerr error
+
+	wmu sync.Mutex
+	out direction
+}
+
+// Client wraps conn on the client side of an AP exchange.
+func Client(conn net.Conn, ctx *krb.Context, mode Mode) (*Conn, error) {
+	return newConn(conn, ctx, mode, "client->server", "server->client")
+}
+
+// Server wraps conn on the service side of an AP exchange.
+func Server(conn net.Conn, ctx *krb.Context, mode Mode) (*Conn, error) {
+	return newConn(conn, ctx, mode, "server->client", "client->server")
+}
+
+func newConn(conn net.Conn, ctx *krb.Context, mode Mode, outLabel, inLabel string) (*Conn, error) {
+	// keys come from the AP exchange's subkey, not the ticket's session
+	// key: every connection made with one ticket would share those, and
+	// overlapping sequence numbers would then reuse GCM nonces
+	if len(ctx.Subkey) != krb.KeySize {
+		return nil, errors.New("session: AP exchange negotiated no subkey")
+	}
+	c := &Conn{Conn: conn, mode: mode}
+	// both directions start at the sequence number from the authenticator
+	seq := uint64(ctx.Authenticator.SeqNumber)
+	var err error
+	if c.out, err = newDirection(ctx.Subkey, mode, outLabel, seq); err != nil {
+		return nil, err
+	}
+	if c.in, err = newDirection(ctx.Subkey, mode, inLabel, seq); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// newDirection derives a per-direction, per-mode key so that records can't
+// be reflected back at their sender or replayed across modes.
+func newDirection(subkey []byte, mode Mode, label string, seq uint64) (direction, error) {
+	key, err := hkdf.Key(sha256.New, subkey, nil, "zk-kerb session "+mode.String()+" "+label, krb.KeySize)
+	if err != nil {
+		return direction{}, fmt.Errorf("session: deriving key: %w", err)
+	}
+	d := direction{seq: seq}
+	switch mode {
+	case Priv:
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return direction{}, err
+		}
+		if d.aead, err = cipher.NewGCM(block); err != nil {
+			return direction{}, err
+		}
+	case Safe:
+		d.mac = key
+	default:
+		return direction{}, fmt.Errorf("session: unknown mode %v", mode)
+	}
+	return d, nil
+}
+
+// seal protects one record. The sequence number is authenticated in both
+// modes and, for Priv, doubles as the GCM nonce.
+func (d *direction) seal(p []byte) []byte {
+	var seq [8]byte
+	binary.BigEndian.PutUint64(seq[:], d.seq)
+	d.seq++
+	if d.aead != nil {
+		nonce := make([]byte, d.aead.NonceSize())
+		copy(nonce[len(nonce)-8:], seq[:])
+		return d.aead.Seal(seq[:], nonce, p, seq[:])
+	}
+	h := hmac.New(sha256.New, d.mac)
+	h.Write(seq[:])
+	h.Write(p)
+	rec := append(seq[:], p...)
+	return h.Sum(rec)
+}
+
+// open checks and strips one record.
+func (d *direction) open(rec []byte) ([]byte, error) {
+	if len(rec) < 8 {
+		return nil, ErrIntegrity
+	}
+	seq, body := rec[:8], rec[8:]
+	if binary.BigEndian.Uint64(seq) != d.seq {
+		return nil, ErrSequence
+	}
+	var p []byte
+	if d.aead != nil {
+		nonce := make([]byte, d.aead.NonceSize())
+		copy(nonce[len(nonce)-8:], seq)
+		var err error
+		if p, err = d.aead.Open(nil, nonce, body, seq); err != nil {
+			return nil, ErrIntegrity
+		}
+	} else {
+		if len(body) < sha256.Size {
+			return nil, ErrIntegrity
+		}
+		p, body = body[:len(body)-sha256.Size], body[len(body)-sha256.Size:]
+		h := hmac.New(sha256.New, d.mac)
+		h.Write(seq)
+		h.Write(p)
+		if !hmac.Equal(h.Sum(nil), body) {
+			return nil, ErrIntegrity
+		}
+	}
+	d.seq++
+	return p, nil
+}
+
+// Write protects p and sends it as one or more records.
+func (c *Conn) Write(p []byte) (int, error) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	n := 0
+	for len(p) > 0 {
+		chunk := p
+		if len(chunk) > MaxRecord {
+			chunk = chunk[:MaxRecord]
+		}
+		rec := c.out.seal(chunk)
+		frame := make([]byte, 4, 4+len(rec))
+		binary.BigEndian.PutUint32(frame, uint32(len(rec)))
+		if _, err := c.Conn.Write(append(frame, rec...)); err != nil {
+			return n, err
+		}
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+	return n, nil
+}
+
+// Read returns verified plaintext. Once a record fails verification every
+// later Read fails too: the stream can't be trusted past that point.
+func (c *Conn) Read(p []byte) (int, error) {
+	c.rmu.Lock()
+	defer c.rmu.Unlock()
+
+	for len(c.rbuf) == 0 {
+		if c.rerr != nil {
+			return 0, c.rerr
+		}
+		c.rbuf, c.rerr = c.readRecord()
+	}
+	n := copy(p, c.rbuf)
+	c.rbuf = c.rbuf[n:]
+	return n, nil
+}
+
+func (c *Conn) readRecord() ([]byte, error) {
+	var hdr [4]byte
+	if _, err := io.ReadFull(c.Conn, hdr[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:])
+	if n > MaxRecord+64 {
+		return nil, fmt.Errorf("session: record of %d bytes exceeds limit", n)
+	}
+	rec := make([]byte, n)
+	if _, err := io.ReadFull(c.Conn, rec); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	return c.in.open(rec)
+}
+
+// Mode reports how the connection's records are protected.
+func (c *Conn) Mode() Mode { return c.mode }
@@ -0,0 +1,254 @@
+package session
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/evanhong7384/ZK-Kerb/kdc/krb"
+)
+
+// newContext returns the context of an AP exchange that settled on a fresh
+// subkey, with the given initial sequence number.
+func newContext(t *testing.T, seq uint32) *krb.Context {
+	t.Helper()
+	subkey, err := krb.NewKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &krb.Context{Subkey: subkey, Authenticator: krb.Authenticator{SeqNumber: seq}}
+}
+
+// bufConn is a net.Conn that writes to and reads from a buffer, so tests
+// can look at, change and resend the records on the wire.
+type bufConn struct {
+	net.Conn
+	buf *bytes.Buffer
+}
+
+func (c bufConn) Read(p []byte) (int, error)  { return c.buf.Read(p) }
+func (c bufConn) Write(p []byte) (int, error) { return c.buf.Write(p) }
+
+// records splits framed records off the wire.
+func records(t *testing.T, wire []byte) [][]byte {
+	t.Helper()
+	var recs [][]byte
+	for len(wire) > 0 {
+		if len(wire) < 4 {
+			t.Fatalf("torn frame header: %x", wire)
+		}
+		n := binary.BigEndian.Uint32(wire)
+		recs = append(recs, bytes.Clone(wire[:4+n]))
+		wire = wire[4+n:]
+	}
+	return recs
+}
+
+// pair returns the two directions protecting traffic from client to
+// server in mode, as each side sees them.
+func pair(t *testing.T, mode Mode) (out, in direction) {
+	t.Helper()
+	ctx := newContext(t, 41)
+	c, err := Client(nil, ctx, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Server(nil, ctx, mode)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c.out, s.in
+}
+
+func TestSealOpen(t *testing.T) {
+	msg := []byte("attack at dawn")
+	for _, mode := range []Mode{Priv, Safe} {
+		t.Run(mode.String(), func(t *testing.T) {
+			out, in := pair(t, mode)
+			for i := range 3 {
+				rec := out.seal(msg)
+				if got := binary.BigEndian.Uint64(rec); got != 41+uint64(i) {
+					t.Errorf("record %d has sequence number %d", i, got)
+				}
+				if hidden := !bytes.Contains(rec, msg); hidden != (mode == Priv) {
+					t.Errorf("plaintext hidden: %v", hidden)
+				}
+				p, err := in.open(rec)
+				if err != nil {
+					t.Fatalf("record %d: %v", i, err)
+				}
+				if !bytes.Equal(p, msg) {
+					t.Errorf("record %d: got %q", i, p)
+				}
+			}
+		})
+	}
+}
+
+func TestOpenRejects(t *testing.T) {
+	for _, mode := range []Mode{Priv, Safe} {
+		t.Run(mode.String(), func(t *testing.T) {
+			for _, tt := range []struct {
+				name string
+				// tamper changes the second of three records, or returns
+				// what to send in place of it
+				tamper func(recs [][]byte) []byte
+				want   error
+			}{
+				{"replayed", func(recs [][]byte) []byte { return recs[0] }, ErrSequence},
+				{"out of order", func(recs [][]byte) []byte { return recs[2] }, ErrSequence},
+				{"renumbered", func(recs [][]byte) []byte {
+					rec := bytes.Clone(recs[2])
+					binary.BigEndian.PutUint64(rec, 42)
+					return rec
+				}, ErrIntegrity},
+				{"tampered body", func(recs [][]byte) []byte {
+					rec := bytes.Clone(recs[1])
+					rec[9] ^= 1
+					return rec
+				}, ErrIntegrity},
+				{"tampered tag", func(recs [][]byte) []byte {
+					rec := bytes.Clone(recs[1])
+					rec[len(rec)-1] ^= 1
+					return rec
+				}, ErrIntegrity},
+				{"truncated tag", func(recs [][]byte) []byte { return recs[1][:len(recs[1])-1] }, ErrIntegrity},
+				{"no sequence number", func(recs [][]byte) []byte { return recs[1][:7] }, ErrIntegrity},
+			} {
+				t.Run(tt.name, func(t *testing.T) {
+					out, in := pair(t, mode)
+					recs := [][]byte{out.seal([]byte("one")), out.seal([]byte("two")), out.seal([]byte("three"))}
+					if _, err := in.open(recs[0]); err != nil {
+						t.Fatal(err)
+					}
+					if _, err := in.open(tt.tamper(recs)); !errors.Is(err, tt.want) {
+						t.Errorf("got %v, want %v", err, tt.want)
+					}
+					// a record that failed doesn't advance the sequence
+					if p, err := in.open(recs[1]); err != nil || string(p) != "two" {
+						t.Errorf("the real record after: got %q, %v", p, err)
+					}
+				})
+			}
+		})
+	}
+}
+
+func TestOpenRejectsOtherKeys(t *testing.T) {
+	ctx := newContext(t, 0)
+	c, err := Client(nil, ctx, Priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := c.out.seal([]byte("hello"))
+	for _, tt := range []struct {
+		name string
+		in   func() (*Conn, error)
+	}{
+		// a record can't be bounced back at its sender
+		{"reflected", func() (*Conn, error) { return Client(nil, ctx, Priv) }},
+		{"another connection", func() (*Conn, error) { return Server(nil, newContext(t, 0), Priv) }},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			in, err := tt.in()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := in.in.open(rec); !errors.Is(err, ErrIntegrity) {
+				t.Errorf("got %v, want %v", err, ErrIntegrity)
+			}
+		})
+	}
+
+	// nor read in the other mode
+	s, err := Server(nil, ctx, Safe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c, err = Client(nil, ctx, Priv); err != nil {
+		t.Fatal(err)
+	}
+	rec = c.out.seal(bytes.Repeat([]byte{'x'}, 64))
+	if _, err := s.in.open(rec); !errors.Is(err, ErrIntegrity) {
+		t.Errorf("priv record read as safe: got %v, want %v", err, ErrIntegrity)
+	}
+}
+
+func TestConn(t *testing.T) {
+	for _, mode := range []Mode{Priv, Safe} {
+		t.Run(mode.String(), func(t *testing.T) {
+			ctx := newContext(t, 7)
+			a, b := net.Pipe()
+			defer a.Close()
+			defer b.Close()
+			c, err := Client(a, ctx, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+			s, err := Server(b, ctx, mode)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// a write longer than a record, then a short one
+			msg := bytes.Repeat([]byte("0123456789abcdef"), MaxRecord/8)
+			go func() {
+				c.Write(msg)
+				c.Write([]byte("bye"))
+			}()
+			got := make([]byte, len(msg)+3)
+			if _, err := io.ReadFull(s, got); err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, append(msg, "bye"...)) {
+				t.Error("server read something else")
+			}
+
+			go s.Write([]byte("ok"))
+			reply := make([]byte, 2)
+			if _, err := io.ReadFull(c, reply); err != nil || string(reply) != "ok" {
+				t.Errorf("client read %q, %v", reply, err)
+			}
+		})
+	}
+}
+
+func TestConnStopsAfterBadRecord(t *testing.T) {
+	ctx := newContext(t, 0)
+	wire := &bytes.Buffer{}
+	c, err := Client(bufConn{buf: wire}, ctx, Safe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Write([]byte("one"))
+	c.Write([]byte("two"))
+	recs := records(t, wire.Bytes())
+
+	// the first record twice, then the second
+	wire.Reset()
+	wire.Write(recs[0])
+	wire.Write(recs[0])
+	wire.Write(recs[1])
+	s, err := Server(bufConn{buf: wire}, ctx, Safe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := make([]byte, 16)
+	if n, err := s.Read(p); err != nil || string(p[:n]) != "one" {
+		t.Fatalf("got %q, %v", p[:n], err)
+	}
+	for range 2 {
+		if _, err := s.Read(p); !errors.Is(err, ErrSequence) {
+			t.Errorf("got %v, want %v", err, ErrSequence)
+		}
+	}
+}
+
+func TestNoSubkey(t *testing.T) {
+	if _, err := Client(nil, &krb.Context{SessionKey: make([]byte, krb.KeySize)}, Priv); err == nil {
+		t.Error("session keyed without an AP exchange subkey")
+	}
+}
@@ -0,0 +1,190 @@
+// Package tlsutil builds the TLS configuration for the KDC's HTTPS
+// endpoints and for the clients that fetch keys and proxy Kerberos
+// through them.
+package tlsutil
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"strings"
+	"time"
+)
+
+// ServerOptions configures the server side.
+type ServerOptions struct {
+	CertFile string
+	KeyFile  string
+	// ClientCAFile, if set, makes the server ask for client certificates
+	// and verify them against the CAs it holds.
+	ClientCAFile string
+	// RequireClientCert refuses clients without a valid certificate.
+	RequireClientCert bool
+}
+
+// ServerConfig loads the server certificate and, optionally, the CAs for
+// client certificates.
+func ServerConfig(o ServerOptions) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("tlsutil: loading server certificate: %w", err)
+	}
+	cfg := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+	switch {
+	case o.ClientCAFile != "":
+		if cfg.ClientCAs, err = loadPool(o.ClientCAFile); err != nil {
+			return nil, err
+		}
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if o.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	case o.RequireClientCert:
+		return nil, errors.New("tlsutil: requiring client certificates needs a client CA file")
+	}
+	return cfg, nil
+}
+
+// ClientOptions configures the client side. With neither CAFile nor Pin,
+// the server is verified against the system roots.
+type ClientOptions struct {
+	// CAFile holds the CAs (or the self-signed certificate) to trust.
+	CAFile string
+	// Pin is the hex SHA-256 fingerprint of the server's certificate. When
+	// set, that exact certificate is required and no CA is consulted.
+	Pin string
+	// CertFile and KeyFile are our client certificate, if any.
+	CertFile string
+	KeyFile  string
+}
+
+// ClientConfig builds a client TLS configuration from o.
+func ClientConfig(o ClientOptions) (*tls.Config, error) {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	var err error
+	if o.CAFile != "" {
+		if cfg.RootCAs, err = loadPool(o.CAFile); err != nil {
+			return nil, err
+		}
+	}
+	if o.Pin != "" {
+		pin, err := hex.DecodeString(strings.ReplaceAll(o.Pin, ":", ""))
+		if err != nil || len(pin) != sha256.Size {
+			return nil, fmt.Errorf("tlsutil: pin must be a hex SHA-256 fingerprint")
+		}
+		// the pin replaces chain verification, not adds to it
+		cfg.InsecureSkipVerify = true
+		cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			if len(rawCerts) == 0 {
+				return errors.New("tlsutil: server sent no certificate")
+			}
+			if got := sha256.Sum256(rawCerts[0]); !bytes.Equal(got[:], pin) {
+				return fmt.Errorf("tlsutil: server certificate %x does not match pin", got)
+			}
+			return nil
+		}
+	}
+	if o.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(o.CertFile, o.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("tlsutil: loading client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+	return cfg, nil
+}
+
+// Fingerprint returns the hex SHA-256 fingerprint of the first certificate
+// in a PEM file, the value ClientOptions.Pin expects.
+func Fingerprint(certFile string) (string, error) {
+	b, err := os.ReadFile(certFile)
+	if err != nil {
+		return "", err
+	}
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return "", fmt.Errorf("tlsutil: no certificate in %s", certFile)
+	}
+	sum := sha256.Sum256(block.Bytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// EnsureSelfSigned writes a self-signed certificate for hosts to certFile
+// and keyFile unless certFile already exists. It reports whether it
+// created one.
+func EnsureSelfSigned(certFile, keyFile string, hosts ...string) (bool, error) {
+	if _, err := os.Stat(certFile); err == nil {
+		return false, nil
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return false, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return false, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 127))
+	if err != nil {
+		return false, err
+	}
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0]},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.AddDate(1, 0, 0),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, h := range hosts {
+		if ip := net.ParseIP(h); ip != nil {
+			tmpl.IPAddresses = append(tmpl.IPAddresses, ip)
+		} else {
+			tmpl.DNSNames = append(tmpl.DNSNames, h)
+		}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return false, err
+	}
+	keyDER, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDER}), 0o600); err != nil {
+		return false, err
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+func loadPool(file string) (*x509.CertPool, error) {
+	b, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("tlsutil: %w", err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(b) {
+		return nil, fmt.Errorf("tlsutil: no certificates in %s", file)
+	}
+	return pool, nil
+}